@@ -1,11 +1,19 @@
 package handler
 
 import (
+	"context"
+	"log"
 	"net/http"
 	"order-mgmt-backend/database"
 	"order-mgmt-backend/handlers"
+	"order-mgmt-backend/payments"
+	"order-mgmt-backend/pubsub"
+	"order-mgmt-backend/storage"
+	"order-mgmt-backend/wallet"
 	"order-mgmt-backend/websocket"
+	"os"
 	"sync"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -19,6 +27,27 @@ var (
 func initEngine() {
 	database.InitDB()
 
+	if fake, ok := payments.Default.(*payments.Fake); ok {
+		fake.OnSettle = handlers.PaymentSettled
+	}
+	if dir := os.Getenv("STORAGE_DIR"); dir != "" {
+		storage.Default = storage.Disk{Dir: dir}
+	} else {
+		log.Printf("WARNING: STORAGE_DIR is not set, proofs of delivery are only kept in memory")
+	}
+	if database.DB != nil {
+		payments.DefaultWallet = wallet.Ledger{DB: database.DB}
+		websocket.GlobalHub.Replay = handlers.ReplayOrderEvents
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		broker, err := pubsub.NewPostgres(ctx, database.DB, database.DSN(), pubsub.DefaultChannel)
+		cancel()
+		if err != nil {
+			log.Printf("PUBSUB ERROR: falling back to in-process broadcasts: %v", err)
+		} else {
+			websocket.GlobalHub.UseBroker(broker)
+		}
+	}
+
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
 	r.Use(gin.Recovery())
@@ -26,7 +55,7 @@ func initEngine() {
 	r.Use(cors.New(cors.Config{
 		AllowOriginFunc:  func(origin string) bool { return true },
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With", "X-Admin-Key"},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 	}))
@@ -38,16 +67,66 @@ func initEngine() {
 	r.POST("/api/orders", handlers.CreateOrder)
 	r.GET("/api/orders/:id", handlers.GetOrder)
 	r.POST("/api/orders/:id/cancel", handlers.CancelOrder)
-	r.PATCH("/api/orders/:id/status", handlers.UpdateOrderStatus)
-	r.GET("/api/orders/user/:name", handlers.GetUserOrders)
+	r.PATCH("/api/orders/:id/status", handlers.RequireAdmin, handlers.UpdateOrderStatus)
+	r.GET("/api/orders/:id/ticket", handlers.GetOrderTicket)
+	r.GET("/api/orders/:id/invoice", handlers.GetOrderInvoice)
+	r.GET("/api/orders/:id/events", handlers.GetOrderEvents)
+	r.GET("/api/orders/:id/track", handlers.GetOrderTrack)
+	r.GET("/api/orders/:id/delivery-code", handlers.GetDeliveryCode)
+	r.GET("/api/users/:id/wallet", handlers.GetWallet)
+	r.GET("/api/users/:id/loyalty", handlers.GetLoyalty)
+	r.GET("/api/users/:id/orders", handlers.GetUserOrders)
 	r.POST("/api/login", handlers.Login)
+	r.POST("/api/webhooks/payments", handlers.PaymentWebhook)
 	r.GET("/api/offers", handlers.GetOffers)
 	r.GET("/api/locations", handlers.GetLocations)
-	r.GET("/api/ws/order-status", func(c *gin.Context) {
-		websocket.GlobalHub.HandleWS(c.Writer, c.Request)
-	})
+	r.GET("/api/outlets", handlers.GetOutlets)
+	r.GET("/api/serviceability", handlers.GetServiceability)
+	r.GET("/api/ws/order-status", handlers.OrderStatusWS)
+	r.GET("/api/ws", handlers.StreamWS)
 	r.GET("/api/test-db", handlers.TestDB)
 
+	kds := r.Group("/api/kitchen", handlers.RequireKitchen)
+	kds.GET("/outlets/:id/orders", handlers.GetKitchenOrders)
+	kds.POST("/orders/:id/accept", handlers.AcceptOrder)
+	kds.POST("/orders/:id/reject", handlers.RejectOrder)
+	kds.POST("/orders/:id/ready", handlers.MarkOrderReady)
+	kds.GET("/ws", handlers.KitchenWS)
+
+	rider := r.Group("/api/rider", handlers.RequireRider)
+	rider.POST("/availability", handlers.SetRiderAvailability)
+	rider.POST("/location", handlers.RecordRiderLocation)
+	rider.GET("/ws", handlers.RiderWS)
+	rider.GET("/orders", handlers.GetRiderOrders)
+	rider.POST("/orders/:id/accept", handlers.AcceptDelivery)
+	rider.POST("/orders/:id/pickup", handlers.PickUpOrder)
+	rider.POST("/orders/:id/deliver", handlers.DeliverOrder)
+	rider.POST("/orders/:id/proof", handlers.SubmitDeliveryProof)
+
+	admin := r.Group("/api/admin", handlers.RequireAdmin)
+	admin.POST("/pause", handlers.PauseOrdering)
+	admin.DELETE("/pause", handlers.ResumeOrdering)
+	admin.POST("/outlets/:id/kitchen-token", handlers.IssueKitchenToken)
+	admin.POST("/outlets/:id/holidays", handlers.AddHoliday)
+	admin.DELETE("/outlets/:id/holidays/:holiday", handlers.RemoveHoliday)
+	admin.POST("/webhooks/retry", handlers.RetryWebhooks)
+	admin.POST("/orders/:id/refunds", handlers.CreateRefund)
+	admin.POST("/orders/:id/collect", handlers.CollectCash)
+	admin.POST("/orders/:id/deliver", handlers.OverrideDelivery)
+	admin.GET("/orders/:id/proofs", handlers.GetDeliveryProofs)
+	admin.GET("/orders/:id/proofs/:proof", handlers.GetDeliveryProofFile)
+	admin.POST("/users/:id/wallet/credits", handlers.GrantCredit)
+	admin.POST("/wallet/expire", handlers.ExpireWallets)
+	admin.POST("/gift-cards", handlers.IssueGiftCard)
+	admin.POST("/gift-cards/lookup", handlers.LookupGiftCard)
+	admin.GET("/gift-cards/:id", handlers.GetGiftCard)
+	admin.POST("/gift-cards/:id/void", handlers.VoidGiftCard)
+	admin.POST("/riders", handlers.CreateRider)
+	admin.GET("/riders", handlers.ListRiders)
+	admin.POST("/riders/:id/token", handlers.IssueRiderToken)
+	admin.GET("/loyalty/rules", handlers.GetLoyaltyRules)
+	admin.PUT("/loyalty/rules", handlers.UpdateLoyaltyRules)
+
 	r.GET("/", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "ok", "message": "Order Management API"})
 	})
@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	secret := []byte("s3cret")
+	now := time.Date(2026, 3, 5, 12, 0, 0, 0, time.UTC)
+	token := Sign(secret, Claims{UserID: 7}, now.Add(time.Hour))
+
+	claims, err := Verify(secret, token, now)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(7), claims.UserID)
+
+	_, err = Verify(secret, token, now.Add(time.Hour))
+	assert.ErrorIs(t, err, ErrExpiredToken)
+	_, err = Verify([]byte("other"), token, now)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// Changing the claims breaks the signature.
+	payload, sig, _ := strings.Cut(token, ".")
+	forged := Sign([]byte("guess"), Claims{UserID: 1}, now.Add(time.Hour))
+	forgedPayload, _, _ := strings.Cut(forged, ".")
+	_, err = Verify(secret, forgedPayload+"."+sig, now)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = Verify(secret, payload, now)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
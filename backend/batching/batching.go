@@ -0,0 +1,172 @@
+// Package batching groups ready orders from one outlet into a single
+// delivery run when their drop-offs lie close together, and orders the
+// stops. A run is only formed if no order in it is held up by more than a
+// set detour, or made late when it would have been on time on its own.
+package batching
+
+import (
+	"fmt"
+	"order-mgmt-backend/geo"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// maxOrdersLimit bounds MaxOrders, since Plan tries every stop order.
+const maxOrdersLimit = 6
+
+// Order is an order that may go in a run.
+type Order struct {
+	ID   string
+	Drop geo.Point
+	// DueAt is when the customer was told to expect it, zero if never.
+	DueAt time.Time
+}
+
+// Config sets which orders may share a run.
+type Config struct {
+	// MaxOrders is the most orders in one run; 1 turns batching off.
+	MaxOrders int
+	// MaxDetour is how much later than on a trip of its own any order in
+	// a run may arrive.
+	MaxDetour time.Duration
+	// MaxDropGapKm is the furthest any two drop-offs in a run may be apart.
+	MaxDropGapKm float64
+	// SpeedKmh is the rider's assumed speed when planning.
+	SpeedKmh float64
+	// StopTime is spent handing over each order before driving on.
+	StopTime time.Duration
+}
+
+// DefaultConfig suits riders on scooters in city traffic.
+func DefaultConfig() Config {
+	return Config{
+		MaxOrders:    3,
+		MaxDetour:    10 * time.Minute,
+		MaxDropGapKm: 3,
+		SpeedKmh:     20,
+		StopTime:     2 * time.Minute,
+	}
+}
+
+// FromEnv is DefaultConfig with any of BATCH_MAX_ORDERS, BATCH_MAX_DETOUR
+// and BATCH_MAX_DROP_GAP_KM applied. The detour is a duration such as
+// "10m".
+func FromEnv() (Config, error) {
+	c := DefaultConfig()
+	for name, set := range map[string]func(string) error{
+		"BATCH_MAX_ORDERS": func(v string) (err error) {
+			c.MaxOrders, err = strconv.Atoi(v)
+			if err == nil && (c.MaxOrders < 1 || c.MaxOrders > maxOrdersLimit) {
+				err = fmt.Errorf("must be between 1 and %d", maxOrdersLimit)
+			}
+			return err
+		},
+		"BATCH_MAX_DETOUR": func(v string) (err error) {
+			c.MaxDetour, err = time.ParseDuration(v)
+			return err
+		},
+		"BATCH_MAX_DROP_GAP_KM": func(v string) (err error) {
+			c.MaxDropGapKm, err = strconv.ParseFloat(v, 64)
+			return err
+		},
+	} {
+		if v := os.Getenv(name); v != "" {
+			if err := set(v); err != nil {
+				return DefaultConfig(), fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+	return c, nil
+}
+
+// Run is a planned delivery run: its orders in the order they are dropped
+// off, when each arrives and how far the rider drives.
+type Run struct {
+	Stops      []Order
+	Arrivals   []time.Time
+	DistanceKm float64
+}
+
+// Arrivals is when a rider leaving from at depart, going at speedKmh,
+// reaches each of drops in turn, stopping StopTime at each.
+func (c Config) Arrivals(from geo.Point, drops []geo.Point, speedKmh float64, depart time.Time) []time.Time {
+	out := make([]time.Time, len(drops))
+	at, pos := depart, from
+	for i, d := range drops {
+		at = at.Add(geo.TravelTime(geo.DistanceKm(pos, d), speedKmh))
+		out[i] = at
+		at, pos = at.Add(c.StopTime), d
+	}
+	return out
+}
+
+// Plan finds the shortest run that takes orders from pickup, leaving at
+// depart, or reports that they cannot share one. Equal runs are broken on
+// the order IDs, so the plan is the same every time.
+func (c Config) Plan(pickup geo.Point, orders []Order, depart time.Time) (Run, bool) {
+	if len(orders) == 0 || len(orders) > c.MaxOrders || len(orders) > maxOrdersLimit {
+		return Run{}, false
+	}
+	for i := range orders {
+		for j := i + 1; j < len(orders); j++ {
+			if geo.DistanceKm(orders[i].Drop, orders[j].Drop) > c.MaxDropGapKm {
+				return Run{}, false
+			}
+		}
+	}
+
+	sorted := append([]Order(nil), orders...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+	direct := make(map[string]time.Time, len(sorted))
+	for _, o := range sorted {
+		direct[o.ID] = c.Arrivals(pickup, []geo.Point{o.Drop}, c.SpeedKmh, depart)[0]
+	}
+
+	var best Run
+	found := false
+	permute(sorted, 0, func(stops []Order) {
+		drops := make([]geo.Point, len(stops))
+		for i, o := range stops {
+			drops[i] = o.Drop
+		}
+		arrivals := c.Arrivals(pickup, drops, c.SpeedKmh, depart)
+		for i, o := range stops {
+			alone := direct[o.ID]
+			if arrivals[i].Sub(alone) > c.MaxDetour {
+				return
+			}
+			if !o.DueAt.IsZero() && !alone.After(o.DueAt) && arrivals[i].After(o.DueAt) {
+				return
+			}
+		}
+		km, pos := 0.0, pickup
+		for _, d := range drops {
+			km, pos = km+geo.DistanceKm(pos, d), d
+		}
+		if !found || km < best.DistanceKm {
+			best = Run{Stops: append([]Order(nil), stops...), Arrivals: arrivals, DistanceKm: km}
+			found = true
+		}
+	})
+	return best, found
+}
+
+// permute calls visit with every ordering of orders[k:], in lexical order
+// of the starting slice.
+func permute(orders []Order, k int, visit func([]Order)) {
+	if k == len(orders) {
+		visit(orders)
+		return
+	}
+	for i := k; i < len(orders); i++ {
+		// Rotate orders[i] into position k so that the rest stay in order.
+		picked := orders[i]
+		copy(orders[k+1:i+1], orders[k:i])
+		orders[k] = picked
+		permute(orders, k+1, visit)
+		copy(orders[k:i], orders[k+1:i+1])
+		orders[i] = picked
+	}
+}
@@ -0,0 +1,88 @@
+package batching
+
+import (
+	"order-mgmt-backend/geo"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	start  = time.Date(2026, 3, 5, 12, 0, 0, 0, time.UTC)
+	outlet = geo.Point{Lat: 12.97, Lng: 77.59}
+)
+
+// north is a point about km kilometres north of the outlet.
+func north(km float64) geo.Point {
+	return geo.Point{Lat: outlet.Lat + km/111.2, Lng: outlet.Lng}
+}
+
+func ids(run Run) []string {
+	out := make([]string, len(run.Stops))
+	for i, o := range run.Stops {
+		out[i] = o.ID
+	}
+	return out
+}
+
+func TestArrivals(t *testing.T) {
+	c := DefaultConfig()
+	got := c.Arrivals(outlet, []geo.Point{north(2), north(3)}, 20, start)
+	assert.InDelta(t, (6 * time.Minute).Seconds(), got[0].Sub(start).Seconds(), 2)
+	assert.InDelta(t, (11 * time.Minute).Seconds(), got[1].Sub(start).Seconds(), 2)
+}
+
+func TestPlan(t *testing.T) {
+	c := DefaultConfig()
+
+	// Stops go nearest first, whatever order they come in.
+	run, ok := c.Plan(outlet, []Order{{ID: "far", Drop: north(3)}, {ID: "near", Drop: north(2)}}, start)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"near", "far"}, ids(run))
+	assert.InDelta(t, 3, run.DistanceKm, 0.01)
+	assert.Len(t, run.Arrivals, 2)
+
+	// Drop-offs too far apart are not batched.
+	south := geo.Point{Lat: outlet.Lat - 1/111.2, Lng: outlet.Lng}
+	_, ok = c.Plan(outlet, []Order{{ID: "a", Drop: north(2.5)}, {ID: "b", Drop: south}}, start)
+	assert.False(t, ok)
+
+	// Nor are orders that the other would hold up too long: b waits two
+	// minutes while a is handed over.
+	c.MaxDetour = time.Minute
+	_, ok = c.Plan(outlet, []Order{{ID: "a", Drop: north(1)}, {ID: "b", Drop: north(3)}}, start)
+	assert.False(t, ok)
+	c.MaxDetour = DefaultConfig().MaxDetour
+
+	// An order on time alone must stay on time.
+	_, ok = c.Plan(outlet, []Order{{ID: "a", Drop: north(1)}, {ID: "b", Drop: north(3), DueAt: start.Add(10 * time.Minute)}}, start)
+	assert.False(t, ok)
+	run, ok = c.Plan(outlet, []Order{{ID: "a", Drop: north(1)}, {ID: "b", Drop: north(3), DueAt: start.Add(12 * time.Minute)}}, start)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"a", "b"}, ids(run))
+
+	// Runs are capped in size.
+	four := []Order{{ID: "a", Drop: north(1)}, {ID: "b", Drop: north(1.2)}, {ID: "c", Drop: north(1.4)}, {ID: "d", Drop: north(1.6)}}
+	_, ok = c.Plan(outlet, four, start)
+	assert.False(t, ok)
+	c.MaxOrders = 4
+	run, ok = c.Plan(outlet, four, start)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"a", "b", "c", "d"}, ids(run))
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("BATCH_MAX_ORDERS", "2")
+	t.Setenv("BATCH_MAX_DETOUR", "5m")
+	c, err := FromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, c.MaxOrders)
+	assert.Equal(t, 5*time.Minute, c.MaxDetour)
+	assert.Equal(t, DefaultConfig().MaxDropGapKm, c.MaxDropGapKm)
+
+	t.Setenv("BATCH_MAX_ORDERS", "12")
+	c, err = FromEnv()
+	assert.Error(t, err)
+	assert.Equal(t, DefaultConfig(), c)
+}
@@ -0,0 +1,6 @@
+package clock
+
+import "time"
+
+// Now returns the current time. Tests swap it out to pin the clock.
+var Now = time.Now
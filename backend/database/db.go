@@ -5,6 +5,7 @@ import (
 	"log"
 	"order-mgmt-backend/models"
 	"os"
+	"strings"
 
 	"github.com/joho/godotenv"
 	"gorm.io/driver/postgres"
@@ -18,23 +19,12 @@ func InitDB() {
 		log.Println("No .env file found, using environment variables")
 	}
 
-	host := os.Getenv("DB_HOST")
-	if host == "" {
+	if os.Getenv("DB_HOST") == "" {
 		log.Println("WARNING: DB_HOST is not set")
 	}
 
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s search_path=%s",
-		host,
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_NAME"),
-		os.Getenv("DB_PORT"),
-		os.Getenv("DB_SSLMODE"),
-		os.Getenv("DB_SCHEMA"),
-	)
-
 	var err error
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	DB, err = gorm.Open(postgres.Open(DSN()), &gorm.Config{})
 	if err != nil {
 		log.Printf("DATABASE ERROR: Failed to connect to database: %v", err)
 		return
@@ -45,7 +35,7 @@ func InitDB() {
 		DB.Exec(fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", schema))
 	}
 
-	err = DB.AutoMigrate(&models.Item{}, &models.Order{}, &models.OrderItem{}, &models.User{}, &models.Offer{}, &models.Location{})
+	err = Migrate(DB)
 	if err != nil {
 		log.Printf("MIGRATION ERROR: %v", err)
 		return
@@ -54,23 +44,81 @@ func InitDB() {
 	seedData()
 }
 
+// DSN is the connection string built from the DB_* environment variables.
+func DSN() string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s search_path=%s",
+		os.Getenv("DB_HOST"),
+		os.Getenv("DB_USER"),
+		os.Getenv("DB_PASSWORD"),
+		os.Getenv("DB_NAME"),
+		os.Getenv("DB_PORT"),
+		os.Getenv("DB_SSLMODE"),
+		os.Getenv("DB_SCHEMA"),
+	)
+}
+
+// Migrate creates or updates every table the API uses.
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(
+		&models.Item{},
+		&models.MenuSchedule{},
+		&models.Order{},
+		&models.OrderItem{},
+		&models.User{},
+		&models.Offer{},
+		&models.Location{},
+		&models.Outlet{},
+		&models.OutletItem{},
+		&models.OutletHours{},
+		&models.OutletHoliday{},
+		&models.OrderingPause{},
+		&models.InvoiceSequence{},
+		&models.WebhookEvent{},
+		&models.OrderEvent{},
+		&models.WebhookRetry{},
+		&models.OrderPayment{},
+		&models.Refund{},
+		&models.WalletAccount{},
+		&models.WalletTransaction{},
+		&models.LedgerEntry{},
+		&models.LoyaltyRules{},
+		&models.LoyaltyAccount{},
+		&models.LoyaltyMovement{},
+		&models.GiftCard{},
+		&models.GiftCardTransaction{},
+		&models.Rider{},
+		&models.RiderPing{},
+		&models.DeliveryProof{},
+		&models.DeliveryOverride{},
+	)
+}
+
 func seedData() {
 	var itemCount int64
 	DB.Model(&models.Item{}).Count(&itemCount)
 	if itemCount == 0 {
 		items := []models.Item{
-			{Name: "Margherita Pizza", Description: "Classic tomato and mozzarella - Veg", Price: 299, ImageURL: "https://images.unsplash.com/photo-1604382354936-07c5d9983bd3?auto=format&fit=crop&w=800&q=80"},
-			{Name: "Pepperoni Pizza", Description: "Double pepperoni with extra cheese", Price: 499, ImageURL: "https://images.unsplash.com/photo-1628840042765-356cda07504e?auto=format&fit=crop&w=800&q=80"},
-			{Name: "Veggie Burger", Description: "Plant-based patty with fresh greens - Veg", Price: 199, ImageURL: "https://images.unsplash.com/photo-1512621776951-a57141f2eefd?auto=format&fit=crop&w=800&q=80"},
-			{Name: "Grilled Chicken Salad", Description: "Organic chicken with honey mustard", Price: 349, ImageURL: "https://images.unsplash.com/photo-1546069901-ba9599a7e63c?auto=format&fit=crop&w=800&q=80"},
-			{Name: "Paneer Tikka", Description: "Spiced cottage cheese cubes grilled - Veg", Price: 250, ImageURL: "https://images.unsplash.com/photo-1599487488170-d11ec9c172f0?auto=format&fit=crop&w=800&q=80"},
-			{Name: "Butter Chicken", Description: "Creamy tomato based chicken curry", Price: 450, ImageURL: "https://images.unsplash.com/photo-1626074353765-517a681e40be?auto=format&fit=crop&w=800&q=80"},
-			{Name: "Masala Dosa", Description: "Crispy crepe with potato filling - Veg", Price: 120, ImageURL: "https://images.unsplash.com/photo-1668236543090-82eba5ee5976?auto=format&fit=crop&w=800&q=80"},
-			{Name: "Chicken Biryani", Description: "Aromatic rice dish with spicy chicken", Price: 399, ImageURL: "https://images.unsplash.com/photo-1633945274405-b6c8069047b0?auto=format&fit=crop&w=800&q=80"},
+			{Name: "Margherita Pizza", Description: "Classic tomato and mozzarella - Veg", Price: 299, PrepMinutes: 15, ImageURL: "https://images.unsplash.com/photo-1604382354936-07c5d9983bd3?auto=format&fit=crop&w=800&q=80"},
+			{Name: "Pepperoni Pizza", Description: "Double pepperoni with extra cheese", Price: 499, PrepMinutes: 15, ImageURL: "https://images.unsplash.com/photo-1628840042765-356cda07504e?auto=format&fit=crop&w=800&q=80"},
+			{Name: "Veggie Burger", Description: "Plant-based patty with fresh greens - Veg", Price: 199, PrepMinutes: 10, ImageURL: "https://images.unsplash.com/photo-1512621776951-a57141f2eefd?auto=format&fit=crop&w=800&q=80"},
+			{Name: "Grilled Chicken Salad", Description: "Organic chicken with honey mustard", Price: 349, PrepMinutes: 8, ImageURL: "https://images.unsplash.com/photo-1546069901-ba9599a7e63c?auto=format&fit=crop&w=800&q=80"},
+			{Name: "Paneer Tikka", Description: "Spiced cottage cheese cubes grilled - Veg", Price: 250, PrepMinutes: 20, ImageURL: "https://images.unsplash.com/photo-1599487488170-d11ec9c172f0?auto=format&fit=crop&w=800&q=80"},
+			{Name: "Butter Chicken", Description: "Creamy tomato based chicken curry", Price: 450, PrepMinutes: 25, ImageURL: "https://images.unsplash.com/photo-1626074353765-517a681e40be?auto=format&fit=crop&w=800&q=80"},
+			{Name: "Masala Dosa", Description: "Crispy crepe with potato filling - Veg", Price: 120, PrepMinutes: 12, Category: "Breakfast", ImageURL: "https://images.unsplash.com/photo-1668236543090-82eba5ee5976?auto=format&fit=crop&w=800&q=80"},
+			{Name: "Chicken Biryani", Description: "Aromatic rice dish with spicy chicken", Price: 399, PrepMinutes: 30, ImageURL: "https://images.unsplash.com/photo-1633945274405-b6c8069047b0?auto=format&fit=crop&w=800&q=80"},
 		}
 		DB.Create(&items)
 	}
 
+	var scheduleCount int64
+	DB.Model(&models.MenuSchedule{}).Count(&scheduleCount)
+	if scheduleCount == 0 {
+		schedules := []models.MenuSchedule{
+			{Category: "Breakfast", StartTime: "07:00", EndTime: "11:00"},
+		}
+		DB.Create(&schedules)
+	}
+
 	var userCount int64
 	DB.Model(&models.User{}).Count(&userCount)
 	if userCount == 0 {
@@ -103,4 +151,35 @@ func seedData() {
 		}
 		DB.Create(&locations)
 	}
+
+	var outletCount int64
+	DB.Model(&models.Outlet{}).Count(&outletCount)
+	if outletCount == 0 {
+		var locations []models.Location
+		DB.Order("id").Find(&locations)
+		coords := map[string][2]float64{
+			"Bengaluru, Karnataka": {12.9716, 77.5946},
+			"Mumbai, Maharashtra":  {19.0760, 72.8777},
+			"Delhi, NCR":           {28.6139, 77.2090},
+			"Hyderabad, Telangana": {17.3850, 78.4867},
+			"Chennai, Tamil Nadu":  {13.0827, 80.2707},
+		}
+		for _, loc := range locations {
+			c := coords[loc.Name]
+			outlet := models.Outlet{
+				Name:             strings.SplitN(loc.Name, ",", 2)[0] + " Central Kitchen",
+				Address:          loc.Name,
+				Latitude:         c[0],
+				Longitude:        c[1],
+				DeliveryRadiusKm: 15,
+				LocationID:       loc.ID,
+				TimeZone:         "Asia/Kolkata",
+				OpensAt:          "07:00",
+				ClosesAt:         "23:00",
+				KitchenStations:  3,
+				MaxActiveOrders:  20,
+			}
+			DB.Create(&outlet)
+		}
+	}
 }
@@ -0,0 +1,116 @@
+// Package dispatch chooses which rider takes an order once it is ready. The
+// choice is made by a Strategy over a snapshot of the riders, so it is the
+// same every time for the same riders.
+package dispatch
+
+import (
+	"fmt"
+	"math"
+	"order-mgmt-backend/geo"
+	"time"
+)
+
+// Rider is what a strategy knows of a rider on shift.
+type Rider struct {
+	ID             uint
+	Location       *geo.Point // last reported position, nil if unknown
+	Load           int        // orders assigned and not yet delivered
+	Capacity       int        // orders carried at once, 1 if unset
+	LastAssignedAt time.Time  // zero if never assigned
+}
+
+// Free reports whether the rider can take another order.
+func (r Rider) Free() bool {
+	capacity := r.Capacity
+	if capacity < 1 {
+		capacity = 1
+	}
+	return r.Load < capacity
+}
+
+// distanceKm is how far the rider is from p, infinite when either position
+// is unknown.
+func (r Rider) distanceKm(p *geo.Point) float64 {
+	if r.Location == nil || p == nil {
+		return math.Inf(1)
+	}
+	return geo.DistanceKm(*r.Location, *p)
+}
+
+// Job is an order waiting for a rider.
+type Job struct {
+	OrderID string
+	Pickup  *geo.Point // the outlet, nil if unknown
+}
+
+// Strategy picks a rider for a job from riders, or reports that none of
+// them is free.
+type Strategy interface {
+	Pick(job Job, riders []Rider) (Rider, bool)
+}
+
+// pick returns the free rider that no other free rider is better than,
+// breaking ties on the lower ID.
+func pick(riders []Rider, better func(a, b Rider) bool) (Rider, bool) {
+	var best Rider
+	found := false
+	for _, r := range riders {
+		if !r.Free() {
+			continue
+		}
+		if !found || better(r, best) || (!better(best, r) && r.ID < best.ID) {
+			best, found = r, true
+		}
+	}
+	return best, found
+}
+
+// Nearest picks the rider closest to the pickup, then the least loaded.
+// Riders with no known position come last.
+type Nearest struct{}
+
+func (Nearest) Pick(job Job, riders []Rider) (Rider, bool) {
+	return pick(riders, func(a, b Rider) bool {
+		da, db := a.distanceKm(job.Pickup), b.distanceKm(job.Pickup)
+		if da != db {
+			return da < db
+		}
+		return a.Load < b.Load
+	})
+}
+
+// RoundRobin picks the rider who has waited longest since their last
+// assignment, so that work is shared out in turn.
+type RoundRobin struct{}
+
+func (RoundRobin) Pick(job Job, riders []Rider) (Rider, bool) {
+	return pick(riders, func(a, b Rider) bool {
+		return a.LastAssignedAt.Before(b.LastAssignedAt)
+	})
+}
+
+// LeastLoaded picks the rider carrying the fewest orders, then the nearest.
+type LeastLoaded struct{}
+
+func (LeastLoaded) Pick(job Job, riders []Rider) (Rider, bool) {
+	return pick(riders, func(a, b Rider) bool {
+		if a.Load != b.Load {
+			return a.Load < b.Load
+		}
+		return a.distanceKm(job.Pickup) < b.distanceKm(job.Pickup)
+	})
+}
+
+// ByName returns the strategy called name: "nearest", "round_robin" or
+// "least_loaded". An empty name is nearest.
+func ByName(name string) (Strategy, error) {
+	switch name {
+	case "", "nearest":
+		return Nearest{}, nil
+	case "round_robin":
+		return RoundRobin{}, nil
+	case "least_loaded":
+		return LeastLoaded{}, nil
+	}
+	return nil, fmt.Errorf("unknown dispatch strategy %q", name)
+}
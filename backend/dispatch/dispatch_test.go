@@ -0,0 +1,71 @@
+package dispatch
+
+import (
+	"order-mgmt-backend/geo"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	outlet = &geo.Point{Lat: 12.9716, Lng: 77.5946}
+	near   = &geo.Point{Lat: 12.9726, Lng: 77.5950}
+	far    = &geo.Point{Lat: 12.9900, Lng: 77.6200}
+)
+
+func TestNearest(t *testing.T) {
+	job := Job{OrderID: "o1", Pickup: outlet}
+	riders := []Rider{
+		{ID: 1, Location: far},
+		{ID: 2},
+		{ID: 3, Location: near, Load: 1, Capacity: 1},
+		{ID: 4, Location: near, Load: 1, Capacity: 2},
+		{ID: 5, Location: near, Capacity: 2},
+	}
+	r, ok := Nearest{}.Pick(job, riders)
+	assert.True(t, ok)
+	assert.Equal(t, uint(5), r.ID, "busy rider 3 is skipped and 5 is less loaded than 4")
+
+	// Without a pickup point every rider is as near as the next.
+	r, _ = Nearest{}.Pick(Job{}, riders)
+	assert.Equal(t, uint(1), r.ID)
+
+	_, ok = Nearest{}.Pick(job, []Rider{{ID: 3, Load: 1}})
+	assert.False(t, ok)
+}
+
+func TestRoundRobin(t *testing.T) {
+	now := time.Date(2026, 3, 5, 12, 0, 0, 0, time.UTC)
+	riders := []Rider{
+		{ID: 1, LastAssignedAt: now},
+		{ID: 2, LastAssignedAt: now.Add(-time.Minute)},
+		{ID: 3, LastAssignedAt: now.Add(-time.Minute)},
+	}
+	r, _ := RoundRobin{}.Pick(Job{}, riders)
+	assert.Equal(t, uint(2), r.ID)
+
+	riders = append(riders, Rider{ID: 9})
+	r, _ = RoundRobin{}.Pick(Job{}, riders)
+	assert.Equal(t, uint(9), r.ID, "a rider never assigned goes first")
+}
+
+func TestLeastLoaded(t *testing.T) {
+	riders := []Rider{
+		{ID: 1, Location: near, Load: 2, Capacity: 3},
+		{ID: 2, Location: far, Load: 1, Capacity: 3},
+		{ID: 3, Location: near, Load: 1, Capacity: 3},
+	}
+	r, _ := LeastLoaded{}.Pick(Job{Pickup: outlet}, riders)
+	assert.Equal(t, uint(3), r.ID)
+}
+
+func TestByName(t *testing.T) {
+	for name, want := range map[string]Strategy{"": Nearest{}, "nearest": Nearest{}, "round_robin": RoundRobin{}, "least_loaded": LeastLoaded{}} {
+		s, err := ByName(name)
+		assert.NoError(t, err)
+		assert.Equal(t, want, s)
+	}
+	_, err := ByName("random")
+	assert.Error(t, err)
+}
@@ -0,0 +1,260 @@
+// Package events numbers and stores the events pushed to an order's
+// subscribers, so that a client that was offline can catch up on what it
+// missed before following live events.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"order-mgmt-backend/clock"
+	"order-mgmt-backend/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Version is the version of the Event wire format. It changes whenever a
+// field changes meaning or is removed; new fields and types do not bump it.
+// Version 2 renamed order.status to order.status_changed.
+const Version = 2
+
+const (
+	// TypeCreated is sent once, when the order is placed.
+	TypeCreated = "order.created"
+	// TypeStatusChanged is sent when an order moves to a new status other
+	// than Cancelled.
+	TypeStatusChanged = "order.status_changed"
+	// TypeETAUpdated is sent when the ready or delivery estimate moves.
+	TypeETAUpdated = "order.eta_updated"
+	// TypeRiderAssigned is sent when a rider takes the order.
+	TypeRiderAssigned = "rider.assigned"
+	// TypeRiderLocation is sent as the rider carrying the order moves. It
+	// is not stored: a client that missed some only needs the next.
+	TypeRiderLocation = "rider.location"
+	// TypePaymentUpdated is sent when the payment status or the amount
+	// refunded changes.
+	TypePaymentUpdated = "payment.updated"
+	// TypeCancelled is sent when the order is cancelled, with the reason.
+	TypeCancelled = "order.cancelled"
+	// TypeSnapshot is the current state, sent to a client that subscribes
+	// without saying where it got up to. It is not stored.
+	TypeSnapshot = "order.snapshot"
+
+	// legacyTypeStatus is what order.status_changed was stored as in
+	// version 1.
+	legacyTypeStatus = "order.status"
+)
+
+// MaxReplay caps how many missed events are sent on one resume. A client
+// further behind should fetch the order instead.
+const MaxReplay = 500
+
+var ErrInvalidEvent = errors.New("event needs a type and an order")
+
+// Event is the message pushed to an order's subscribers. OrderID and Status
+// keep the names of the unversioned messages sent before, so that older
+// clients still read them. Which of the other fields are set depends on
+// Type.
+type Event struct {
+	V       int       `json:"v"`
+	Seq     int64     `json:"seq"`
+	Type    string    `json:"type"`
+	OrderID string    `json:"orderId"`
+	Status  string    `json:"status,omitempty"`
+	At      time.Time `json:"at"`
+
+	PreviousStatus string    `json:"previousStatus,omitempty"`
+	Reason         string    `json:"reason,omitempty"`
+	Order          *Summary  `json:"order,omitempty"`
+	ETA            *ETA      `json:"eta,omitempty"`
+	Payment        *Payment  `json:"payment,omitempty"`
+	Rider          *Rider    `json:"rider,omitempty"`
+	Location       *Location `json:"location,omitempty"`
+}
+
+// Summary is what a tracking page shows of the order itself.
+type Summary struct {
+	Total    float64 `json:"total"`
+	Items    int     `json:"items"`
+	OutletID *uint   `json:"outletId,omitempty"`
+}
+
+// ETA is when the order is expected to be ready and delivered.
+type ETA struct {
+	ReadyAt    *time.Time `json:"readyAt,omitempty"`
+	DeliveryAt *time.Time `json:"deliveryAt,omitempty"`
+}
+
+// Payment is the state of the order's payment.
+type Payment struct {
+	Status   string  `json:"status"`
+	Method   string  `json:"method,omitempty"`
+	Amount   float64 `json:"amount"`
+	Refunded float64 `json:"refunded,omitempty"`
+}
+
+// Rider is the rider carrying the order, as shown to the customer.
+type Rider struct {
+	ID    uint   `json:"id"`
+	Name  string `json:"name"`
+	Phone string `json:"phone,omitempty"`
+}
+
+// Location is a rider's position and, if known, speed.
+type Location struct {
+	Lat      float64 `json:"lat"`
+	Lng      float64 `json:"lng"`
+	SpeedKmh float64 `json:"speedKmh,omitempty"`
+}
+
+func summaryOf(order models.Order) *Summary {
+	items := 0
+	for _, item := range order.OrderItems {
+		items += item.Quantity
+	}
+	return &Summary{Total: order.TotalPrice, Items: items, OutletID: order.OutletID}
+}
+
+func etaOf(order models.Order) *ETA {
+	if order.EstimatedReadyAt == nil && order.EstimatedDeliveryAt == nil {
+		return nil
+	}
+	return &ETA{ReadyAt: order.EstimatedReadyAt, DeliveryAt: order.EstimatedDeliveryAt}
+}
+
+func paymentOf(order models.Order) *Payment {
+	return &Payment{
+		Status:   order.PaymentStatus,
+		Method:   order.PaymentMethod,
+		Amount:   order.TotalPrice,
+		Refunded: order.RefundedAmount,
+	}
+}
+
+func newEvent(typ string, order models.Order) Event {
+	return Event{V: Version, Type: typ, OrderID: order.ID, Status: order.Status}
+}
+
+// Created describes a newly placed order.
+func Created(order models.Order) Event {
+	e := newEvent(TypeCreated, order)
+	e.Order, e.ETA, e.Payment = summaryOf(order), etaOf(order), paymentOf(order)
+	return e
+}
+
+// StatusChanged describes the order's move from previous to its status.
+func StatusChanged(order models.Order, previous string) Event {
+	e := newEvent(TypeStatusChanged, order)
+	e.PreviousStatus, e.Reason, e.ETA = previous, order.StatusReason, etaOf(order)
+	return e
+}
+
+// ETAUpdated carries the order's new estimates.
+func ETAUpdated(order models.Order) Event {
+	e := newEvent(TypeETAUpdated, order)
+	e.ETA = etaOf(order)
+	return e
+}
+
+// PaymentUpdated carries the order's payment as it now stands.
+func PaymentUpdated(order models.Order) Event {
+	e := newEvent(TypePaymentUpdated, order)
+	e.Payment = paymentOf(order)
+	return e
+}
+
+// Cancelled describes a cancelled order and why.
+func Cancelled(order models.Order) Event {
+	e := newEvent(TypeCancelled, order)
+	e.Reason, e.Payment = order.StatusReason, paymentOf(order)
+	return e
+}
+
+// RiderAssigned names the rider who took the order.
+func RiderAssigned(order models.Order, rider Rider) Event {
+	e := newEvent(TypeRiderAssigned, order)
+	e.Rider = &rider
+	return e
+}
+
+// RiderLocation is the position of the rider carrying the order.
+func RiderLocation(order models.Order, at Location) Event {
+	e := newEvent(TypeRiderLocation, order)
+	e.Location = &at
+	return e
+}
+
+// Snapshot describes an order as it stands, numbered with its latest
+// sequence so that a client can resume from it.
+func Snapshot(order models.Order) Event {
+	e := newEvent(TypeSnapshot, order)
+	e.Seq, e.At = order.EventSeq, clock.Now().UTC()
+	e.Reason, e.Order, e.ETA, e.Payment = order.StatusReason, summaryOf(order), etaOf(order), paymentOf(order)
+	return e
+}
+
+func fromModel(stored models.OrderEvent) Event {
+	var e Event
+	if stored.Data != "" {
+		json.Unmarshal([]byte(stored.Data), &e)
+	}
+	e.V, e.Seq, e.Type, e.OrderID, e.Status, e.At = Version, stored.Seq, stored.Type, stored.OrderID, stored.Status, stored.CreatedAt
+	if e.Type == legacyTypeStatus {
+		e.Type = TypeStatusChanged
+	}
+	return e
+}
+
+// Store keeps order events in the database.
+type Store struct {
+	DB *gorm.DB
+}
+
+// Append stores e as the order's next event and returns it numbered and
+// timestamped. Bumping Order.EventSeq locks the order's row, so concurrent
+// events on one order get distinct, increasing numbers.
+func (s Store) Append(ctx context.Context, e Event) (Event, error) {
+	if e.Type == "" || e.OrderID == "" {
+		return e, ErrInvalidEvent
+	}
+	e.V, e.At = Version, clock.Now().UTC()
+	stored := models.OrderEvent{OrderID: e.OrderID, Type: e.Type, Status: e.Status, CreatedAt: e.At}
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Order{}).Where("id = ?", e.OrderID).
+			Update("event_seq", gorm.Expr("event_seq + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		var order models.Order
+		if err := tx.Select("event_seq").First(&order, "id = ?", e.OrderID).Error; err != nil {
+			return err
+		}
+		e.Seq, stored.Seq = order.EventSeq, order.EventSeq
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		stored.Data = string(data)
+		return tx.Create(&stored).Error
+	})
+	return e, err
+}
+
+// Since returns the order's events after seq, oldest first, up to
+// MaxReplay of them.
+func (s Store) Since(ctx context.Context, orderID string, seq int64) ([]Event, error) {
+	var stored []models.OrderEvent
+	if err := s.DB.WithContext(ctx).Where("order_id = ? AND seq > ?", orderID, seq).
+		Order("seq").Limit(MaxReplay).Find(&stored).Error; err != nil {
+		return nil, err
+	}
+	out := make([]Event, len(stored))
+	for i, e := range stored {
+		out[i] = fromModel(e)
+	}
+	return out, nil
+}
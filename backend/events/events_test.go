@@ -0,0 +1,119 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"order-mgmt-backend/database"
+	"order-mgmt-backend/models"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newStore(t *testing.T) Store {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	sqlDB, _ := db.DB()
+	// One connection keeps every goroutine on the same in-memory database.
+	sqlDB.SetMaxOpenConns(1)
+	assert.NoError(t, database.Migrate(db))
+	return Store{DB: db}
+}
+
+func TestAppendAndSince(t *testing.T) {
+	s := newStore(t)
+	ctx := context.Background()
+	order := models.NewOrder()
+	assert.NoError(t, s.DB.Create(order).Error)
+
+	for _, status := range []string{models.StatusPreparing, models.StatusOutForDelivery, models.StatusDelivered} {
+		_, err := s.Append(ctx, StatusChanged(models.Order{ID: order.ID, Status: status}, ""))
+		assert.NoError(t, err)
+	}
+	missed, err := s.Since(ctx, order.ID, 1)
+	assert.NoError(t, err)
+	assert.Len(t, missed, 2)
+	assert.Equal(t, int64(2), missed[0].Seq)
+	assert.Equal(t, Version, missed[0].V)
+	assert.Equal(t, models.StatusDelivered, missed[1].Status)
+
+	var stored models.Order
+	s.DB.First(&stored, "id = ?", order.ID)
+	assert.Equal(t, int64(3), stored.EventSeq)
+	assert.Equal(t, int64(3), Snapshot(stored).Seq)
+
+	_, err = s.Append(ctx, StatusChanged(models.Order{ID: "missing", Status: models.StatusPreparing}, ""))
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	_, err = s.Append(ctx, Event{OrderID: order.ID})
+	assert.ErrorIs(t, err, ErrInvalidEvent)
+}
+
+func TestEventsKeepTheirPayload(t *testing.T) {
+	s := newStore(t)
+	ctx := context.Background()
+	ready := time.Date(2026, 3, 5, 12, 20, 0, 0, time.UTC)
+	delivery := ready.Add(25 * time.Minute)
+	order := models.NewOrder()
+	order.TotalPrice = 450
+	order.PaymentStatus = models.PaymentCaptured
+	order.PaymentMethod = "card"
+	order.EstimatedReadyAt, order.EstimatedDeliveryAt = &ready, &delivery
+	order.OrderItems = []models.OrderItem{{ItemID: 1, Quantity: 2}, {ItemID: 2, Quantity: 1}}
+	assert.NoError(t, s.DB.Create(order).Error)
+
+	created, err := s.Append(ctx, Created(*order))
+	assert.NoError(t, err)
+	assert.Equal(t, &Summary{Total: 450, Items: 3}, created.Order)
+	order.Status, order.StatusReason = models.StatusCancelled, "Out of paneer"
+	order.RefundedAmount = 450
+	_, err = s.Append(ctx, Cancelled(*order))
+	assert.NoError(t, err)
+	_, err = s.Append(ctx, RiderAssigned(*order, Rider{ID: 7, Name: "Ravi"}))
+	assert.NoError(t, err)
+	// A version 1 status event, stored before events carried data.
+	assert.NoError(t, s.DB.Create(&models.OrderEvent{OrderID: order.ID, Seq: 4, Type: "order.status", Status: models.StatusPreparing}).Error)
+
+	all, err := s.Since(ctx, order.ID, 0)
+	assert.NoError(t, err)
+	if !assert.Len(t, all, 4) {
+		return
+	}
+	assert.Equal(t, TypeCreated, all[0].Type)
+	assert.Equal(t, 3, all[0].Order.Items)
+	assert.True(t, all[0].ETA.DeliveryAt.Equal(delivery))
+	assert.Equal(t, TypeCancelled, all[1].Type)
+	assert.Equal(t, "Out of paneer", all[1].Reason)
+	assert.Equal(t, &Payment{Status: models.PaymentCaptured, Method: "card", Amount: 450, Refunded: 450}, all[1].Payment)
+	assert.Equal(t, "Ravi", all[2].Rider.Name)
+	assert.Equal(t, TypeStatusChanged, all[3].Type)
+	assert.Equal(t, Version, all[3].V)
+}
+
+func TestConcurrentAppendsGetDistinctSeqs(t *testing.T) {
+	s := newStore(t)
+	ctx := context.Background()
+	order := models.NewOrder()
+	assert.NoError(t, s.DB.Create(order).Error)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := s.Append(ctx, StatusChanged(models.Order{ID: order.ID, Status: fmt.Sprint(i)}, ""))
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	all, err := s.Since(ctx, order.ID, 0)
+	assert.NoError(t, err)
+	assert.Len(t, all, 20)
+	for i, e := range all {
+		assert.Equal(t, int64(i+1), e.Seq)
+	}
+}
@@ -0,0 +1,28 @@
+package geo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDistanceKm(t *testing.T) {
+	bengaluru := Point{Lat: 12.9716, Lng: 77.5946}
+	chennai := Point{Lat: 13.0827, Lng: 80.2707}
+
+	assert.InDelta(t, 290.2, DistanceKm(bengaluru, chennai), 1)
+	assert.InDelta(t, DistanceKm(bengaluru, chennai), DistanceKm(chennai, bengaluru), 1e-9)
+	assert.Zero(t, DistanceKm(bengaluru, bengaluru))
+}
+
+func TestPointValid(t *testing.T) {
+	assert.True(t, Point{Lat: 12.97, Lng: 77.59}.Valid())
+	assert.False(t, Point{Lat: 91, Lng: 0}.Valid())
+	assert.False(t, Point{Lat: 0, Lng: -181}.Valid())
+}
+
+func TestTravelTime(t *testing.T) {
+	assert.Equal(t, 15*time.Minute, TravelTime(5, 20))
+	assert.Zero(t, TravelTime(5, 0))
+}
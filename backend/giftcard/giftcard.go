@@ -0,0 +1,299 @@
+// Package giftcard issues prepaid gift cards and moves money on and off
+// them. A code is only ever seen when its card is issued; the database keeps
+// a hash, so a leaked table cannot be spent.
+package giftcard
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math"
+	"math/big"
+	"order-mgmt-backend/clock"
+	"order-mgmt-backend/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	KindIssue  = "issue"
+	KindRedeem = "redeem"
+	KindRefund = "refund"
+	KindVoid   = "void"
+)
+
+var (
+	ErrNotFound       = errors.New("gift card not found")
+	ErrVoid           = errors.New("gift card has been voided")
+	ErrExpired        = errors.New("gift card has expired")
+	ErrInsufficient   = errors.New("gift card balance is too low")
+	ErrInvalidAmount  = errors.New("amount must be positive")
+	ErrReferenceReuse = errors.New("reference was already used for a different movement")
+)
+
+// Codes are 16 characters from an alphabet without look-alikes (0/O, 1/I),
+// which is 80 bits of randomness, printed in groups of four.
+const (
+	alphabet   = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	codeLength = 16
+)
+
+// NewCode returns a random gift card code.
+func NewCode() (string, error) {
+	var b strings.Builder
+	max := big.NewInt(int64(len(alphabet)))
+	for i := 0; i < codeLength; i++ {
+		if i > 0 && i%4 == 0 {
+			b.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(alphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+// Normalize strips the spacing and dashes customers type codes with.
+func Normalize(code string) string {
+	code = strings.ToUpper(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
+
+// Hash is what is stored and looked up in place of a code.
+func Hash(code string) string {
+	sum := sha256.Sum256([]byte(Normalize(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+func paise(v float64) int64 {
+	return int64(math.Round(v * 100))
+}
+
+func rupees(p int64) float64 {
+	return float64(p) / 100
+}
+
+// Issue describes a new card.
+type Issue struct {
+	Amount    float64
+	Reference string
+	Reason    string
+	ExpiresAt *time.Time
+}
+
+// Store keeps gift cards in the database. Every balance change locks the
+// card's row, so two orders spending one card are applied one at a time.
+type Store struct {
+	DB *gorm.DB
+}
+
+// Issue creates a card and returns it with its code. Replaying a reference
+// returns the original card with created false and no code, since the code
+// is not stored.
+func (s Store) Issue(ctx context.Context, in Issue) (card models.GiftCard, code string, created bool, err error) {
+	if paise(in.Amount) <= 0 {
+		return card, "", false, ErrInvalidAmount
+	}
+	err = s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("reference = ?", in.Reference).First(&card).Error
+		if err == nil {
+			if paise(card.InitialValue) != paise(in.Amount) {
+				return ErrReferenceReuse
+			}
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if code, err = NewCode(); err != nil {
+			return err
+		}
+		normalized := Normalize(code)
+		card = models.GiftCard{
+			CodeHash:     Hash(code),
+			Last4:        normalized[len(normalized)-4:],
+			InitialValue: rupees(paise(in.Amount)),
+			Balance:      rupees(paise(in.Amount)),
+			Status:       models.GiftCardActive,
+			Reference:    in.Reference,
+			Reason:       in.Reason,
+		}
+		if in.ExpiresAt != nil {
+			at := in.ExpiresAt.UTC()
+			card.ExpiresAt = &at
+		}
+		if err := tx.Create(&card).Error; err != nil {
+			return err
+		}
+		created = true
+		return tx.Create(&models.GiftCardTransaction{
+			GiftCardID:   card.ID,
+			Kind:         KindIssue,
+			Amount:       card.Balance,
+			BalanceAfter: card.Balance,
+			Reference:    "issue:" + in.Reference,
+		}).Error
+	})
+	if !created {
+		code = ""
+	}
+	return card, code, created, err
+}
+
+// Lookup finds the card with code and its history.
+func (s Store) Lookup(ctx context.Context, code string) (models.GiftCard, error) {
+	var card models.GiftCard
+	err := s.DB.WithContext(ctx).Preload("Transactions", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Where("code_hash = ?", Hash(code)).First(&card).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return card, ErrNotFound
+	}
+	return card, err
+}
+
+// Get loads a card and its history by id.
+func (s Store) Get(ctx context.Context, id uint) (models.GiftCard, error) {
+	var card models.GiftCard
+	err := s.DB.WithContext(ctx).Preload("Transactions", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		First(&card, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return card, ErrNotFound
+	}
+	return card, err
+}
+
+// Usable reports why a card cannot be spent, if it cannot.
+func Usable(card models.GiftCard, now time.Time) error {
+	if card.Status == models.GiftCardVoid {
+		return ErrVoid
+	}
+	if card.ExpiresAt != nil && !card.ExpiresAt.After(now) {
+		return ErrExpired
+	}
+	return nil
+}
+
+// Redeem spends amount of the card on an order.
+func (s Store) Redeem(ctx context.Context, cardID uint, amount float64, orderID, ref string) (models.GiftCardTransaction, error) {
+	return s.move(ctx, cardID, KindRedeem, amount, orderID, ref)
+}
+
+// Refund puts amount back on the card it was spent from, even once the
+// card has expired or been voided.
+func (s Store) Refund(ctx context.Context, cardID uint, amount float64, orderID, ref string) (models.GiftCardTransaction, error) {
+	return s.move(ctx, cardID, KindRefund, amount, orderID, ref)
+}
+
+// Void stops a card from being spent. The remaining balance is written off
+// and kept on the void movement for the record. Voiding twice is a no-op.
+func (s Store) Void(ctx context.Context, cardID uint, reason string) (models.GiftCard, error) {
+	var card models.GiftCard
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if card, err = lockCard(tx, cardID); err != nil {
+			return err
+		}
+		if card.Status == models.GiftCardVoid {
+			return nil
+		}
+		now := clock.Now().UTC()
+		remaining := card.Balance
+		card.Status = models.GiftCardVoid
+		card.VoidedAt = &now
+		card.VoidReason = reason
+		card.Balance = 0
+		if err := tx.Model(&card).Updates(map[string]interface{}{
+			"status":      card.Status,
+			"voided_at":   card.VoidedAt,
+			"void_reason": card.VoidReason,
+			"balance":     0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.GiftCardTransaction{
+			GiftCardID: card.ID,
+			Kind:       KindVoid,
+			Amount:     remaining,
+			Reference:  "void:" + card.Reference,
+		}).Error
+	})
+	return card, err
+}
+
+// move applies one balance change. Replaying a reference returns the
+// original movement without applying it again.
+func (s Store) move(ctx context.Context, cardID uint, kind string, amount float64, orderID, ref string) (models.GiftCardTransaction, error) {
+	txn := models.GiftCardTransaction{
+		GiftCardID: cardID,
+		OrderID:    orderID,
+		Kind:       kind,
+		Amount:     rupees(paise(amount)),
+		Reference:  ref,
+	}
+	if paise(amount) <= 0 {
+		return txn, ErrInvalidAmount
+	}
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		card, err := lockCard(tx, cardID)
+		if err != nil {
+			return err
+		}
+		var existing models.GiftCardTransaction
+		err = tx.Where("reference = ?", ref).First(&existing).Error
+		if err == nil {
+			if existing.GiftCardID != cardID || existing.Kind != kind || paise(existing.Amount) != paise(amount) {
+				return ErrReferenceReuse
+			}
+			txn = existing
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		// Refunds land even on an expired or voided card so the money for
+		// a cancelled order is never stuck in a failed refund.
+		if kind == KindRedeem {
+			if err := Usable(card, clock.Now()); err != nil {
+				return err
+			}
+		}
+		balance := paise(card.Balance)
+		if kind == KindRedeem {
+			if balance < paise(amount) {
+				return ErrInsufficient
+			}
+			balance -= paise(amount)
+		} else {
+			balance += paise(amount)
+		}
+		txn.BalanceAfter = rupees(balance)
+		if err := tx.Model(&card).Update("balance", txn.BalanceAfter).Error; err != nil {
+			return err
+		}
+		return tx.Create(&txn).Error
+	})
+	return txn, err
+}
+
+func lockCard(tx *gorm.DB, cardID uint) (models.GiftCard, error) {
+	var card models.GiftCard
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&card, cardID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return card, ErrNotFound
+	}
+	return card, err
+}
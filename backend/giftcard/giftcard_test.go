@@ -0,0 +1,138 @@
+package giftcard
+
+import (
+	"context"
+	"fmt"
+	"order-mgmt-backend/clock"
+	"order-mgmt-backend/database"
+	"order-mgmt-backend/models"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newStore(t *testing.T) Store {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	sqlDB, _ := db.DB()
+	// One connection keeps every goroutine on the same in-memory database.
+	sqlDB.SetMaxOpenConns(1)
+	assert.NoError(t, database.Migrate(db))
+	return Store{DB: db}
+}
+
+func TestCodes(t *testing.T) {
+	code, err := NewCode()
+	assert.NoError(t, err)
+	assert.Len(t, code, 19)
+	assert.Regexp(t, `^[A-HJ-NP-Z2-9]{4}(-[A-HJ-NP-Z2-9]{4}){3}$`, code)
+
+	other, _ := NewCode()
+	assert.NotEqual(t, code, other)
+	assert.Equal(t, Hash(code), Hash(" "+Normalize(code)[:8]+" "+Normalize(code)[8:]))
+}
+
+func TestIssueRedeemAndRefund(t *testing.T) {
+	s := newStore(t)
+	ctx := context.Background()
+
+	card, code, created, err := s.Issue(ctx, Issue{Amount: 500, Reference: "sale-1"})
+	assert.NoError(t, err)
+	assert.True(t, created)
+	assert.NotEmpty(t, code)
+	assert.Equal(t, Normalize(code)[12:], card.Last4)
+
+	again, replayCode, created, err := s.Issue(ctx, Issue{Amount: 500, Reference: "sale-1"})
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.Empty(t, replayCode)
+	assert.Equal(t, card.ID, again.ID)
+	_, _, _, err = s.Issue(ctx, Issue{Amount: 100, Reference: "sale-1"})
+	assert.ErrorIs(t, err, ErrReferenceReuse)
+
+	_, err = s.Redeem(ctx, card.ID, 120.5, "a", "order:a")
+	assert.NoError(t, err)
+	_, err = s.Redeem(ctx, card.ID, 120.5, "a", "order:a")
+	assert.NoError(t, err)
+	txn, err := s.Redeem(ctx, card.ID, 300, "b", "order:b")
+	assert.NoError(t, err)
+	assert.Equal(t, 79.5, txn.BalanceAfter)
+	_, err = s.Redeem(ctx, card.ID, 80, "c", "order:c")
+	assert.ErrorIs(t, err, ErrInsufficient)
+
+	_, err = s.Refund(ctx, card.ID, 20, "b", "refund:1")
+	assert.NoError(t, err)
+
+	found, err := s.Lookup(ctx, code)
+	assert.NoError(t, err)
+	assert.Equal(t, 99.5, found.Balance)
+	assert.Len(t, found.Transactions, 4)
+	_, err = s.Lookup(ctx, "AAAA-AAAA-AAAA-AAAA")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestVoidAndExpiry(t *testing.T) {
+	s := newStore(t)
+	ctx := context.Background()
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	clock.Now = func() time.Time { return start }
+	t.Cleanup(func() { clock.Now = time.Now })
+
+	expires := start.Add(24 * time.Hour)
+	card, _, _, err := s.Issue(ctx, Issue{Amount: 100, Reference: "promo", ExpiresAt: &expires})
+	assert.NoError(t, err)
+	clock.Now = func() time.Time { return expires }
+	_, err = s.Redeem(ctx, card.ID, 10, "a", "order:a")
+	assert.ErrorIs(t, err, ErrExpired)
+	refund, err := s.Refund(ctx, card.ID, 10, "a", "refund:a")
+	assert.NoError(t, err)
+	assert.Equal(t, 110.0, refund.BalanceAfter)
+
+	card, _, _, _ = s.Issue(ctx, Issue{Amount: 100, Reference: "lost"})
+	voided, err := s.Void(ctx, card.ID, "Reported stolen")
+	assert.NoError(t, err)
+	assert.Equal(t, models.GiftCardVoid, voided.Status)
+	assert.Equal(t, 0.0, voided.Balance)
+	_, err = s.Void(ctx, card.ID, "Again")
+	assert.NoError(t, err)
+	_, err = s.Redeem(ctx, card.ID, 10, "b", "order:b")
+	assert.ErrorIs(t, err, ErrVoid)
+	_, err = s.Refund(ctx, card.ID, 10, "b", "refund:b")
+	assert.NoError(t, err)
+
+	stored, _ := s.Get(ctx, card.ID)
+	assert.Len(t, stored.Transactions, 3)
+	assert.Equal(t, 100.0, stored.Transactions[1].Amount)
+}
+
+func TestConcurrentRedemptionNeverOverspends(t *testing.T) {
+	s := newStore(t)
+	ctx := context.Background()
+	card, _, _, err := s.Issue(ctx, Issue{Amount: 100, Reference: "shared"})
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := s.Redeem(ctx, card.ID, 30, "", fmt.Sprintf("order:%d", i))
+			if err == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, 3, succeeded)
+	stored, _ := s.Get(ctx, card.ID)
+	assert.Equal(t, 10.0, stored.Balance)
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"order-mgmt-backend/clock"
+	"order-mgmt-backend/database"
+	"order-mgmt-backend/models"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireAdmin only lets through requests whose X-Admin-Key header matches
+// ADMIN_API_KEY. Admin routes are disabled while the variable is unset. The
+// key is never taken from the URL, where it would end up in logs; browser
+// clients such as kitchen displays use tokens instead.
+func RequireAdmin(c *gin.Context) {
+	if !hasAdminKey(c) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Admin access required"})
+		return
+	}
+	c.Next()
+}
+
+func hasAdminKey(c *gin.Context) bool {
+	key := os.Getenv("ADMIN_API_KEY")
+	given := c.GetHeader("X-Admin-Key")
+	return key != "" && subtle.ConstantTimeCompare([]byte(key), []byte(given)) == 1
+}
+
+func PauseOrdering(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	var req models.PauseOrderingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.OutletID != nil {
+		var outlet models.Outlet
+		if err := database.DB.First(&outlet, *req.OutletID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Outlet not found"})
+			return
+		}
+	}
+
+	pause := models.OrderingPause{
+		OutletID: req.OutletID,
+		Until:    clock.Now().UTC().Add(time.Duration(req.Minutes) * time.Minute),
+		Reason:   req.Reason,
+	}
+	if err := database.DB.Create(&pause).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pause ordering"})
+		return
+	}
+	c.JSON(http.StatusCreated, pause)
+}
+
+func ResumeOrdering(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	now := clock.Now().UTC()
+	query := database.DB.Model(&models.OrderingPause{}).Where("until > ?", now)
+	if outletID := c.Query("outlet_id"); outletID != "" {
+		query = query.Where("outlet_id = ?", outletID)
+	} else {
+		query = query.Where("outlet_id IS NULL")
+	}
+	result := query.Update("until", now)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resume ordering"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"resumed": result.RowsAffected})
+}
+
+// AddHoliday closes an outlet for a whole day. Customers see the outlet
+// closed on the menu and orders are refused until it reopens.
+func AddHoliday(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	var req models.AddHolidayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := time.Parse("2006-01-02", req.Date); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date must be YYYY-MM-DD"})
+		return
+	}
+	var outlet models.Outlet
+	if err := database.DB.First(&outlet, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Outlet not found"})
+		return
+	}
+	var taken int64
+	if err := database.DB.Model(&models.OutletHoliday{}).Where("outlet_id = ? AND date = ?", outlet.ID, req.Date).Count(&taken).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add holiday"})
+		return
+	}
+	if taken > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "The outlet is already closed that day"})
+		return
+	}
+
+	holiday := models.OutletHoliday{OutletID: outlet.ID, Date: req.Date, Reason: req.Reason}
+	if err := database.DB.Create(&holiday).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add holiday"})
+		return
+	}
+	c.JSON(http.StatusCreated, holiday)
+}
+
+// RemoveHoliday opens an outlet again on a day it was to be closed.
+func RemoveHoliday(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	result := database.DB.Where("id = ? AND outlet_id = ?", c.Param("holiday"), c.Param("id")).Delete(&models.OutletHoliday{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove holiday"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Holiday not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"removed": result.RowsAffected})
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"errors"
+	"log"
+	"net/http"
+	"order-mgmt-backend/auth"
+	"order-mgmt-backend/clock"
+	"order-mgmt-backend/database"
+	"order-mgmt-backend/models"
+	"order-mgmt-backend/websocket"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	userTokenTTL  = 24 * time.Hour
+	orderTokenTTL = 48 * time.Hour
+)
+
+var errUnknownTopic = errors.New("unknown topic")
+
+// tokenSecret signs customer tokens. Without AUTH_TOKEN_SECRET a random
+// secret is made at start, so tokens stop working on restart and are not
+// accepted by other instances.
+var tokenSecret = loadTokenSecret()
+
+func loadTokenSecret() []byte {
+	if secret := os.Getenv("AUTH_TOKEN_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	log.Println("WARNING: AUTH_TOKEN_SECRET is not set, tokens will not outlive this process")
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	return secret
+}
+
+func userToken(userID uint) string {
+	return auth.Sign(tokenSecret, auth.Claims{UserID: userID}, clock.Now().Add(userTokenTTL))
+}
+
+// trackingToken lets whoever placed an order follow it, signed in or not.
+func trackingToken(orderID string) string {
+	return auth.Sign(tokenSecret, auth.Claims{OrderID: orderID}, clock.Now().Add(orderTokenTTL))
+}
+
+// viewer is who is asking to follow live updates: an admin, or the holder
+// of a customer token.
+type viewer struct {
+	admin  bool
+	claims auth.Claims
+}
+
+// requestToken is the token sent as a bearer token or, since browsers
+// cannot set headers on WebSockets and EventSource, as the token query
+// parameter.
+func requestToken(c *gin.Context) string {
+	if token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "); token != "" {
+		return token
+	}
+	return c.Query("token")
+}
+
+// requestViewer authenticates a streaming request from the admin key or a
+// token.
+func requestViewer(c *gin.Context) (viewer, bool) {
+	if hasAdminKey(c) {
+		return viewer{admin: true}, true
+	}
+	claims, err := auth.Verify(tokenSecret, requestToken(c), clock.Now())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "A valid token is required"})
+		return viewer{}, false
+	}
+	return viewer{claims: claims}, true
+}
+
+// requestUser is the signed-in customer placing a request, from their
+// token, or 0 when no token was sent. Any other token is answered with 401
+// and false.
+func requestUser(c *gin.Context) (uint, bool) {
+	token := requestToken(c)
+	if token == "" {
+		return 0, true
+	}
+	claims, err := auth.Verify(tokenSecret, token, clock.Now())
+	if err != nil || claims.UserID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "A valid customer token is required"})
+		return 0, false
+	}
+	return claims.UserID, true
+}
+
+// ownsOrder reports whether v is the order's tracking token or the customer
+// who placed it.
+func (v viewer) ownsOrder(orderID string) bool {
+	if v.claims.OrderID != "" && v.claims.OrderID == orderID {
+		return true
+	}
+	if v.claims.UserID == 0 {
+		return false
+	}
+	var order models.Order
+	err := database.DB.Select("user_id").First(&order, "id = ?", orderID).Error
+	return err == nil && order.UserID != nil && *order.UserID == v.claims.UserID
+}
+
+// canFollowOrder allows admins, the order's tracking token, the customer
+// who owns it and the rider carrying it. Unknown orders are forbidden rather than not found, so that
+// order ids cannot be probed.
+func (v viewer) canFollowOrder(orderID string) error {
+	if v.admin || v.ownsOrder(orderID) {
+		return nil
+	}
+	if v.claims.RiderID != 0 {
+		var order models.Order
+		if err := database.DB.Select("rider_id").First(&order, "id = ?", orderID).Error; err == nil &&
+			order.RiderID != nil && *order.RiderID == v.claims.RiderID {
+			return nil
+		}
+	}
+	return websocket.ErrForbidden
+}
+
+// followOrder answers with 401 or 403 and false unless the request may
+// follow the order in the :id param; see canFollowOrder.
+func followOrder(c *gin.Context) bool {
+	v, ok := requestViewer(c)
+	if !ok {
+		return false
+	}
+	if err := v.canFollowOrder(c.Param("id")); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// authorize maps a client topic to its hub topic if v may follow it:
+// "order:<id>", "user:<id>" for all of a customer's orders, "rider:<id>"
+// for the orders offered to a rider, or "kitchen:<outlet id>" for admins
+// and that outlet's kitchen display.
+func (v viewer) authorize(topic string) (string, error) {
+	kind, id, _ := strings.Cut(topic, ":")
+	if id == "" {
+		return "", errUnknownTopic
+	}
+	switch kind {
+	case "order":
+		return id, v.canFollowOrder(id)
+	case "user":
+		if v.admin || (v.claims.UserID != 0 && strconv.FormatUint(uint64(v.claims.UserID), 10) == id) {
+			return websocket.UserTopic(id), nil
+		}
+		return "", websocket.ErrForbidden
+	case "rider":
+		if v.admin || (v.claims.RiderID != 0 && strconv.FormatUint(uint64(v.claims.RiderID), 10) == id) {
+			return websocket.RiderTopic(id), nil
+		}
+		return "", websocket.ErrForbidden
+	case "kitchen":
+		if v.admin || (v.claims.OutletID != 0 && strconv.FormatUint(uint64(v.claims.OutletID), 10) == id) {
+			return websocket.KitchenTopic(id), nil
+		}
+		return "", websocket.ErrForbidden
+	}
+	return "", errUnknownTopic
+}
+
+// StreamWS opens a WebSocket that follows any topics the caller may see,
+// subscribed to over the socket.
+func StreamWS(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	v, ok := requestViewer(c)
+	if !ok {
+		return
+	}
+	websocket.GlobalHub.ServeMux(c.Writer, c.Request, v.authorize)
+}
+
+// OrderStatusWS follows a single order, for clients of the original
+// one-order socket.
+func OrderStatusWS(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	v, ok := requestViewer(c)
+	if !ok {
+		return
+	}
+	if err := v.canFollowOrder(c.Query("orderId")); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	websocket.GlobalHub.HandleWS(c.Writer, c.Request)
+}
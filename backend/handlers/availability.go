@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"order-mgmt-backend/database"
+	"order-mgmt-backend/models"
+	"order-mgmt-backend/schedule"
+	"time"
+)
+
+// menuWindows groups the schedule windows that apply to each item, either
+// directly or through the item's category.
+type menuWindows struct {
+	byItem     map[uint][]schedule.Window
+	byCategory map[string][]schedule.Window
+}
+
+func loadMenuWindows() (menuWindows, error) {
+	var schedules []models.MenuSchedule
+	if err := database.DB.Find(&schedules).Error; err != nil {
+		return menuWindows{}, err
+	}
+	mw := menuWindows{
+		byItem:     make(map[uint][]schedule.Window),
+		byCategory: make(map[string][]schedule.Window),
+	}
+	for _, s := range schedules {
+		w := schedule.Window{Days: s.Days, Start: s.StartTime, End: s.EndTime}
+		if s.ItemID != nil {
+			mw.byItem[*s.ItemID] = append(mw.byItem[*s.ItemID], w)
+		}
+		if s.Category != "" {
+			mw.byCategory[s.Category] = append(mw.byCategory[s.Category], w)
+		}
+	}
+	return mw, nil
+}
+
+func (mw menuWindows) forItem(item models.Item) []schedule.Window {
+	windows := mw.byItem[item.ID]
+	if item.Category != "" {
+		windows = append(windows[:len(windows):len(windows)], mw.byCategory[item.Category]...)
+	}
+	return windows
+}
+
+// menuItem annotates item with its availability at now. Items without any
+// schedule are always available.
+func (mw menuWindows) menuItem(item models.Item, now time.Time, loc *time.Location) models.MenuItem {
+	mi := models.MenuItem{Item: item, Available: true}
+	windows := mw.forItem(item)
+	if len(windows) == 0 || schedule.Open(windows, now, loc) {
+		return mi
+	}
+	mi.Available = false
+	if next, ok := schedule.NextOpen(windows, now, loc); ok {
+		mi.AvailableFrom = schedule.Label(next, now, loc)
+		mi.NextAvailableAt = &next
+	}
+	return mi
+}
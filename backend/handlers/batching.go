@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"log"
+	"order-mgmt-backend/batching"
+	"order-mgmt-backend/database"
+	"order-mgmt-backend/geo"
+	"order-mgmt-backend/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// batchConfig sets which ready orders may share a rider's run; see
+// batching.FromEnv.
+var batchConfig = loadBatchConfig()
+
+func loadBatchConfig() batching.Config {
+	c, err := batching.FromEnv()
+	if err != nil {
+		log.Printf("WARNING: %v, using the default batching settings", err)
+	}
+	return c
+}
+
+// batchOrder is what batching knows of an order, or false for an order
+// with no drop-off, which always goes on its own.
+func batchOrder(o models.Order) (batching.Order, bool) {
+	if o.DeliveryLat == nil || o.DeliveryLng == nil {
+		return batching.Order{}, false
+	}
+	b := batching.Order{ID: o.ID, Drop: geo.Point{Lat: *o.DeliveryLat, Lng: *o.DeliveryLng}}
+	if o.EstimatedDeliveryAt != nil {
+		b.DueAt = *o.EstimatedDeliveryAt
+	}
+	return b, true
+}
+
+// departure is when r can leave pickup: now if their position is unknown,
+// else once they have ridden there.
+func departure(r models.Rider, pickup geo.Point, now time.Time) time.Time {
+	if r.Lat == nil || r.Lng == nil {
+		return now
+	}
+	km := geo.DistanceKm(geo.Point{Lat: *r.Lat, Lng: *r.Lng}, pickup)
+	return now.Add(geo.TravelTime(km, batchConfig.SpeedKmh))
+}
+
+// openRun is a rider's run that has not left the outlet yet, planned with
+// one more order in it.
+type openRun struct {
+	rider   models.Rider
+	batchID string
+	orders  []models.Order // already in the run
+	plan    batching.Run
+	addedKm float64
+}
+
+// findRun looks among riders, locked in tx, for one whose run from the
+// order's outlet has not left yet and has room for the order, and plans
+// the run with it. The run that grows least wins, then the lower rider ID.
+// A rider carrying anything else is passed over, so that a run is only
+// joined while every order in it is waiting at the outlet.
+func findRun(tx *gorm.DB, order *models.Order, pickup *geo.Point, riders []models.Rider, loads map[uint]int, now time.Time) (*openRun, error) {
+	next, ok := batchOrder(*order)
+	if !ok || pickup == nil || order.OutletID == nil || batchConfig.MaxOrders < 2 || len(riders) == 0 {
+		return nil, nil
+	}
+	ids := make([]uint, len(riders))
+	for i, r := range riders {
+		ids[i] = r.ID
+	}
+	var waiting []models.Order
+	if err := tx.Where("rider_id IN ? AND outlet_id = ? AND status = ? AND batch_id <> ''", ids, *order.OutletID, models.StatusReady).
+		Order("batch_stop").Find(&waiting).Error; err != nil {
+		return nil, err
+	}
+	byRider := make(map[uint][]models.Order)
+	for _, o := range waiting {
+		byRider[*o.RiderID] = append(byRider[*o.RiderID], o)
+	}
+
+	var best *openRun
+	for _, r := range riders {
+		run := byRider[r.ID]
+		if len(run) == 0 || len(run) != loads[r.ID] || !dispatchRider(r, loads[r.ID]).Free() {
+			continue
+		}
+		// Orders in the run were held to their promised time when they
+		// joined, and their estimate since is the run's own, so only the
+		// detour limit applies to them now.
+		orders := make([]batching.Order, 0, len(run)+1)
+		for _, o := range run {
+			b, ok := batchOrder(o)
+			if !ok || o.BatchID != run[0].BatchID {
+				orders = nil
+				break
+			}
+			b.DueAt = time.Time{}
+			orders = append(orders, b)
+		}
+		if orders == nil {
+			continue
+		}
+		depart := departure(r, *pickup, now)
+		plan, fits := batchConfig.Plan(*pickup, append(orders, next), depart)
+		if !fits {
+			continue
+		}
+		added := plan.DistanceKm
+		if before, ok := batchConfig.Plan(*pickup, orders, depart); ok {
+			added -= before.DistanceKm
+		}
+		if best == nil || added < best.addedKm {
+			best = &openRun{rider: r, batchID: run[0].BatchID, orders: run, plan: plan, addedKm: added}
+		}
+	}
+	return best, nil
+}
+
+// apply numbers the run's stops in tx and sets each order's delivery
+// estimate from the plan. order is the one joining. The orders whose
+// estimate moved are returned, for their customers to hear.
+func (r *openRun) apply(tx *gorm.DB, order *models.Order) ([]models.Order, error) {
+	byID := map[string]*models.Order{order.ID: order}
+	for i := range r.orders {
+		byID[r.orders[i].ID] = &r.orders[i]
+	}
+	var moved []models.Order
+	for i, stop := range r.plan.Stops {
+		o := byID[stop.ID]
+		eta := r.plan.Arrivals[i]
+		if err := tx.Model(&models.Order{}).Where("id = ?", o.ID).
+			Updates(map[string]interface{}{"batch_stop": i + 1, "estimated_delivery_at": eta}).Error; err != nil {
+			return nil, err
+		}
+		changed := trackingConfig.Moved(o.EstimatedDeliveryAt, eta)
+		o.BatchStop, o.EstimatedDeliveryAt = i+1, &eta
+		if changed {
+			moved = append(moved, *o)
+		}
+	}
+	return moved, nil
+}
+
+// dropsUntil is the drop-offs the rider carrying order still has to make,
+// in run order, up to and including the order's own.
+func dropsUntil(order *models.Order) ([]geo.Point, error) {
+	drop := geo.Point{Lat: *order.DeliveryLat, Lng: *order.DeliveryLng}
+	if order.BatchID == "" {
+		return []geo.Point{drop}, nil
+	}
+	var before []models.Order
+	if err := database.DB.Select("delivery_lat", "delivery_lng").
+		Where("batch_id = ? AND status = ? AND batch_stop < ? AND id <> ?", order.BatchID, models.StatusOutForDelivery, order.BatchStop, order.ID).
+		Order("batch_stop").Find(&before).Error; err != nil {
+		return nil, err
+	}
+	drops := make([]geo.Point, 0, len(before)+1)
+	for _, o := range before {
+		if o.DeliveryLat != nil && o.DeliveryLng != nil {
+			drops = append(drops, geo.Point{Lat: *o.DeliveryLat, Lng: *o.DeliveryLng})
+		}
+	}
+	return append(drops, drop), nil
+}
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"order-mgmt-backend/database"
+	"order-mgmt-backend/models"
+	"order-mgmt-backend/storage"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxCodeTries is how many codes a rider may try for an order before
+	// they must fall back to a proof of delivery.
+	maxCodeTries  = 5
+	maxProofBytes = 5 << 20
+
+	codeWrongDeliveryCode    = "WRONG_DELIVERY_CODE"
+	codeDeliveryCodeLocked   = "DELIVERY_CODE_LOCKED"
+	codeDeliveryCodeFirst    = "DELIVERY_CODE_FIRST"
+	codeDeliveryConfirmation = "DELIVERY_CONFIRMATION_REQUIRED"
+	codeRiderPickup          = "RIDER_PICKUP_REQUIRED"
+)
+
+// proofTypes are the image types accepted as proof of delivery, with the
+// extension they are stored under. SVG is left out, since it can carry
+// scripts to the admin who opens it.
+var proofTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// newDeliveryCode draws a random 4-digit code.
+func newDeliveryCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(10000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%04d", n.Int64()), nil
+}
+
+// GetDeliveryCode shows the customer the code to give the rider at the
+// door. Only the order's tracking token or the customer who placed it may
+// see it; the rider and admins may not.
+func GetDeliveryCode(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	orderID := c.Param("id")
+	v, ok := requestViewer(c)
+	if !ok {
+		return
+	}
+	if !v.ownsOrder(orderID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the customer can see the delivery code"})
+		return
+	}
+	var order models.Order
+	if err := database.DB.Select("status", "delivery_code").First(&order, "id = ?", orderID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if order.Status != models.StatusOutForDelivery || order.DeliveryCode == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "The delivery code is given once the rider picks up the order"})
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"code": order.DeliveryCode})
+}
+
+// DeliverOrder completes a delivery with the code the customer read out.
+// Every try counts against maxCodeTries, counted before the code is
+// compared so that concurrent guesses cannot go over it.
+func DeliverOrder(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	order, ok := acceptedOrder(c, models.StatusOutForDelivery, models.StatusDelivered)
+	if !ok {
+		return
+	}
+	var req models.DeliverOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	result := database.DB.Model(&models.Order{}).
+		Where("id = ? AND delivery_code_tries < ?", order.ID, maxCodeTries).
+		Update("delivery_code_tries", gorm.Expr("delivery_code_tries + 1"))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Too many wrong codes, upload a photo or signature instead", "code": codeDeliveryCodeLocked})
+		return
+	}
+	if order.DeliveryCode == "" || subtle.ConstantTimeCompare([]byte(req.Code), []byte(order.DeliveryCode)) != 1 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":      "Wrong delivery code",
+			"code":       codeWrongDeliveryCode,
+			"tries_left": maxCodeTries - order.DeliveryCodeTries - 1,
+		})
+		return
+	}
+	if !advanceOrder(c, &order, models.StatusOutForDelivery, models.StatusDelivered, func(tx *gorm.DB, order *models.Order, now time.Time) error {
+		order.DeliveredAt, order.DeliveredWith = &now, models.DeliveredWithCode
+		return nil
+	}) {
+		return
+	}
+	c.JSON(http.StatusOK, order)
+}
+
+// SubmitDeliveryProof completes a delivery without the code, on a photo of
+// the order at the door or the customer's signature. It is only a fallback,
+// taken once the rider has used up their tries at the code. It takes a
+// multipart form with kind, photo or signature, and the image as file.
+func SubmitDeliveryProof(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxProofBytes)
+	order, ok := acceptedOrder(c, models.StatusOutForDelivery, models.StatusDelivered)
+	if !ok {
+		return
+	}
+	if order.DeliveryCodeTries < maxCodeTries {
+		c.JSON(http.StatusConflict, gin.H{"error": "Ask the customer for their delivery code first", "code": codeDeliveryCodeFirst})
+		return
+	}
+	if err := c.Request.ParseMultipartForm(maxProofBytes); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Proof must be at most 5 MB"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Send the proof as a multipart form"})
+		return
+	}
+	kind := c.PostForm("kind")
+	if kind != models.DeliveredWithPhoto && kind != models.DeliveredWithSignature {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be photo or signature"})
+		return
+	}
+	file, _, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A file is required"})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	contentType := http.DetectContentType(data)
+	ext, ok := proofTypes[contentType]
+	if !ok {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Proof must be a JPEG, PNG or WebP image"})
+		return
+	}
+
+	proof := models.DeliveryProof{OrderID: order.ID, RiderID: currentRider(c), Kind: kind, ContentType: contentType, Size: len(data)}
+	if !advanceOrder(c, &order, models.StatusOutForDelivery, models.StatusDelivered, func(tx *gorm.DB, order *models.Order, now time.Time) error {
+		proof.Key = fmt.Sprintf("proofs/%s/%s-%d%s", order.ID, kind, now.UnixNano(), ext)
+		if err := storage.Default.Put(c.Request.Context(), proof.Key, storage.Object{ContentType: contentType, Data: data}); err != nil {
+			return err
+		}
+		order.DeliveredAt, order.DeliveredWith = &now, kind
+		return tx.Create(&proof).Error
+	}) {
+		return
+	}
+	c.JSON(http.StatusOK, order)
+}
+
+// OverrideDelivery lets an admin mark an order out for delivery as
+// delivered when the rider can confirm it neither way. Who did it and why
+// is kept with the order.
+func OverrideDelivery(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	var req models.OverrideDeliveryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var order models.Order
+	if err := database.DB.First(&order, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if order.Status != models.StatusOutForDelivery {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only orders out for delivery can be marked delivered"})
+		return
+	}
+	if !advanceOrder(c, &order, models.StatusOutForDelivery, models.StatusDelivered, func(tx *gorm.DB, order *models.Order, now time.Time) error {
+		order.DeliveredAt, order.DeliveredWith = &now, models.DeliveredWithOverride
+		return tx.Create(&models.DeliveryOverride{
+			OrderID:        order.ID,
+			RiderID:        order.RiderID,
+			PreviousStatus: models.StatusOutForDelivery,
+			OverriddenBy:   req.OverriddenBy,
+			Reason:         req.Reason,
+			CreatedAt:      now,
+		}).Error
+	}) {
+		return
+	}
+	c.JSON(http.StatusOK, order)
+}
+
+// GetDeliveryProofs shows admins how an order was confirmed delivered: the
+// proofs the rider uploaded and any overrides.
+func GetDeliveryProofs(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	var order models.Order
+	if err := database.DB.First(&order, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	var proofs []models.DeliveryProof
+	var overrides []models.DeliveryOverride
+	if err := database.DB.Where("order_id = ?", order.ID).Order("id").Find(&proofs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch proofs"})
+		return
+	}
+	if err := database.DB.Where("order_id = ?", order.ID).Order("id").Find(&overrides).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch proofs"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"delivered_with": order.DeliveredWith, "proofs": proofs, "overrides": overrides})
+}
+
+// GetDeliveryProofFile sends the image of one proof.
+func GetDeliveryProofFile(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	var proof models.DeliveryProof
+	if err := database.DB.First(&proof, "id = ? AND order_id = ?", c.Param("proof"), c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Proof not found"})
+		return
+	}
+	obj, err := storage.Default.Get(c.Request.Context(), proof.Key)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Proof file is missing"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load proof"})
+		return
+	}
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Data(http.StatusOK, obj.ContentType, obj.Data)
+}
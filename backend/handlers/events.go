@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"order-mgmt-backend/clock"
+	"order-mgmt-backend/database"
+	"order-mgmt-backend/events"
+	"order-mgmt-backend/models"
+	"order-mgmt-backend/websocket"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sseKeepAlive is how often an idle event stream sends a comment, so that
+// proxies do not close it.
+var sseKeepAlive = 15 * time.Second
+
+func orderEvents() events.Store {
+	return events.Store{DB: database.DB}
+}
+
+// publish records ev as the order's next event and pushes it to the order's
+// subscribers and its customer's. An event that cannot be stored is still
+// pushed, unnumbered, so that live clients see it.
+func publish(ev events.Event) {
+	stored, err := orderEvents().Append(context.Background(), ev)
+	if err != nil {
+		log.Printf("EVENT ERROR: order %s: %v", ev.OrderID, err)
+		stored = ev
+	}
+	broadcastEvent(stored)
+}
+
+// publishLive pushes ev without storing or numbering it, for updates that
+// are stale by the time a client resumes.
+func publishLive(ev events.Event) {
+	ev.V, ev.At = events.Version, clock.Now().UTC()
+	broadcastEvent(ev)
+}
+
+func broadcastEvent(ev events.Event) {
+	websocket.GlobalHub.Broadcast(ev.OrderID, ev)
+	var order models.Order
+	if database.DB.Select("user_id").First(&order, "id = ?", ev.OrderID).Error == nil && order.UserID != nil {
+		websocket.GlobalHub.Broadcast(websocket.UserTopic(strconv.FormatUint(uint64(*order.UserID), 10)), ev)
+	}
+}
+
+// publishChanges publishes how order moved on from the status and payment
+// status it had before: a payment update first, then the status change or
+// cancellation.
+func publishChanges(order *models.Order, previousStatus, previousPayment string) {
+	if order.PaymentStatus != previousPayment {
+		publish(events.PaymentUpdated(*order))
+	}
+	if order.Status == previousStatus {
+		return
+	}
+	if order.Status == models.StatusCancelled {
+		publish(events.Cancelled(*order))
+	} else {
+		publish(events.StatusChanged(*order, previousStatus))
+	}
+}
+
+// ReplayOrderEvents returns the order's events after since as hub messages.
+func ReplayOrderEvents(orderID string, since int64) ([][]byte, error) {
+	missed, err := orderEvents().Since(context.Background(), orderID, since)
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([][]byte, len(missed))
+	for i, ev := range missed {
+		if msgs[i], err = json.Marshal(ev); err != nil {
+			return nil, err
+		}
+	}
+	return msgs, nil
+}
+
+// writeSSE writes one event, with its sequence number as the event id.
+func writeSSE(w gin.ResponseWriter, msg []byte) int64 {
+	var ev events.Event
+	json.Unmarshal(msg, &ev)
+	if ev.Seq > 0 {
+		fmt.Fprintf(w, "id: %d\n", ev.Seq)
+	}
+	fmt.Fprintf(w, "data: %s\n\n", strings.ReplaceAll(string(msg), "\n", ""))
+	w.Flush()
+	return ev.Seq
+}
+
+// GetOrderEvents streams an order's events as Server-Sent Events, for
+// clients that cannot hold a WebSocket open. It follows the same hub topic
+// as the WebSocket. A client resuming with Last-Event-ID, or ?since=, is
+// first sent the events it missed; a new one starts with a snapshot.
+func GetOrderEvents(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	orderID := c.Param("id")
+	v, ok := requestViewer(c)
+	if !ok {
+		return
+	}
+	if err := v.canFollowOrder(orderID); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	since := int64(-1)
+	raw := c.GetHeader("Last-Event-ID")
+	if raw == "" {
+		raw = c.Query("since")
+	}
+	if raw != "" {
+		var err error
+		if since, err = strconv.ParseInt(raw, 10, 64); err != nil || since < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event id"})
+			return
+		}
+	}
+
+	// Subscribe before reading the order so that no change falls between.
+	sub := websocket.GlobalHub.Subscribe(orderID)
+	defer sub.Close()
+	var order models.Order
+	if err := database.DB.Preload("OrderItems").First(&order, "id = ?", orderID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	var backlog [][]byte
+	if since >= 0 {
+		var err error
+		if backlog, err = ReplayOrderEvents(orderID, since); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load events"})
+			return
+		}
+	} else {
+		snapshot, _ := json.Marshal(events.Snapshot(order))
+		backlog = [][]byte{snapshot}
+	}
+
+	h := c.Writer.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	fmt.Fprint(c.Writer, "retry: 3000\n\n")
+	sent := since
+	for _, msg := range backlog {
+		if seq := writeSSE(c.Writer, msg); seq > sent {
+			sent = seq
+		}
+	}
+	c.Writer.Flush()
+
+	ticker := time.NewTicker(sseKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case msg := <-sub.Messages():
+			var ev events.Event
+			if json.Unmarshal(msg, &ev) == nil && ev.Seq != 0 && ev.Seq <= sent {
+				continue
+			}
+			writeSSE(c.Writer, msg)
+		case <-ticker.C:
+			fmt.Fprint(c.Writer, ": keepalive\n\n")
+			c.Writer.Flush()
+		case <-sub.Done():
+			return
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"order-mgmt-backend/clock"
+	"order-mgmt-backend/database"
+	"order-mgmt-backend/giftcard"
+	"order-mgmt-backend/models"
+	"order-mgmt-backend/payments"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	codeGiftCardInvalid      = "GIFT_CARD_INVALID"
+	codeInsufficientGiftCard = "INSUFFICIENT_GIFT_CARD_BALANCE"
+)
+
+func giftCards() giftcard.Store {
+	return giftcard.Store{DB: database.DB}
+}
+
+// chargeGiftCard spends the gift card share of a new order. It runs after
+// redeemPoints and before chargeWallet, so on failure it cancels the order
+// and the caller gives the redeemed points back with restorePoints.
+func chargeGiftCard(ctx context.Context, order *models.Order) error {
+	p := component(order, payments.MethodGiftCard)
+	if p == nil {
+		return nil
+	}
+	_, err := giftCards().Redeem(ctx, *p.GiftCardID, p.Amount, order.ID, "order:"+order.ID)
+	if err != nil {
+		p.Status = models.PaymentFailed
+		database.DB.Model(p).Update("status", p.Status)
+		cancelUnpaid(order, "Gift card payment failed: "+err.Error())
+		return err
+	}
+	p.Status = models.PaymentCaptured
+	return database.DB.Model(p).Update("status", p.Status).Error
+}
+
+// pathGiftCard loads the gift card in the :id param.
+func pathGiftCard(c *gin.Context) (models.GiftCard, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid gift card id"})
+		return models.GiftCard{}, false
+	}
+	card, err := giftCards().Get(c.Request.Context(), uint(id))
+	if errors.Is(err, giftcard.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gift card not found"})
+		return card, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load gift card"})
+		return card, false
+	}
+	return card, true
+}
+
+// IssueGiftCard creates a card. The code is only in the 201 response; a
+// replayed reference returns the card without it.
+func IssueGiftCard(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	var req models.IssueGiftCardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	issue := giftcard.Issue{Amount: req.Amount, Reference: req.Reference, Reason: req.Reason}
+	if req.ExpiresInDays > 0 {
+		expires := clock.Now().Add(time.Duration(req.ExpiresInDays) * 24 * time.Hour)
+		issue.ExpiresAt = &expires
+	}
+
+	card, code, created, err := giftCards().Issue(c.Request.Context(), issue)
+	if errors.Is(err, giftcard.ErrReferenceReuse) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue gift card"})
+		return
+	}
+	if !created {
+		c.JSON(http.StatusOK, gin.H{"gift_card": card})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"gift_card": card, "code": code})
+}
+
+func LookupGiftCard(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	var req models.GiftCardCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	card, err := giftCards().Lookup(c.Request.Context(), req.Code)
+	if errors.Is(err, giftcard.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gift card not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load gift card"})
+		return
+	}
+	c.JSON(http.StatusOK, card)
+}
+
+func GetGiftCard(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	if card, ok := pathGiftCard(c); ok {
+		c.JSON(http.StatusOK, card)
+	}
+}
+
+func VoidGiftCard(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	var req models.VoidGiftCardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	card, ok := pathGiftCard(c)
+	if !ok {
+		return
+	}
+	if _, err := giftCards().Void(c.Request.Context(), card.ID, req.Reason); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to void gift card"})
+		return
+	}
+	if card, ok := pathGiftCard(c); ok {
+		c.JSON(http.StatusOK, card)
+	}
+}
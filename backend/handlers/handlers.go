@@ -1,13 +1,23 @@
 package handlers
 
 import (
+	"errors"
+	"log"
+	"math"
 	"net/http"
+	"order-mgmt-backend/clock"
 	"order-mgmt-backend/database"
+	"order-mgmt-backend/events"
+	"order-mgmt-backend/giftcard"
+	"order-mgmt-backend/kitchen"
+	"order-mgmt-backend/loyalty"
 	"order-mgmt-backend/models"
-	"order-mgmt-backend/websocket"
+	"order-mgmt-backend/payments"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 func GetMenu(c *gin.Context) {
@@ -15,9 +25,51 @@ func GetMenu(c *gin.Context) {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
 		return
 	}
+	var outletID uint64
+	if raw := c.Query("outlet_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid outlet_id"})
+			return
+		}
+		outletID = id
+	}
+	om, err := loadOutletMenu(uint(outletID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Outlet not found"})
+		return
+	}
+
 	var items []models.Item
 	database.DB.Find(&items)
-	c.JSON(http.StatusOK, items)
+
+	windows, err := loadMenuWindows()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load menu schedules"})
+		return
+	}
+	hideUnavailable := c.Query("hide_unavailable") == "true"
+	now := clock.Now()
+	loc := om.location()
+	isOpen, nextOpen, err := openStatus(om.outlet, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load opening hours"})
+		return
+	}
+
+	menu := models.Menu{IsOpen: isOpen, NextOpeningAt: nextOpen, Items: make([]models.MenuItem, 0, len(items))}
+	for _, item := range items {
+		item, sold := om.apply(item)
+		if !sold {
+			continue
+		}
+		mi := windows.menuItem(item, now, loc)
+		if !mi.Available && hideUnavailable {
+			continue
+		}
+		menu.Items = append(menu.Items, mi)
+	}
+	c.JSON(http.StatusOK, menu)
 }
 
 func CreateOrder(c *gin.Context) {
@@ -35,42 +87,281 @@ func CreateOrder(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid phone number format"})
 		return
 	}
+	method, err := payments.ParseMethod(req.PaymentMethod)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": codeInvalidPayment})
+		return
+	}
+	// The customer is whoever the token was issued to; user_id in the body
+	// is only checked against it.
+	userID, ok := requestUser(c)
+	if !ok {
+		return
+	}
+	if req.UserID != nil && *req.UserID != userID {
+		if userID == 0 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Sign in to order as a customer"})
+		} else {
+			c.JSON(http.StatusForbidden, gin.H{"error": "user_id is not the signed-in customer"})
+		}
+		return
+	}
+	if (method == payments.MethodWallet || req.WalletAmount > 0 || req.RedeemPoints > 0) && userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Sign in to pay from the wallet or with points", "code": codeInvalidPayment})
+		return
+	}
+
+	point, err := requestPoint(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	outlet, distanceKm, err := findServingOutlet(point, req.OutletID)
+	if errors.Is(err, errNoOutlet) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Outlet not found"})
+		return
+	}
+	if errors.Is(err, errNotServiceable) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Delivery address is outside the service area", "code": codeNotServiceable})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check serviceability"})
+		return
+	}
+
+	om, err := loadOutletMenu(outlet.ID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Outlet not found"})
+		return
+	}
+	windows, err := loadMenuWindows()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load menu schedules"})
+		return
+	}
+	now := clock.Now()
+	loc := om.location()
+
+	isOpen, nextOpen, err := openStatus(om.outlet, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load opening hours"})
+		return
+	}
+	if !isOpen {
+		c.JSON(http.StatusConflict, gin.H{"error": "Outlet is closed", "code": "OUTLET_CLOSED", "next_opening_at": nextOpen})
+		return
+	}
 
 	order := models.NewOrder()
 	order.CustomerName = req.CustomerName
 	order.CustomerAddress = req.CustomerAddress
 	order.CustomerPhone = req.CustomerPhone
+	if om.outlet != nil {
+		order.OutletID = &om.outlet.ID
+	}
+	order.DeliveryLat = &point.Lat
+	order.DeliveryLng = &point.Lng
 
 	var totalPrice float64
+	var lines []kitchen.Line
 	for _, itemReq := range req.Items {
 		var item models.Item
 		if err := database.DB.First(&item, itemReq.ItemID).Error; err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Item not found"})
 			return
 		}
+		item, sold := om.apply(item)
+		if !sold {
+			c.JSON(http.StatusBadRequest, gin.H{"error": item.Name + " is not available at this outlet", "item_id": item.ID})
+			return
+		}
+		if mi := windows.menuItem(item, now, loc); !mi.Available {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":          item.Name + " is not available right now",
+				"item_id":        item.ID,
+				"available_from": mi.AvailableFrom,
+			})
+			return
+		}
 
 		orderItem := models.OrderItem{
-			OrderID:  order.ID,
-			ItemID:   item.ID,
-			Quantity: itemReq.Quantity,
-			Price:    item.Price,
+			OrderID:   order.ID,
+			ItemID:    item.ID,
+			Quantity:  itemReq.Quantity,
+			Price:     item.Price,
+			Modifiers: itemReq.Modifiers,
+			Notes:     itemReq.Notes,
 		}
 		order.OrderItems = append(order.OrderItems, orderItem)
 		totalPrice += item.Price * float64(itemReq.Quantity)
+		lines = append(lines, kitchen.Line{PrepTime: time.Duration(item.PrepMinutes) * time.Minute, Quantity: itemReq.Quantity})
 	}
 	order.TotalPrice = totalPrice
+	if req.RedeemPoints > 0 {
+		rules, err := loadLoyaltyRules()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load loyalty rules"})
+			return
+		}
+		balance, _, err := pointsTotals(database.DB, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load points"})
+			return
+		}
+		if balance < req.RedeemPoints {
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": "Not enough loyalty points", "code": codeInsufficientPoints, "balance": balance})
+			return
+		}
+		order.PointsRedeemed, order.Discount = loyalty.Redeem(rules, req.RedeemPoints, totalPrice)
+		order.TotalPrice = roundMoney(totalPrice - order.Discount)
+	}
+
+	prep := kitchen.PrepTime(lines)
+	order.PrepMinutes = int(prep.Round(time.Minute) / time.Minute)
 
-	if req.PaymentMethod != "" {
-		order.PaymentStatus = "Paid"
+	var card models.GiftCard
+	var giftAmount float64
+	if req.GiftCardCode != "" {
+		card, err = giftCards().Lookup(c.Request.Context(), req.GiftCardCode)
+		if errors.Is(err, giftcard.ErrNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Gift card not found", "code": codeGiftCardInvalid})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load gift card"})
+			return
+		}
+		if err := giftcard.Usable(card, now); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": codeGiftCardInvalid})
+			return
+		}
+		// Without an amount the card pays as much of the order as it can.
+		giftAmount = req.GiftCardAmount
+		if due := roundMoney(order.TotalPrice - req.WalletAmount); method == payments.MethodGiftCard {
+			giftAmount = due
+		} else if giftAmount == 0 {
+			giftAmount = math.Max(math.Min(card.Balance, due), 0)
+		}
+		if card.Balance < giftAmount {
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": "Gift card balance is too low", "code": codeInsufficientGiftCard, "balance": card.Balance})
+			return
+		}
+	} else if method == payments.MethodGiftCard || req.GiftCardAmount > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Gift card payments need a gift_card_code", "code": codeInvalidPayment})
+		return
 	}
 
-	if err := database.DB.Create(&order).Error; err != nil {
+	parts, err := payments.Split(order.TotalPrice, method,
+		payments.Component{Method: payments.MethodGiftCard, Amount: giftAmount},
+		payments.Component{Method: payments.MethodWallet, Amount: req.WalletAmount})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": codeInvalidPayment})
+		return
+	}
+	if userID != 0 {
+		order.UserID = &userID
+	}
+	order.PaymentMethod = string(method)
+	order.Payments = orderPayments(order.ID, parts)
+	if p := component(order, payments.MethodGiftCard); p != nil {
+		p.GiftCardID = &card.ID
+	}
+	if wallet := component(order, payments.MethodWallet); wallet != nil {
+		balance, err := payments.DefaultWallet.Balance(c.Request.Context(), userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check wallet balance"})
+			return
+		}
+		if balance < wallet.Amount {
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": "Wallet balance is too low", "code": codeInsufficientWallet, "balance": balance})
+			return
+		}
+	}
+	online := onlineComponent(order)
+	if online != nil {
+		order.Status = models.StatusAwaitingPayment
+		order.PaymentProvider = payments.Default.Name()
+	}
+
+	// The kitchen is counted and the order queued in one transaction, with
+	// the outlet locked, so that concurrent orders cannot all take its last
+	// slot.
+	var queue kitchen.Queue
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if queue, err = kitchenQueue(tx, om.outlet, now); err != nil {
+			return err
+		}
+		if queue.Full() && !om.outlet.DeferWhenFull {
+			return errKitchenFull
+		}
+		estimate := queue.Schedule(prep, now)
+		eta := estimate.ReadyAt.Add(deliveryTime(distanceKm))
+		order.KitchenStartAt = &estimate.StartAt
+		order.EstimatedReadyAt = &estimate.ReadyAt
+		order.EstimatedDeliveryAt = &eta
+		return tx.Create(&order).Error
+	})
+	if errors.Is(err, errKitchenFull) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Kitchen is at capacity, please try again shortly", "code": codeKitchenFull, "retry_at": queue.NextFreed})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
 		return
 	}
+	order.TrackingToken = trackingToken(order.ID)
+	publish(events.Created(*order))
+
+	if err := redeemPoints(order); err != nil {
+		cancelUnpaid(order, "Points redemption failed: "+err.Error())
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": "Payment failed", "code": codeInsufficientPoints, "order": order})
+		return
+	}
+	if err := chargeGiftCard(c.Request.Context(), order); err != nil {
+		restorePoints(order)
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": "Payment failed", "code": codePaymentFailed, "order": order})
+		return
+	}
+	if err := chargeWallet(c.Request.Context(), order); err != nil {
+		refundCancelledOrder(c.Request.Context(), order)
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": "Payment failed", "code": codePaymentFailed, "order": order})
+		return
+	}
+	if online == nil {
+		if paidInFull(order) {
+			if captured, _ := updatePayment(database.DB, order, []string{models.PaymentPending}, models.PaymentCaptured, nil); captured {
+				publish(events.PaymentUpdated(*order))
+			}
+			releaseOrder(order)
+		} else {
+			startKitchen(order)
+		}
+		c.JSON(http.StatusCreated, order)
+		return
+	}
 
-	go simulateOrderStatus(order.ID)
+	intent, err := payments.Default.CreateIntent(c.Request.Context(), payments.IntentRequest{
+		OrderID: order.ID,
+		Amount:  online.Amount,
+		Method:  online.Method,
+		Token:   req.PaymentToken,
+	})
+	if err != nil {
+		log.Printf("PAYMENT ERROR: create intent for order %s: %v", order.ID, err)
+		intent = payments.Intent{Status: payments.StatusFailed, Error: "payment provider unavailable"}
+	} else {
+		order.PaymentIntentID = intent.ID
+		online.IntentID = intent.ID
+		database.DB.Model(order).Update("payment_intent_id", intent.ID)
+		database.DB.Model(online).Update("intent_id", intent.ID)
+	}
+	settlePayment(c.Request.Context(), order, intent)
 
+	if order.PaymentStatus == models.PaymentFailed {
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": "Payment failed", "code": codePaymentFailed, "order": order})
+		return
+	}
 	c.JSON(http.StatusCreated, order)
 }
 
@@ -79,41 +370,31 @@ func GetOrder(c *gin.Context) {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
 		return
 	}
+	if !followOrder(c) {
+		return
+	}
 	id := c.Param("id")
 	var order models.Order
-	if err := database.DB.Preload("OrderItems.Item").First(&order, "id = ?", id).Error; err != nil {
+	if err := database.DB.Preload("OrderItems.Item").Preload("Payments").Preload("Refunds", orderByID).First(&order, "id = ?", id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 		return
 	}
-
-	if order.Status != "Delivered" {
-		elapsed := time.Since(order.CreatedAt)
-		newStatus := order.Status
-		if elapsed > 15*time.Second {
-			newStatus = "Delivered"
-		} else if elapsed > 10*time.Second {
-			newStatus = "Out for Delivery"
-		} else if elapsed > 5*time.Second {
-			newStatus = "Preparing"
-		}
-
-		if newStatus != order.Status {
-			order.Status = newStatus
-			database.DB.Save(&order)
-		}
-	}
-
 	c.JSON(http.StatusOK, order)
 }
 
+// GetUserOrders lists the orders placed by the customer in the :id param,
+// for that customer or an admin.
 func GetUserOrders(c *gin.Context) {
 	if database.DB == nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
 		return
 	}
-	name := c.Param("name")
+	user, ok := accountUser(c)
+	if !ok {
+		return
+	}
 	var orders []models.Order
-	if err := database.DB.Preload("OrderItems.Item").Where("customer_name = ?", name).Order("created_at desc").Find(&orders).Error; err != nil {
+	if err := database.DB.Preload("OrderItems.Item").Preload("Payments").Preload("Refunds", orderByID).Where("user_id = ?", user.ID).Order("created_at desc").Find(&orders).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
 		return
 	}
@@ -126,20 +407,55 @@ func CancelOrder(c *gin.Context) {
 		return
 	}
 	id := c.Param("id")
+	v, ok := requestViewer(c)
+	if !ok {
+		return
+	}
+	if !v.admin && !v.ownsOrder(id) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the customer can cancel the order"})
+		return
+	}
 	var order models.Order
 	if err := database.DB.First(&order, "id = ?", id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 		return
 	}
-	if order.Status == "Delivered" || order.Status == "Out for Delivery" {
+	if !cancellable(order.Status) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot cancel order that is already en route or delivered"})
 		return
 	}
-	order.Status = "Cancelled"
-	database.DB.Save(&order)
+	if !cancelOrder(c, &order) {
+		return
+	}
 	c.JSON(http.StatusOK, order)
 }
 
+func cancellable(status string) bool {
+	return status != models.StatusDelivered && status != models.StatusOutForDelivery
+}
+
+// cancelOrder cancels order, unless its status moved on since it was read,
+// and refunds whatever was paid for it. It reports whether the order was
+// cancelled; if not the request has been answered.
+func cancelOrder(c *gin.Context, order *models.Order) bool {
+	result := database.DB.Model(&models.Order{}).Where("id = ? AND status = ?", order.ID, order.Status).Update("status", models.StatusCancelled)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel order"})
+		return false
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Order was updated by someone else, please refresh"})
+		return false
+	}
+	order.Status = models.StatusCancelled
+	publish(events.Cancelled(*order))
+	refundCancelledOrder(c.Request.Context(), order)
+	loadRefunds(order)
+	return true
+}
+
+// UpdateOrderStatus lets an admin move an order along by hand, one
+// transition at a time.
 func UpdateOrderStatus(c *gin.Context) {
 	if database.DB == nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
@@ -151,13 +467,52 @@ func UpdateOrderStatus(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if req.Status == models.StatusDelivered {
+		c.JSON(http.StatusConflict, gin.H{"error": "Orders are marked delivered by the rider, with the customer's code or a proof of delivery", "code": codeDeliveryConfirmation})
+		return
+	}
+	// Pickup gives the order its rider and delivery code, without which it
+	// could never be delivered.
+	if req.Status == models.StatusOutForDelivery {
+		c.JSON(http.StatusConflict, gin.H{"error": "Orders go out for delivery when their rider picks them up", "code": codeRiderPickup})
+		return
+	}
 	var order models.Order
 	if err := database.DB.First(&order, "id = ?", id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 		return
 	}
+	// Only the payment releases an order to the kitchen, from applyIntent
+	// or releaseOrder, so that it is never cooked unpaid.
+	if (order.Status == models.StatusAwaitingPayment && req.Status != models.StatusCancelled) || req.Status == models.StatusAwaitingPayment {
+		c.JSON(http.StatusConflict, gin.H{"error": "Orders awaiting payment move on once paid", "code": codeAwaitingPayment})
+		return
+	}
+	if !models.CanTransition(order.Status, req.Status) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot move order from " + order.Status + " to " + req.Status})
+		return
+	}
+	if req.Status == models.StatusCancelled {
+		if cancelOrder(c, &order) {
+			c.JSON(http.StatusOK, order)
+		}
+		return
+	}
+	previous := order.Status
+	result := database.DB.Model(&models.Order{}).Where("id = ? AND status = ?", order.ID, previous).Update("status", req.Status)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Order was updated by someone else, please refresh"})
+		return
+	}
 	order.Status = req.Status
-	database.DB.Save(&order)
+	publishChanges(&order, previous, order.PaymentStatus)
+	if order.Status == models.StatusReady {
+		orderReady(&order)
+	}
 	c.JSON(http.StatusOK, order)
 }
 
@@ -178,7 +533,10 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, user)
+	c.JSON(http.StatusOK, struct {
+		models.User
+		Token string `json:"token"`
+	}{user, userToken(user.ID)})
 }
 
 func GetOffers(c *gin.Context) {
@@ -201,15 +559,72 @@ func GetLocations(c *gin.Context) {
 	c.JSON(http.StatusOK, locations)
 }
 
-func simulateOrderStatus(orderID string) {
-	statuses := []string{"Preparing", "Out for Delivery", "Delivered"}
-	interval := 5 * time.Second
+// simulatedPickup is the least time the simulated kitchen takes to start
+// on an order, so that its customer sees it received first.
+const simulatedPickup = 5 * time.Second
+
+// simulateOrderStatus stands in for the kitchen at outlets without a
+// display, moving the order along on the times it was scheduled for until
+// it is ready, when dispatch takes it from there like any other. now
+// is the time it starts at; it keeps time itself from there.
+func simulateOrderStatus(orderID string, now time.Time) {
+	started := time.Now()
+	for {
+		var order models.Order
+		if err := database.DB.First(&order, "id = ?", orderID).Error; err != nil {
+			return
+		}
+		next, at, ok := simulatedStep(order)
+		if !ok {
+			return
+		}
+		if pickup := now.Add(simulatedPickup); order.Status == models.StatusReceived && at.Before(pickup) {
+			at = pickup
+		}
+		if wait := at.Sub(now.Add(time.Since(started))); wait > 0 {
+			time.Sleep(wait)
+		}
+		if !advanceSimulation(&order, next) {
+			return
+		}
+	}
+}
+
+// simulatedStep is the status the simulation moves order to next, and
+// when: it starts preparing at its KitchenStartAt and is ready at its
+// EstimatedReadyAt. Orders placed before they were scheduled move on at
+// once.
+func simulatedStep(order models.Order) (string, time.Time, bool) {
+	var next string
+	var at *time.Time
+	switch order.Status {
+	case models.StatusReceived:
+		next, at = models.StatusPreparing, order.KitchenStartAt
+	case models.StatusPreparing:
+		next, at = models.StatusReady, order.EstimatedReadyAt
+	default:
+		return "", time.Time{}, false
+	}
+	if at == nil {
+		return next, order.CreatedAt, true
+	}
+	return next, *at, true
+}
 
-	for _, status := range statuses {
-		time.Sleep(interval)
-		database.DB.Model(&models.Order{}).Where("id = ?", orderID).Update("status", status)
-		websocket.GlobalHub.BroadcastStatus(orderID, status)
+// advanceSimulation moves order to next, unless it has left the simulated
+// path meanwhile, e.g. cancelled.
+func advanceSimulation(order *models.Order, next string) bool {
+	previous := order.Status
+	result := database.DB.Model(&models.Order{}).Where("id = ? AND status = ?", order.ID, previous).Update("status", next)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false
+	}
+	order.Status = next
+	publish(events.StatusChanged(*order, previous))
+	if next == models.StatusReady {
+		orderReady(order)
 	}
+	return true
 }
 
 func isValidPhone(phone string) bool {
@@ -1,16 +1,32 @@
 package handlers
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"order-mgmt-backend/clock"
 	"order-mgmt-backend/database"
+	"order-mgmt-backend/dispatch"
+	"order-mgmt-backend/events"
 	"order-mgmt-backend/models"
+	"order-mgmt-backend/payments"
+	"order-mgmt-backend/storage"
+	"order-mgmt-backend/tracking"
+	"order-mgmt-backend/websocket"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	gorillaws "github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -18,13 +34,27 @@ import (
 
 func TestMain(m *testing.M) {
 	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-	db.AutoMigrate(&models.Item{}, &models.Order{}, &models.OrderItem{}, &models.User{}, &models.Offer{})
+	database.Migrate(db)
 	database.DB = db
 
-	db.Create(&models.Item{ID: 1, Name: "Test Item", Price: 10.0})
+	db.Create(&models.Item{ID: 1, Name: "Test Item", Price: 10.0, PrepMinutes: 10})
+	db.Create(&models.Item{ID: 2, Name: "Test Dosa", Price: 5.0, Category: "Breakfast"})
+	db.Create(&models.MenuSchedule{Category: "Breakfast", StartTime: "07:00", EndTime: "11:00"})
 	db.Create(&models.User{Email: "demo@example.com", Password: "password123", Name: "Test User"})
 	db.Create(&models.Offer{Code: "TESTOFFER", Discount: 10, Description: "Test Offer"})
 
+	price := 12.5
+	db.Create(&models.Location{ID: 1, Name: "Test City"})
+	db.Create(&models.Outlet{ID: 1, Name: "Test Kitchen", LocationID: 1, Latitude: 12.9716, Longitude: 77.5946, DeliveryRadiusKm: 10, TimeZone: "Asia/Kolkata", OpensAt: "00:00", ClosesAt: "00:00"})
+	db.Create(&models.OutletItem{OutletID: 1, ItemID: 1, Available: true, Price: &price})
+	db.Create(&models.OutletItem{OutletID: 1, ItemID: 2, Available: false})
+	db.Create(&models.Location{ID: 2, Name: "Office Park"})
+	db.Create(&models.Outlet{ID: 2, Name: "Office Kitchen", LocationID: 2, Latitude: 12.9716, Longitude: 77.5946, DeliveryRadiusKm: 1, TimeZone: "Asia/Kolkata"})
+	db.Create(&models.OutletHours{OutletID: 2, Days: 0b0111110, OpensAt: "09:00", ClosesAt: "17:00"})
+	db.Create(&models.OutletHoliday{OutletID: 2, Date: "2026-03-04", Reason: "Holi"})
+	db.Create(&models.Outlet{ID: 3, Name: "Tiny Kitchen", LocationID: 2, Latitude: 12.9716, Longitude: 77.5946, DeliveryRadiusKm: 10, KitchenStations: 1, MaxActiveOrders: 1})
+	db.Create(&models.Outlet{ID: 4, Name: "KDS Kitchen", LocationID: 2, Latitude: 12.9716, Longitude: 77.5946, DeliveryRadiusKm: 10, KitchenStations: 2, UsesKDS: true})
+
 	code := m.Run()
 	os.Exit(code)
 }
@@ -40,10 +70,11 @@ func TestGetMenu(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, w.Code)
 
-	var items []models.Item
-	err := json.Unmarshal(w.Body.Bytes(), &items)
+	var menu models.Menu
+	err := json.Unmarshal(w.Body.Bytes(), &menu)
 	assert.Nil(t, err)
-	assert.True(t, len(items) > 0)
+	assert.True(t, menu.IsOpen)
+	assert.True(t, len(menu.Items) > 0)
 }
 
 func TestLogin(t *testing.T) {
@@ -87,3 +118,2082 @@ func TestGetOffers(t *testing.T) {
 	assert.Nil(t, err)
 	assert.True(t, len(offers) > 0)
 }
+
+func pinClock(t *testing.T, at string) {
+	ist, _ := time.LoadLocation("Asia/Kolkata")
+	now, err := time.ParseInLocation("2006-01-02 15:04", at, ist)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Now = func() time.Time { return now }
+	t.Cleanup(func() { clock.Now = time.Now })
+}
+
+func TestGetMenu_Schedules(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.GET("/menu", GetMenu)
+
+	pinClock(t, "2026-03-02 15:30")
+
+	req, _ := http.NewRequest("GET", "/menu", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var menu models.Menu
+	json.Unmarshal(w.Body.Bytes(), &menu)
+	for _, mi := range menu.Items {
+		if mi.ID == 2 {
+			assert.False(t, mi.Available)
+			assert.Equal(t, "Tue 7:00", mi.AvailableFrom)
+		} else {
+			assert.True(t, mi.Available)
+		}
+	}
+
+	req, _ = http.NewRequest("GET", "/menu?hide_unavailable=true", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	json.Unmarshal(w.Body.Bytes(), &menu)
+	for _, mi := range menu.Items {
+		assert.NotEqual(t, uint(2), mi.ID)
+	}
+}
+
+func TestCreateOrder_OutsideSchedule(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.POST("/orders", CreateOrder)
+
+	payload := `{"customer_name":"Jane","customer_address":"1 Road","customer_phone":"1234567890","latitude":12.97,"longitude":77.59,"outlet_id":4,"items":[{"item_id":2,"quantity":1}]}`
+
+	pinClock(t, "2026-03-02 06:15")
+	req, _ := http.NewRequest("POST", "/orders", strings.NewReader(payload))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"available_from":"7:00"`)
+
+	pinClock(t, "2026-03-02 08:00")
+	req, _ = http.NewRequest("POST", "/orders", strings.NewReader(payload))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	// Keep the order out of the kitchen display tests.
+	var order models.Order
+	json.Unmarshal(w.Body.Bytes(), &order)
+	database.DB.Model(&order).Update("status", models.StatusCancelled)
+}
+
+func TestGetOutlets(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.GET("/outlets", GetOutlets)
+
+	req, _ := http.NewRequest("GET", "/outlets?location_id=1", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var outlets []models.Outlet
+	json.Unmarshal(w.Body.Bytes(), &outlets)
+	assert.Len(t, outlets, 1)
+	assert.Equal(t, "Test City", outlets[0].Location.Name)
+
+	req, _ = http.NewRequest("GET", "/outlets?location_id=99", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	json.Unmarshal(w.Body.Bytes(), &outlets)
+	assert.Empty(t, outlets)
+}
+
+func TestOutletMenuAndOrder(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.GET("/menu", GetMenu)
+	r.POST("/orders", CreateOrder)
+
+	pinClock(t, "2026-03-02 08:00")
+
+	req, _ := http.NewRequest("GET", "/menu?outlet_id=1", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var menu models.Menu
+	json.Unmarshal(w.Body.Bytes(), &menu)
+	assert.Len(t, menu.Items, 1)
+	assert.Equal(t, 12.5, menu.Items[0].Price)
+
+	payload := `{"customer_name":"Jane","customer_address":"1 Road","customer_phone":"1234567890","latitude":12.97,"longitude":77.59,"outlet_id":1,"items":[{"item_id":2,"quantity":1}]}`
+	req, _ = http.NewRequest("POST", "/orders", strings.NewReader(payload))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	payload = `{"customer_name":"Jane","customer_address":"1 Road","customer_phone":"1234567890","latitude":12.97,"longitude":77.59,"outlet_id":1,"items":[{"item_id":1,"quantity":2}]}`
+	req, _ = http.NewRequest("POST", "/orders", strings.NewReader(payload))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var order models.Order
+	json.Unmarshal(w.Body.Bytes(), &order)
+	assert.Equal(t, 25.0, order.TotalPrice)
+	if assert.NotNil(t, order.OutletID) {
+		assert.Equal(t, uint(1), *order.OutletID)
+	}
+
+	req, _ = http.NewRequest("GET", "/menu?outlet_id=42", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestGetServiceability(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.GET("/serviceability", GetServiceability)
+
+	req, _ := http.NewRequest("GET", "/serviceability?lat=12.93&lng=77.62", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Serviceable bool          `json:"serviceable"`
+		Code        string        `json:"code"`
+		Outlet      models.Outlet `json:"outlet"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.True(t, resp.Serviceable)
+	assert.Equal(t, uint(1), resp.Outlet.ID)
+
+	req, _ = http.NewRequest("GET", "/serviceability?lat=13.0827&lng=80.2707", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	resp.Serviceable = true
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.False(t, resp.Serviceable)
+	assert.Equal(t, "ADDRESS_NOT_SERVICEABLE", resp.Code)
+
+	req, _ = http.NewRequest("GET", "/serviceability?lat=abc", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	req, _ = http.NewRequest("GET", "/serviceability?lat=12.93&lng=77.62&outlet_id=42", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestCreateOrder_NotServiceable(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.POST("/orders", CreateOrder)
+
+	payload := `{"customer_name":"Jane","customer_address":"Far Away","customer_phone":"1234567890","latitude":13.0827,"longitude":80.2707,"items":[{"item_id":1,"quantity":1}]}`
+	req, _ := http.NewRequest("POST", "/orders", strings.NewReader(payload))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "ADDRESS_NOT_SERVICEABLE")
+
+	payload = `{"customer_name":"Jane","customer_address":"Nearby","customer_phone":"1234567890","latitude":12.93,"longitude":77.62,"items":[{"item_id":1,"quantity":1}]}`
+	req, _ = http.NewRequest("POST", "/orders", strings.NewReader(payload))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var order models.Order
+	json.Unmarshal(w.Body.Bytes(), &order)
+	if assert.NotNil(t, order.OutletID) {
+		assert.Equal(t, uint(1), *order.OutletID)
+	}
+
+	// Without coordinates there is no knowing whether the address is served.
+	payload = `{"customer_name":"Jane","customer_address":"Nearby","customer_phone":"1234567890","items":[{"item_id":1,"quantity":1}]}`
+	req, _ = http.NewRequest("POST", "/orders", strings.NewReader(payload))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	payload = `{"customer_name":"Jane","customer_address":"Nearby","customer_phone":"1234567890","latitude":12.93,"longitude":77.62,"outlet_id":42,"items":[{"item_id":1,"quantity":1}]}`
+	req, _ = http.NewRequest("POST", "/orders", strings.NewReader(payload))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestOpeningHours(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.GET("/menu", GetMenu)
+	r.POST("/orders", CreateOrder)
+
+	payload := `{"customer_name":"Jane","customer_address":"1 Road","customer_phone":"1234567890","latitude":12.97,"longitude":77.59,"outlet_id":2,"items":[{"item_id":1,"quantity":1}]}`
+
+	pinClock(t, "2026-03-03 18:00")
+	req, _ := http.NewRequest("GET", "/menu?outlet_id=2", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	// Wednesday is a holiday, so the next opening is Thursday morning.
+	ist, _ := time.LoadLocation("Asia/Kolkata")
+	var menu models.Menu
+	json.Unmarshal(w.Body.Bytes(), &menu)
+	assert.NotEmpty(t, menu.Items)
+	assert.False(t, menu.IsOpen)
+	if assert.NotNil(t, menu.NextOpeningAt) {
+		assert.True(t, time.Date(2026, 3, 5, 9, 0, 0, 0, ist).Equal(*menu.NextOpeningAt))
+	}
+
+	req, _ = http.NewRequest("POST", "/orders", strings.NewReader(payload))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	var closed struct {
+		Code          string    `json:"code"`
+		NextOpeningAt time.Time `json:"next_opening_at"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &closed)
+	assert.Equal(t, "OUTLET_CLOSED", closed.Code)
+	assert.True(t, time.Date(2026, 3, 5, 9, 0, 0, 0, ist).Equal(closed.NextOpeningAt))
+
+	pinClock(t, "2026-03-05 10:00")
+	req, _ = http.NewRequest("POST", "/orders", strings.NewReader(payload))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
+
+func TestOutletHolidays(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	admin := r.Group("/admin", RequireAdmin)
+	admin.POST("/outlets/:id/holidays", AddHoliday)
+	admin.DELETE("/outlets/:id/holidays/:holiday", RemoveHoliday)
+	r.GET("/menu", GetMenu)
+
+	t.Setenv("ADMIN_API_KEY", "secret")
+	pinClock(t, "2026-03-06 10:00")
+	call := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-Admin-Key", "secret")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	menu := func() models.Menu {
+		var menu models.Menu
+		json.Unmarshal(call("GET", "/menu?outlet_id=1", "").Body.Bytes(), &menu)
+		return menu
+	}
+
+	assert.Equal(t, http.StatusBadRequest, call("POST", "/admin/outlets/1/holidays", `{"date":"06/03/2026"}`).Code)
+	assert.Equal(t, http.StatusNotFound, call("POST", "/admin/outlets/42/holidays", `{"date":"2026-03-06"}`).Code)
+	w := call("POST", "/admin/outlets/1/holidays", `{"date":"2026-03-06","reason":"Stocktake"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var holiday models.OutletHoliday
+	json.Unmarshal(w.Body.Bytes(), &holiday)
+	assert.Equal(t, http.StatusConflict, call("POST", "/admin/outlets/1/holidays", `{"date":"2026-03-06"}`).Code)
+
+	closed := menu()
+	assert.False(t, closed.IsOpen)
+	ist, _ := time.LoadLocation("Asia/Kolkata")
+	if assert.NotNil(t, closed.NextOpeningAt) {
+		assert.True(t, time.Date(2026, 3, 7, 0, 0, 0, 0, ist).Equal(*closed.NextOpeningAt))
+	}
+
+	path := fmt.Sprintf("/admin/outlets/1/holidays/%d", holiday.ID)
+	assert.Equal(t, http.StatusNotFound, call("DELETE", fmt.Sprintf("/admin/outlets/2/holidays/%d", holiday.ID), "").Code)
+	assert.Equal(t, http.StatusOK, call("DELETE", path, "").Code)
+	assert.Equal(t, http.StatusNotFound, call("DELETE", path, "").Code)
+	open := menu()
+	assert.True(t, open.IsOpen)
+	assert.Nil(t, open.NextOpeningAt)
+}
+
+func TestPauseOrdering(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	admin := r.Group("/admin", RequireAdmin)
+	admin.POST("/pause", PauseOrdering)
+	admin.DELETE("/pause", ResumeOrdering)
+	r.POST("/orders", CreateOrder)
+
+	t.Setenv("ADMIN_API_KEY", "secret")
+	pinClock(t, "2026-03-05 10:00")
+
+	req, _ := http.NewRequest("POST", "/admin/pause", strings.NewReader(`{"outlet_id":1,"minutes":20}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req, _ = http.NewRequest("POST", "/admin/pause", strings.NewReader(`{"outlet_id":1,"minutes":20,"reason":"Rush"}`))
+	req.Header.Set("X-Admin-Key", "secret")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	payload := `{"customer_name":"Jane","customer_address":"1 Road","customer_phone":"1234567890","latitude":12.97,"longitude":77.59,"outlet_id":1,"items":[{"item_id":1,"quantity":1}]}`
+	req, _ = http.NewRequest("POST", "/orders", strings.NewReader(payload))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "OUTLET_CLOSED")
+
+	req, _ = http.NewRequest("DELETE", "/admin/pause?outlet_id=1", nil)
+	req.Header.Set("X-Admin-Key", "secret")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req, _ = http.NewRequest("POST", "/orders", strings.NewReader(payload))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
+
+func TestCreateOrder_KitchenCapacity(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.POST("/orders", CreateOrder)
+
+	pinClock(t, "2026-03-05 12:00")
+	payload := `{"customer_name":"Jane","customer_address":"1 Road","customer_phone":"1234567890","latitude":12.97,"longitude":77.59,"outlet_id":3,"items":[{"item_id":1,"quantity":3}]}`
+
+	req, _ := http.NewRequest("POST", "/orders", strings.NewReader(payload))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var first models.Order
+	json.Unmarshal(w.Body.Bytes(), &first)
+	assert.Equal(t, 12, first.PrepMinutes)
+	if assert.NotNil(t, first.EstimatedReadyAt) && assert.NotNil(t, first.EstimatedDeliveryAt) {
+		assert.True(t, clock.Now().Add(12*time.Minute).Equal(*first.EstimatedReadyAt))
+		assert.True(t, first.EstimatedDeliveryAt.After(*first.EstimatedReadyAt))
+	}
+
+	req, _ = http.NewRequest("POST", "/orders", strings.NewReader(payload))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), "KITCHEN_AT_CAPACITY")
+	var queued int64
+	database.DB.Model(&models.Order{}).Where("outlet_id = ?", 3).Count(&queued)
+	assert.Equal(t, int64(1), queued)
+
+	database.DB.Model(&models.Outlet{}).Where("id = ?", 3).Update("defer_when_full", true)
+	t.Cleanup(func() { database.DB.Model(&models.Outlet{}).Where("id = ?", 3).Update("defer_when_full", false) })
+
+	req, _ = http.NewRequest("POST", "/orders", strings.NewReader(payload))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var deferred models.Order
+	json.Unmarshal(w.Body.Bytes(), &deferred)
+	if assert.NotNil(t, deferred.KitchenStartAt) {
+		assert.True(t, first.EstimatedReadyAt.Equal(*deferred.KitchenStartAt))
+	}
+}
+
+func TestSimulatedStep(t *testing.T) {
+	created := time.Date(2026, 3, 5, 6, 30, 0, 0, time.UTC)
+	start, ready := created.Add(4*time.Minute), created.Add(16*time.Minute)
+	order := models.Order{CreatedAt: created, KitchenStartAt: &start, EstimatedReadyAt: &ready}
+
+	for status, want := range map[string]struct {
+		next string
+		at   time.Time
+	}{
+		models.StatusReceived:  {models.StatusPreparing, start},
+		models.StatusPreparing: {models.StatusReady, ready},
+	} {
+		order.Status = status
+		next, at, ok := simulatedStep(order)
+		assert.True(t, ok, status)
+		assert.Equal(t, want.next, next, status)
+		assert.True(t, want.at.Equal(at), status)
+	}
+
+	// Riders take it from there.
+	for _, status := range []string{models.StatusReady, models.StatusOutForDelivery, models.StatusCancelled} {
+		order.Status = status
+		_, _, ok := simulatedStep(order)
+		assert.False(t, ok, status)
+	}
+
+	// Orders scheduled before these times were kept move on at once.
+	next, at, ok := simulatedStep(models.Order{Status: models.StatusReceived, CreatedAt: created})
+	assert.True(t, ok)
+	assert.Equal(t, models.StatusPreparing, next)
+	assert.True(t, created.Equal(at))
+
+	// Looking at an order leaves it where the simulation has it, however
+	// late it runs.
+	r := gin.New()
+	r.GET("/orders/:id", GetOrder)
+	outlet := uint(1)
+	late := models.NewOrder()
+	late.Status, late.OutletID, late.KitchenStartAt, late.EstimatedReadyAt = models.StatusReceived, &outlet, &start, &ready
+	assert.NoError(t, database.DB.Create(late).Error)
+	req, _ := http.NewRequest("GET", "/orders/"+late.ID, nil)
+	req.Header.Set("Authorization", "Bearer "+trackingToken(late.ID))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var seen models.Order
+	json.Unmarshal(w.Body.Bytes(), &seen)
+	assert.Equal(t, models.StatusReceived, seen.Status)
+	database.DB.First(&seen, "id = ?", late.ID)
+	assert.Equal(t, models.StatusReceived, seen.Status)
+	database.DB.Model(late).Update("status", models.StatusCancelled)
+}
+
+// eventTypes lists the types of the events stored for an order, in order.
+func eventTypes(t *testing.T, orderID string) []string {
+	stored, err := orderEvents().Since(context.Background(), orderID, 0)
+	assert.NoError(t, err)
+	types := make([]string, len(stored))
+	for i, e := range stored {
+		types[i] = e.Type
+	}
+	return types
+}
+
+func TestKitchenDisplay(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.POST("/orders", CreateOrder)
+	kds := r.Group("/kitchen", RequireKitchen)
+	kds.GET("/outlets/:id/orders", GetKitchenOrders)
+	kds.POST("/orders/:id/accept", AcceptOrder)
+	kds.POST("/orders/:id/reject", RejectOrder)
+	kds.POST("/orders/:id/ready", MarkOrderReady)
+	r.POST("/admin/outlets/:id/kitchen-token", RequireAdmin, IssueKitchenToken)
+
+	t.Setenv("ADMIN_API_KEY", "secret")
+	pinClock(t, "2026-03-05 12:00")
+
+	issue := func(outlet string) string {
+		req, _ := http.NewRequest("POST", "/admin/outlets/"+outlet+"/kitchen-token", nil)
+		req.Header.Set("X-Admin-Key", "secret")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var body struct {
+			Token string `json:"token"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return body.Token
+	}
+	token, otherToken := issue("4"), issue("1")
+
+	create := func() models.Order {
+		payload := `{"customer_name":"Jane","customer_address":"1 Road","customer_phone":"1234567890","latitude":12.97,"longitude":77.59,"outlet_id":4,"items":[{"item_id":1,"quantity":1,"modifiers":["extra cheese"],"notes":"no onions"}]}`
+		req, _ := http.NewRequest("POST", "/orders", strings.NewReader(payload))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var order models.Order
+		json.Unmarshal(w.Body.Bytes(), &order)
+		return order
+	}
+	as := func(token, method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	kitchen := func(method, path, body string) *httptest.ResponseRecorder {
+		return as(token, method, path, body)
+	}
+
+	cooked := create()
+	rejected := create()
+
+	// Another outlet's display can neither see nor work these orders.
+	assert.Equal(t, http.StatusUnauthorized, as("", "GET", "/kitchen/outlets/4/orders", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, as(userToken(1), "GET", "/kitchen/outlets/4/orders", "").Code)
+	assert.Equal(t, http.StatusForbidden, as(otherToken, "GET", "/kitchen/outlets/4/orders", "").Code)
+	assert.Equal(t, http.StatusForbidden, as(otherToken, "POST", "/kitchen/orders/"+cooked.ID+"/accept", "").Code)
+
+	w := kitchen("POST", "/kitchen/orders/"+cooked.ID+"/ready", "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = kitchen("POST", "/kitchen/orders/"+cooked.ID+"/accept", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = kitchen("POST", "/kitchen/orders/"+rejected.ID+"/reject", `{"reason":"Out of cheese"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = kitchen("GET", "/kitchen/outlets/4/orders", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var columns []struct {
+		Status string         `json:"status"`
+		Orders []models.Order `json:"orders"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &columns)
+	if assert.Len(t, columns, 3) {
+		assert.Empty(t, columns[0].Orders)
+		if assert.Len(t, columns[1].Orders, 1) {
+			line := columns[1].Orders[0].OrderItems[0]
+			assert.Equal(t, []string{"extra cheese"}, line.Modifiers)
+			assert.Equal(t, "no onions", line.Notes)
+		}
+	}
+
+	w = kitchen("POST", "/kitchen/orders/"+cooked.ID+"/ready", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var stored models.Order
+	database.DB.First(&stored, "id = ?", rejected.ID)
+	assert.Equal(t, models.StatusRejected, stored.Status)
+	assert.Equal(t, "Out of cheese", stored.StatusReason)
+	var ready models.Order
+	database.DB.First(&ready, "id = ?", cooked.ID)
+	assert.Equal(t, models.StatusReady, ready.Status)
+
+	// Accepting on time keeps the estimate; marking it ready early moves it.
+	assert.Equal(t, []string{events.TypeCreated, events.TypeStatusChanged, events.TypeStatusChanged, events.TypeETAUpdated},
+		eventTypes(t, cooked.ID))
+	assert.Equal(t, []string{events.TypeCreated, events.TypeStatusChanged}, eventTypes(t, rejected.ID))
+	last, _ := orderEvents().Since(context.Background(), rejected.ID, 1)
+	if assert.Len(t, last, 1) {
+		assert.Equal(t, models.StatusReceived, last[0].PreviousStatus)
+		assert.Equal(t, "Out of cheese", last[0].Reason)
+	}
+}
+
+func TestGetOrderTicket(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.GET("/orders/:id/ticket", GetOrderTicket)
+
+	order := models.NewOrder()
+	order.CustomerName = "Ticket Tester"
+	outletID := uint(1)
+	order.OutletID = &outletID
+	order.TotalPrice = 25
+	order.OrderItems = []models.OrderItem{{ItemID: 1, Quantity: 2, Price: 12.5, Notes: "extra spicy"}}
+	database.DB.Create(order)
+
+	// Only those who may follow the order get its ticket.
+	req, _ := http.NewRequest("GET", "/orders/"+order.ID+"/ticket", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	req, _ = http.NewRequest("GET", "/orders/"+order.ID+"/ticket", nil)
+	req.Header.Set("Authorization", "Bearer "+trackingToken("ORD-other"))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	req, _ = http.NewRequest("GET", "/orders/"+order.ID+"/ticket?type=receipt&width=58", nil)
+	req.Header.Set("Authorization", "Bearer "+trackingToken(order.ID))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "Test Kitchen")
+	assert.Contains(t, w.Body.String(), "2 x Test Item")
+	assert.Contains(t, w.Body.String(), "25.00")
+
+	req, _ = http.NewRequest("GET", "/orders/"+order.ID+"/ticket?type=kitchen&format=escpos", nil)
+	req.Header.Set("Authorization", "Bearer "+trackingToken(order.ID))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, bytes.HasPrefix(w.Body.Bytes(), []byte{0x1b, '@'}))
+	assert.NotContains(t, w.Body.String(), "25.00")
+	assert.Contains(t, w.Body.String(), "extra spicy")
+
+	req, _ = http.NewRequest("GET", "/orders/"+order.ID+"/ticket?width=100", nil)
+	req.Header.Set("Authorization", "Bearer "+trackingToken(order.ID))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestGetOrderInvoice(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.POST("/orders", CreateOrder)
+	r.PATCH("/orders/:id/status", UpdateOrderStatus)
+	r.POST("/orders/:id/deliver", OverrideDelivery)
+	r.GET("/orders/:id/invoice", GetOrderInvoice)
+
+	pinClock(t, "2026-03-05 12:00")
+	payload := `{"customer_name":"Jane","customer_address":"1 Road","customer_phone":"1234567890","latitude":12.97,"longitude":77.59,"outlet_id":4,"items":[{"item_id":1,"quantity":1}]}`
+	req, _ := http.NewRequest("POST", "/orders", strings.NewReader(payload))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var order models.Order
+	json.Unmarshal(w.Body.Bytes(), &order)
+	assert.Nil(t, order.InvoiceNumber)
+	token := order.TrackingToken
+
+	req, _ = http.NewRequest("GET", "/orders/"+order.ID+"/invoice", nil)
+	req.Header.Set("Authorization", "Bearer "+order.TrackingToken)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	req, _ = http.NewRequest("PATCH", "/orders/"+order.ID+"/status", strings.NewReader(`{"status":"Preparing"}`))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	// Only the rider's pickup sends it out.
+	req, _ = http.NewRequest("PATCH", "/orders/"+order.ID+"/status", strings.NewReader(`{"status":"Out for Delivery"}`))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), codeRiderPickup)
+	database.DB.Model(&models.Order{}).Where("id = ?", order.ID).Update("status", models.StatusOutForDelivery)
+	req, _ = http.NewRequest("POST", "/orders/"+order.ID+"/deliver", strings.NewReader(`{"overridden_by":"ops","reason":"Rider phone died"}`))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	json.Unmarshal(w.Body.Bytes(), &order)
+	order.TrackingToken = token
+	if assert.NotNil(t, order.InvoiceNumber) {
+		assert.Equal(t, "INV/4/2025-26/000001", *order.InvoiceNumber)
+	}
+
+	req, _ = http.NewRequest("GET", "/orders/"+order.ID+"/invoice", nil)
+	req.Header.Set("Authorization", "Bearer "+order.TrackingToken)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "INV/4/2025-26/000001")
+	assert.Contains(t, w.Body.String(), "KDS Kitchen")
+
+	req, _ = http.NewRequest("GET", "/orders/"+order.ID+"/invoice?format=pdf", nil)
+	req.Header.Set("Authorization", "Bearer "+order.TrackingToken)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+	assert.True(t, bytes.HasPrefix(w.Body.Bytes(), []byte("%PDF-")))
+}
+
+func TestOrderAccess(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/orders", CreateOrder)
+	r.GET("/orders/:id", GetOrder)
+	r.POST("/orders/:id/cancel", CancelOrder)
+	r.GET("/users/:id/orders", GetUserOrders)
+
+	pinClock(t, "2026-03-05 12:00")
+	do := func(token, method, path string) *httptest.ResponseRecorder {
+		var body io.Reader
+		if method == "POST" && path == "/orders" {
+			body = strings.NewReader(`{"customer_name":"Jane","customer_address":"1 Road","customer_phone":"1234567890","latitude":12.97,"longitude":77.59,"outlet_id":4,"items":[{"item_id":1,"quantity":1}]}`)
+		}
+		req, _ := http.NewRequest(method, path, body)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	w := do(userToken(1), "POST", "/orders")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var order models.Order
+	json.Unmarshal(w.Body.Bytes(), &order)
+	guest := models.NewOrder()
+	assert.NoError(t, database.DB.Create(guest).Error)
+
+	for token, want := range map[string]int{
+		"":                      http.StatusUnauthorized,
+		userToken(2):            http.StatusForbidden,
+		trackingToken(guest.ID): http.StatusForbidden,
+		userToken(1):            http.StatusOK,
+		trackingToken(order.ID): http.StatusOK,
+		riderToken(99):          http.StatusForbidden,
+	} {
+		assert.Equal(t, want, do(token, "GET", "/orders/"+order.ID).Code, token)
+	}
+
+	// A customer's order list is found from their account, not their name.
+	assert.Equal(t, http.StatusUnauthorized, do("", "GET", "/users/1/orders").Code)
+	assert.Equal(t, http.StatusForbidden, do(userToken(2), "GET", "/users/1/orders").Code)
+	w = do(userToken(1), "GET", "/users/1/orders")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var mine []models.Order
+	json.Unmarshal(w.Body.Bytes(), &mine)
+	ids := make([]string, len(mine))
+	for i, o := range mine {
+		ids[i] = o.ID
+	}
+	assert.Contains(t, ids, order.ID)
+	assert.NotContains(t, ids, guest.ID)
+
+	// Only the customer or an admin may cancel, as that refunds it.
+	assert.Equal(t, http.StatusUnauthorized, do("", "POST", "/orders/"+order.ID+"/cancel").Code)
+	assert.Equal(t, http.StatusForbidden, do(userToken(2), "POST", "/orders/"+order.ID+"/cancel").Code)
+	assert.Equal(t, http.StatusOK, do(userToken(1), "POST", "/orders/"+order.ID+"/cancel").Code)
+	database.DB.Model(guest).Update("status", models.StatusCancelled)
+}
+
+func TestCreateOrder_Payments(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.POST("/orders", CreateOrder)
+
+	fake := payments.NewFake()
+	fake.Delay = 0
+	fake.OnSettle = PaymentSettled
+	payments.Default = fake
+	t.Cleanup(func() { payments.Default = payments.NewFake() })
+
+	pinClock(t, "2026-03-05 12:00")
+	place := func(method, token string) (int, models.Order) {
+		payload := `{"customer_name":"Jane","customer_address":"1 Road","customer_phone":"1234567890","latitude":12.97,"longitude":77.59,"outlet_id":4,` +
+			`"payment_method":"` + method + `","payment_token":"` + token + `","items":[{"item_id":1,"quantity":1}]}`
+		req, _ := http.NewRequest("POST", "/orders", strings.NewReader(payload))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var body struct {
+			models.Order
+			Nested *models.Order `json:"order"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		if body.Nested != nil {
+			return w.Code, *body.Nested
+		}
+		return w.Code, body.Order
+	}
+
+	code, order := place("card", "")
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, models.PaymentCaptured, order.PaymentStatus)
+	assert.Equal(t, models.StatusReceived, order.Status)
+	assert.NotNil(t, order.InvoiceNumber)
+
+	code, order = place("card", payments.TokenFail)
+	assert.Equal(t, http.StatusPaymentRequired, code)
+	assert.Equal(t, models.PaymentFailed, order.PaymentStatus)
+	assert.Equal(t, models.StatusCancelled, order.Status)
+	assert.Equal(t, []string{events.TypeCreated, events.TypePaymentUpdated, events.TypeCancelled}, eventTypes(t, order.ID))
+
+	code, order = place("Cash on Delivery", "")
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, models.PaymentPending, order.PaymentStatus)
+	assert.Equal(t, models.StatusReceived, order.Status)
+
+	code, order = place("upi", payments.TokenDelayed)
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, models.PaymentPending, order.PaymentStatus)
+	assert.Equal(t, models.StatusAwaitingPayment, order.Status)
+
+	_, err := fake.Settle(order.PaymentIntentID, true)
+	assert.NoError(t, err)
+	var settled models.Order
+	database.DB.First(&settled, "id = ?", order.ID)
+	assert.Equal(t, models.PaymentCaptured, settled.PaymentStatus)
+	assert.Equal(t, models.StatusReceived, settled.Status)
+	// Authorized, then captured and released to the kitchen.
+	assert.Equal(t, []string{events.TypeCreated, events.TypePaymentUpdated, events.TypePaymentUpdated, events.TypeStatusChanged}, eventTypes(t, order.ID))
+
+	// A repeated confirmation must not release the order twice.
+	PaymentSettled(payments.Intent{ID: order.PaymentIntentID, OrderID: order.ID, Status: payments.StatusCaptured})
+	var again models.Order
+	database.DB.First(&again, "id = ?", order.ID)
+	assert.Equal(t, settled.InvoiceNumber, again.InvoiceNumber)
+	assert.Len(t, eventTypes(t, order.ID), 4)
+}
+
+func TestPaymentWebhook(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.POST("/webhooks/payments", PaymentWebhook)
+	r.POST("/admin/webhooks/retry", RetryWebhooks)
+
+	t.Setenv("PAYMENT_WEBHOOK_SECRET", "whsec_test")
+	pinClock(t, "2026-03-05 12:00")
+
+	order := models.NewOrder()
+	order.Status = models.StatusAwaitingPayment
+	order.PaymentIntentID = "pi_webhook_1"
+	database.DB.Create(order)
+
+	send := func(body string, at time.Time, secret string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/webhooks/payments", strings.NewReader(body))
+		req.Header.Set(payments.TimestampHeader, strconv.FormatInt(at.Unix(), 10))
+		req.Header.Set(payments.SignatureHeader, payments.Sign([]byte(secret), at.Unix(), []byte(body)))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	captured := `{"id":"evt_1","type":"payment_intent.captured","provider":"fake","data":{"id":"pi_webhook_1","order_id":"` + order.ID + `","status":"Captured"}}`
+
+	w := send(captured, clock.Now(), "wrong")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = send(captured, clock.Now().Add(-10*time.Minute), "whsec_test")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = send(captured, clock.Now(), "whsec_test")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "processed")
+
+	var stored models.Order
+	database.DB.First(&stored, "id = ?", order.ID)
+	assert.Equal(t, models.PaymentCaptured, stored.PaymentStatus)
+	assert.Equal(t, models.StatusReceived, stored.Status)
+
+	w = send(captured, clock.Now(), "whsec_test")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "duplicate")
+
+	// An event for an intent we have not stored yet is queued and applied
+	// by a later retry.
+	early := `{"id":"evt_2","type":"payment_intent.captured","provider":"fake","data":{"id":"pi_webhook_2","status":"Captured"}}`
+	w = send(early, clock.Now(), "whsec_test")
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	var retry models.WebhookRetry
+	assert.NoError(t, database.DB.First(&retry, "event_id = ?", "evt_2").Error)
+	assert.Equal(t, 1, retry.Attempts)
+
+	late := models.NewOrder()
+	late.Status = models.StatusAwaitingPayment
+	late.PaymentIntentID = "pi_webhook_2"
+	database.DB.Create(late)
+
+	pinClock(t, "2026-03-05 12:05")
+	req, _ := http.NewRequest("POST", "/admin/webhooks/retry", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.JSONEq(t, `{"processed":1,"failed":0}`, w.Body.String())
+
+	var lateStored models.Order
+	database.DB.First(&lateStored, "id = ?", late.ID)
+	assert.Equal(t, models.PaymentCaptured, lateStored.PaymentStatus)
+	assert.Error(t, database.DB.First(&models.WebhookRetry{}, "event_id = ?", "evt_2").Error)
+}
+
+func TestRefunds(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.POST("/orders", CreateOrder)
+	r.GET("/orders/:id", GetOrder)
+	r.POST("/orders/:id/cancel", CancelOrder)
+	r.POST("/orders/:id/refunds", CreateRefund)
+
+	fake := payments.NewFake()
+	fake.Delay = 0
+	fake.OnSettle = PaymentSettled
+	payments.Default = fake
+	t.Cleanup(func() { payments.Default = payments.NewFake() })
+
+	t.Setenv("ADMIN_API_KEY", "secret")
+	pinClock(t, "2026-03-05 12:00")
+	do := func(method, path, payload string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(payload))
+		req.Header.Set("X-Admin-Key", "secret")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	place := func(method, token string) models.Order {
+		w := do("POST", "/orders", `{"customer_name":"Jane","customer_address":"1 Road","customer_phone":"1234567890","latitude":12.97,"longitude":77.59,"outlet_id":4,`+
+			`"payment_method":"`+method+`","payment_token":"`+token+`","items":[{"item_id":1,"quantity":3}]}`)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var order models.Order
+		json.Unmarshal(w.Body.Bytes(), &order)
+		return order
+	}
+
+	order := place("card", "")
+	line := order.OrderItems[0].ID
+	base := "/orders/" + order.ID
+
+	w := do("POST", base+"/refunds", fmt.Sprintf(`{"order_item_id":%d,"quantity":1,"reason":"Cold"}`, line))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var refunds []models.Refund
+	json.Unmarshal(w.Body.Bytes(), &refunds)
+	assert.Len(t, refunds, 1)
+	assert.Equal(t, 10.0, refunds[0].Amount)
+	assert.Equal(t, "card", refunds[0].Method)
+	assert.Equal(t, models.RefundSucceeded, refunds[0].Status)
+
+	w = do("POST", base+"/refunds", fmt.Sprintf(`{"order_item_id":%d,"quantity":3,"reason":"Cold"}`, line))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = do("POST", base+"/refunds", `{"amount":5,"reason":"Late"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = do("POST", base+"/refunds", `{"amount":100,"reason":"Late"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Cancelling refunds whatever is left.
+	w = do("POST", base+"/cancel", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var cancelled models.Order
+	json.Unmarshal(w.Body.Bytes(), &cancelled)
+	assert.Len(t, cancelled.Refunds, 3)
+	assert.Equal(t, 15.0, cancelled.Refunds[2].Amount)
+	assert.Equal(t, 30.0, cancelled.RefundedAmount)
+	assert.Equal(t, models.PaymentCaptured, cancelled.PaymentStatus)
+
+	w = do("GET", base, "")
+	var fetched models.Order
+	json.Unmarshal(w.Body.Bytes(), &fetched)
+	assert.Len(t, fetched.Refunds, 3)
+
+	w = do("POST", base+"/refunds", `{"reason":"Again"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Cash orders have nothing to refund.
+	cod := place("cod", "")
+	w = do("POST", "/orders/"+cod.ID+"/cancel", "")
+	json.Unmarshal(w.Body.Bytes(), &cancelled)
+	assert.Empty(t, cancelled.Refunds)
+
+	// A payment captured after the customer cancelled is refunded instead
+	// of releasing the order.
+	late := place("upi", payments.TokenDelayed)
+	do("POST", "/orders/"+late.ID+"/cancel", "")
+	_, err := fake.Settle(late.PaymentIntentID, true)
+	assert.NoError(t, err)
+	var stored models.Order
+	database.DB.Preload("Refunds").First(&stored, "id = ?", late.ID)
+	assert.Equal(t, models.StatusCancelled, stored.Status)
+	assert.Equal(t, 30.0, stored.RefundedAmount)
+	assert.Len(t, stored.Refunds, 1)
+
+	// A pickup landing after the cancel read the order wins: the order is
+	// neither cancelled nor refunded.
+	picked := place("card", "")
+	database.DB.Model(&models.Order{}).Where("id = ?", picked.ID).Update("status", models.StatusOutForDelivery)
+	w = httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("POST", "/orders/"+picked.ID+"/cancel", nil)
+	assert.False(t, cancelOrder(c, &picked))
+	assert.Equal(t, http.StatusConflict, w.Code)
+	var kept models.Order
+	database.DB.Preload("Refunds").First(&kept, "id = ?", picked.ID)
+	assert.Equal(t, models.StatusOutForDelivery, kept.Status)
+	assert.Empty(t, kept.Refunds)
+	database.DB.Model(&kept).Update("status", models.StatusDelivered)
+}
+
+func TestCreateOrder_SplitAndCashPayments(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.POST("/orders", CreateOrder)
+	r.POST("/orders/:id/cancel", CancelOrder)
+	r.POST("/orders/:id/collect", CollectCash)
+
+	fake := payments.NewFake()
+	fake.Delay = 0
+	payments.Default = fake
+	wallet := payments.NewMemoryWallet()
+	payments.DefaultWallet = wallet
+	t.Cleanup(func() {
+		payments.Default = payments.NewFake()
+		payments.DefaultWallet = payments.NewMemoryWallet()
+	})
+	ctx := context.Background()
+	wallet.Credit(ctx, 1, 25, "topup")
+
+	pinClock(t, "2026-03-05 12:00")
+	do := func(path, payload string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", path, strings.NewReader(payload))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	// token is who the order is placed as, if anyone.
+	token := userToken(1)
+	place := func(payment string) (int, models.Order) {
+		req, _ := http.NewRequest("POST", "/orders", strings.NewReader(`{"customer_name":"Jane","customer_address":"1 Road","customer_phone":"1234567890","latitude":12.97,"longitude":77.59,"outlet_id":4,`+
+			payment+`,"items":[{"item_id":1,"quantity":3}]}`))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var body struct {
+			models.Order
+			Nested *models.Order `json:"order"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		if body.Nested != nil {
+			return w.Code, *body.Nested
+		}
+		return w.Code, body.Order
+	}
+
+	code, _ := place(`"payment_method":"cheque"`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = place(`"payment_method":"card","user_id":2,"wallet_amount":10`)
+	assert.Equal(t, http.StatusForbidden, code)
+	code, _ = place(`"payment_method":"card","user_id":1,"wallet_amount":31`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = place(`"payment_method":"wallet","user_id":1`)
+	assert.Equal(t, http.StatusPaymentRequired, code)
+
+	// Wallet plus card: the card intent only covers the rest.
+	code, order := place(`"payment_method":"card","user_id":1,"wallet_amount":10`)
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, models.PaymentCaptured, order.PaymentStatus)
+	assert.Len(t, order.Payments, 2)
+	intent, _ := fake.Status(ctx, order.PaymentIntentID)
+	assert.Equal(t, 20.0, intent.Amount)
+	balance, _ := wallet.Balance(ctx, 1)
+	assert.Equal(t, 15.0, balance)
+
+	// Cancelling refunds each component to where it came from.
+	req, _ := http.NewRequest("POST", "/orders/"+order.ID+"/cancel", nil)
+	req.Header.Set("Authorization", "Bearer "+userToken(1))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var cancelled models.Order
+	json.Unmarshal(w.Body.Bytes(), &cancelled)
+	assert.Len(t, cancelled.Refunds, 2)
+	assert.Equal(t, 30.0, cancelled.RefundedAmount)
+	balance, _ = wallet.Balance(ctx, 1)
+	assert.Equal(t, 25.0, balance)
+
+	// Wallet plus cash: cooked straight away, paid once the rider collects.
+	code, order = place(`"payment_method":"cod","user_id":1,"wallet_amount":5`)
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, models.StatusReceived, order.Status)
+	assert.Equal(t, models.PaymentPending, order.PaymentStatus)
+
+	w = do("/orders/"+order.ID+"/collect", `{"amount":25,"collected_by":"rider-7"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	database.DB.Model(&order).Update("status", models.StatusOutForDelivery)
+	w = do("/orders/"+order.ID+"/collect", `{"amount":20,"collected_by":"rider-7"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	w = do("/orders/"+order.ID+"/collect", `{"amount":25,"collected_by":"rider-7"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var collected models.Order
+	json.Unmarshal(w.Body.Bytes(), &collected)
+	assert.Equal(t, models.PaymentCaptured, collected.PaymentStatus)
+
+	w = do("/orders/"+order.ID+"/collect", `{"amount":25,"collected_by":"rider-7"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// The wallet and user_id need the customer's own token.
+	token = ""
+	code, _ = place(`"payment_method":"wallet"`)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = place(`"payment_method":"card","user_id":1`)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	token = trackingToken(order.ID)
+	code, _ = place(`"payment_method":"wallet"`)
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func TestWalletLedger(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.POST("/orders", CreateOrder)
+	r.GET("/users/:id/wallet", GetWallet)
+	r.POST("/users/:id/wallet/credits", GrantCredit)
+	r.POST("/orders/:id/refunds", CreateRefund)
+	r.PATCH("/orders/:id/status", UpdateOrderStatus)
+
+	fake := payments.NewFake()
+	fake.Delay = 0
+	payments.Default = fake
+	payments.DefaultWallet = ledger()
+	t.Cleanup(func() {
+		payments.Default = payments.NewFake()
+		payments.DefaultWallet = payments.NewMemoryWallet()
+	})
+
+	pinClock(t, "2026-03-05 12:00")
+	doAs := func(token, method, path, payload string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(payload))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	do := func(method, path, payload string) *httptest.ResponseRecorder {
+		return doAs("", method, path, payload)
+	}
+	balance := func() float64 {
+		var body struct {
+			Balance      float64                    `json:"balance"`
+			Transactions []models.WalletTransaction `json:"transactions"`
+		}
+		w := doAs(userToken(1), "GET", "/users/1/wallet", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return body.Balance
+	}
+
+	grant := `{"amount":50,"reason":"Late delivery","reference":"ticket-881"}`
+	w := do("POST", "/users/1/wallet/credits", grant)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = do("POST", "/users/1/wallet/credits", grant)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = do("POST", "/users/1/wallet/credits", `{"amount":20,"reason":"Late delivery","reference":"ticket-881"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = do("POST", "/users/99/wallet/credits", grant)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, 50.0, balance())
+
+	// Only the customer and admins see the wallet.
+	w = do("GET", "/users/1/wallet", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = doAs(userToken(2), "GET", "/users/1/wallet", "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = doAs(userToken(1), "GET", "/users/99/wallet", "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	t.Setenv("ADMIN_API_KEY", "secret")
+	req, _ := http.NewRequest("GET", "/users/1/wallet", nil)
+	req.Header.Set("X-Admin-Key", "secret")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	place := func(payment string) models.Order {
+		w := doAs(userToken(1), "POST", "/orders", `{"customer_name":"Jane","customer_address":"1 Road","customer_phone":"1234567890","latitude":12.97,"longitude":77.59,"outlet_id":4,"user_id":1,`+
+			payment+`,"items":[{"item_id":1,"quantity":3}]}`)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var order models.Order
+		json.Unmarshal(w.Body.Bytes(), &order)
+		return order
+	}
+
+	order := place(`"payment_method":"wallet"`)
+	assert.Equal(t, models.PaymentCaptured, order.PaymentStatus)
+	assert.Equal(t, 20.0, balance())
+
+	// Cancelling through the status update refunds the order too.
+	w = do("PATCH", "/orders/"+order.ID+"/status", `{"status":"Cancelled"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 50.0, balance())
+	var cancelled models.Order
+	json.Unmarshal(w.Body.Bytes(), &cancelled)
+	assert.Equal(t, models.StatusCancelled, cancelled.Status)
+	assert.Len(t, cancelled.Refunds, 1)
+
+	// A card payment refunded as store credit lands in the wallet.
+	order = place(`"payment_method":"card"`)
+	w = do("POST", "/orders/"+order.ID+"/refunds", `{"reason":"Goodwill","to_wallet":true}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var refunds []models.Refund
+	json.Unmarshal(w.Body.Bytes(), &refunds)
+	assert.Equal(t, "card", refunds[0].Method)
+	assert.True(t, refunds[0].ToWallet)
+	assert.Equal(t, 80.0, balance())
+	intent, _ := fake.Status(context.Background(), order.PaymentIntentID)
+	assert.Equal(t, 0.0, intent.Refunded)
+}
+
+func TestLoyaltyPoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.POST("/orders", CreateOrder)
+	r.POST("/orders/:id/deliver", OverrideDelivery)
+	r.POST("/orders/:id/cancel", CancelOrder)
+	r.POST("/orders/:id/refunds", CreateRefund)
+	r.GET("/users/:id/loyalty", GetLoyalty)
+	r.PUT("/loyalty/rules", UpdateLoyaltyRules)
+
+	fake := payments.NewFake()
+	fake.Delay = 0
+	payments.Default = fake
+	t.Cleanup(func() {
+		payments.Default = payments.NewFake()
+		database.DB.Where("1 = 1").Delete(&models.LoyaltyRules{})
+	})
+
+	pinClock(t, "2026-03-05 12:00")
+	doAs := func(token, method, path, payload string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(payload))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	do := func(method, path, payload string) *httptest.ResponseRecorder {
+		return doAs("", method, path, payload)
+	}
+	type statement struct {
+		Balance   int                      `json:"balance"`
+		Lifetime  int                      `json:"lifetime_points"`
+		Tier      models.LoyaltyTier       `json:"tier"`
+		Movements []models.LoyaltyMovement `json:"movements"`
+	}
+	points := func() statement {
+		var s statement
+		w := doAs(userToken(1), "GET", "/users/1/loyalty", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		json.Unmarshal(w.Body.Bytes(), &s)
+		return s
+	}
+	place := func(extra string, quantity int) (int, models.Order) {
+		w := doAs(userToken(1), "POST", "/orders", fmt.Sprintf(`{"customer_name":"Jane","customer_address":"1 Road","customer_phone":"1234567890","latitude":12.97,"longitude":77.59,"outlet_id":4,"user_id":1,`+
+			`"payment_method":"card"%s,"items":[{"item_id":1,"quantity":%d}]}`, extra, quantity))
+		var order models.Order
+		json.Unmarshal(w.Body.Bytes(), &order)
+		return w.Code, order
+	}
+
+	w := do("PUT", "/loyalty/rules", `{"points_per_rupee":1,"point_value":0.5,"max_redeem_percent":50,"tiers":[{"name":"Member","min_points":0,"multiplier":1},{"name":"VIP","min_points":100,"multiplier":2}]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = do("PUT", "/loyalty/rules", `{"points_per_rupee":1,"point_value":0.5,"tiers":[{"name":"VIP","min_points":100,"multiplier":2}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Points are only earned on delivery, and only once.
+	_, order := place("", 10)
+	assert.Equal(t, 0, points().Balance)
+	database.DB.Model(&models.Order{}).Where("id = ?", order.ID).Update("status", models.StatusOutForDelivery)
+	do("POST", "/orders/"+order.ID+"/deliver", `{"overridden_by":"ops","reason":"Rider phone died"}`)
+	do("POST", "/orders/"+order.ID+"/deliver", `{"overridden_by":"ops","reason":"Rider phone died"}`)
+	s := points()
+	assert.Equal(t, 100, s.Balance)
+	assert.Equal(t, "VIP", s.Tier.Name)
+
+	// A refund takes back the matching share of the points.
+	w = do("POST", "/orders/"+order.ID+"/refunds", `{"amount":25,"reason":"Missing item"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, 75, points().Balance)
+
+	code, _ := place(`,"redeem_points":500`, 1)
+	assert.Equal(t, http.StatusPaymentRequired, code)
+
+	// Points are the token's customer's, whatever the body says.
+	w = doAs(userToken(2), "POST", "/orders", `{"customer_name":"Jane","customer_address":"1 Road","customer_phone":"1234567890","latitude":12.97,"longitude":77.59,"outlet_id":4,`+
+		`"payment_method":"card","redeem_points":40,"items":[{"item_id":1,"quantity":3}]}`)
+	assert.Equal(t, http.StatusPaymentRequired, w.Code)
+	w = do("GET", "/users/1/loyalty", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = doAs(userToken(2), "GET", "/users/1/loyalty", "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Redemption is a discount capped at half the order.
+	code, order = place(`,"redeem_points":40`, 3)
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, 30, order.PointsRedeemed)
+	assert.Equal(t, 15.0, order.Discount)
+	assert.Equal(t, 15.0, order.TotalPrice)
+	assert.Equal(t, 45, points().Balance)
+
+	// Cancelling gives the redeemed points back.
+	doAs(userToken(1), "POST", "/orders/"+order.ID+"/cancel", "")
+	s = points()
+	assert.Equal(t, 75, s.Balance)
+	kinds := []string{}
+	for _, m := range s.Movements {
+		kinds = append(kinds, m.Kind)
+	}
+	assert.Equal(t, []string{models.PointsEarned, models.PointsReversed, models.PointsRedeemed, models.PointsRestored}, kinds)
+}
+
+func TestGiftCards(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.POST("/orders", CreateOrder)
+	r.POST("/orders/:id/refunds", CreateRefund)
+	r.POST("/gift-cards", IssueGiftCard)
+	r.POST("/gift-cards/lookup", LookupGiftCard)
+	r.GET("/gift-cards/:id", GetGiftCard)
+	r.POST("/gift-cards/:id/void", VoidGiftCard)
+
+	fake := payments.NewFake()
+	fake.Delay = 0
+	payments.Default = fake
+	t.Cleanup(func() { payments.Default = payments.NewFake() })
+
+	pinClock(t, "2026-03-05 12:00")
+	do := func(method, path, payload string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(payload))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	var issued struct {
+		GiftCard models.GiftCard `json:"gift_card"`
+		Code     string          `json:"code"`
+	}
+	w := do("POST", "/gift-cards", `{"amount":50,"reference":"sale-42"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &issued)
+	assert.NotEmpty(t, issued.Code)
+	assert.NotContains(t, w.Body.String(), "code_hash")
+	w = do("POST", "/gift-cards", `{"amount":50,"reference":"sale-42"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), issued.Code)
+
+	card := func() models.GiftCard {
+		var c models.GiftCard
+		w := do("POST", "/gift-cards/lookup", fmt.Sprintf(`{"code":%q}`, strings.ToLower(issued.Code)))
+		assert.Equal(t, http.StatusOK, w.Code)
+		json.Unmarshal(w.Body.Bytes(), &c)
+		return c
+	}
+	place := func(payment string, quantity int) (int, models.Order) {
+		w := do("POST", "/orders", fmt.Sprintf(`{"customer_name":"Jane","customer_address":"1 Road","customer_phone":"1234567890","latitude":12.97,"longitude":77.59,"outlet_id":4,`+
+			`%s,"items":[{"item_id":1,"quantity":%d}]}`, payment, quantity))
+		var order models.Order
+		json.Unmarshal(w.Body.Bytes(), &order)
+		return w.Code, order
+	}
+
+	// The card pays what it can and the card payment covers the rest.
+	code, order := place(fmt.Sprintf(`"payment_method":"card","gift_card_code":%q,"gift_card_amount":20`, issued.Code), 3)
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Len(t, order.Payments, 2)
+	assert.Equal(t, 30.0, card().Balance)
+
+	code, order = place(fmt.Sprintf(`"payment_method":"gift_card","gift_card_code":%q`, issued.Code), 3)
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, models.PaymentCaptured, order.PaymentStatus)
+	assert.Equal(t, 0.0, card().Balance)
+
+	code, _ = place(fmt.Sprintf(`"payment_method":"gift_card","gift_card_code":%q`, issued.Code), 1)
+	assert.Equal(t, http.StatusPaymentRequired, code)
+	code, _ = place(`"payment_method":"gift_card","gift_card_code":"NOPE-NOPE-NOPE-NOPE"`, 1)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// Refunds go back onto the card.
+	w = do("POST", "/orders/"+order.ID+"/refunds", `{"amount":10,"reason":"Cold"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, 10.0, card().Balance)
+
+	w = do("POST", fmt.Sprintf("/gift-cards/%d/void", issued.GiftCard.ID), `{"reason":"Chargeback"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	code, _ = place(fmt.Sprintf(`"payment_method":"card","gift_card_code":%q`, issued.Code), 1)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	w = do("GET", fmt.Sprintf("/gift-cards/%d", issued.GiftCard.ID), "")
+	var stored models.GiftCard
+	json.Unmarshal(w.Body.Bytes(), &stored)
+	assert.Equal(t, models.GiftCardVoid, stored.Status)
+	kinds := []string{}
+	for _, txn := range stored.Transactions {
+		kinds = append(kinds, txn.Kind)
+	}
+	assert.Equal(t, []string{"issue", "redeem", "redeem", "refund", "void"}, kinds)
+}
+
+func TestOrderEventStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/orders/:id/events", GetOrderEvents)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	keepAlive := sseKeepAlive
+	sseKeepAlive = 50 * time.Millisecond
+	t.Cleanup(func() { sseKeepAlive = keepAlive })
+
+	order := models.NewOrder()
+	order.CustomerName = "Jane"
+	assert.NoError(t, database.DB.Create(order).Error)
+
+	open := func(query, lastEventID string) (*bufio.Reader, func()) {
+		ctx, cancel := context.WithCancel(context.Background())
+		req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/orders/"+order.ID+"/events"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+trackingToken(order.ID))
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+			t.FailNow()
+		}
+		return bufio.NewReader(resp.Body), func() { cancel(); resp.Body.Close() }
+	}
+	// next returns the next event or comment, without its blank line.
+	next := func(r *bufio.Reader) string {
+		var lines []string
+		for {
+			line, err := r.ReadString('\n')
+			if !assert.NoError(t, err) {
+				t.FailNow()
+			}
+			if line == "\n" {
+				if len(lines) > 0 {
+					return strings.Join(lines, "")
+				}
+				continue
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	stream, stop := open("", "")
+	assert.Equal(t, "retry: 3000\n", next(stream))
+	assert.Contains(t, next(stream), `"type":"order.snapshot"`)
+	publish(events.StatusChanged(models.Order{ID: order.ID, Status: models.StatusPreparing}, ""))
+	event := next(stream)
+	assert.Contains(t, event, "id: 1\n")
+	assert.Contains(t, event, `"v":2,"seq":1,"type":"order.status_changed","orderId":"`+order.ID+`","status":"Preparing"`)
+	assert.Equal(t, ": keepalive\n", next(stream))
+	stop()
+
+	// Events sent while the client was away are replayed on resume.
+	publish(events.StatusChanged(models.Order{ID: order.ID, Status: models.StatusOutForDelivery}, ""))
+	publish(events.StatusChanged(models.Order{ID: order.ID, Status: models.StatusDelivered}, ""))
+	stream, stop = open("", "1")
+	assert.Equal(t, "retry: 3000\n", next(stream))
+	assert.Contains(t, next(stream), "id: 2\n")
+	assert.Contains(t, next(stream), "id: 3\n")
+	assert.Equal(t, ": keepalive\n", next(stream))
+	stop()
+
+	stream, stop = open("?since=3", "")
+	defer stop()
+	assert.Equal(t, "retry: 3000\n", next(stream))
+	assert.Equal(t, ": keepalive\n", next(stream))
+
+	for path, code := range map[string]int{
+		"/orders/" + order.ID + "/events?since=abc&token=" + trackingToken(order.ID): http.StatusBadRequest,
+		"/orders/" + order.ID + "/events":                                            http.StatusUnauthorized,
+		"/orders/" + order.ID + "/events?token=" + trackingToken("other"):            http.StatusForbidden,
+		"/orders/missing/events?token=" + trackingToken("missing"):                   http.StatusNotFound,
+	} {
+		resp, err := http.Get(srv.URL + path)
+		assert.NoError(t, err)
+		assert.Equal(t, code, resp.StatusCode, path)
+		resp.Body.Close()
+	}
+}
+
+func TestStreamSubscriptions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/ws", StreamWS)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+	os.Setenv("ADMIN_API_KEY", "kitchen-key")
+	t.Cleanup(func() { os.Unsetenv("ADMIN_API_KEY") })
+
+	var user models.User
+	database.DB.First(&user)
+	mine := models.NewOrder()
+	mine.UserID = &user.ID
+	theirs := models.NewOrder()
+	assert.NoError(t, database.DB.Create(mine).Error)
+	assert.NoError(t, database.DB.Create(theirs).Error)
+
+	_, resp, err := gorillaws.DefaultDialer.Dial(url, nil)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	conn, _, err := gorillaws.DefaultDialer.Dial(url+"?token="+userToken(user.ID), nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	send := func(op, topic string) websocket.Reply {
+		assert.NoError(t, conn.WriteJSON(websocket.Control{Op: op, Topic: topic, ID: topic}))
+		var reply websocket.Reply
+		assert.NoError(t, conn.ReadJSON(&reply))
+		return reply
+	}
+
+	userTopic := fmt.Sprintf("user:%d", user.ID)
+	// Only order topics keep the history to resume from.
+	since := int64(0)
+	assert.NoError(t, conn.WriteJSON(websocket.Control{Op: "subscribe", Topic: userTopic, Since: &since}))
+	var refused websocket.Reply
+	assert.NoError(t, conn.ReadJSON(&refused))
+	assert.Equal(t, "error", refused.Type)
+	assert.Contains(t, refused.Error, "since")
+
+	assert.Equal(t, "subscribed", send("subscribe", "order:"+mine.ID).Type)
+	assert.Equal(t, "subscribed", send("subscribe", userTopic).Type)
+	for _, topic := range []string{"order:" + theirs.ID, "user:999", "kitchen:4", "menu:1"} {
+		reply := send("subscribe", topic)
+		assert.Equal(t, "error", reply.Type, topic)
+		assert.Equal(t, topic, reply.ID)
+	}
+
+	// One status change reaches both of the customer's topics.
+	publish(events.StatusChanged(models.Order{ID: mine.ID, Status: models.StatusPreparing}, ""))
+	publish(events.StatusChanged(models.Order{ID: theirs.ID, Status: models.StatusPreparing}, ""))
+	topics := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		var reply websocket.Reply
+		assert.NoError(t, conn.ReadJSON(&reply))
+		assert.Equal(t, "message", reply.Type)
+		assert.Contains(t, string(reply.Data), mine.ID)
+		topics[reply.Topic] = true
+	}
+	assert.Equal(t, map[string]bool{"order:" + mine.ID: true, userTopic: true}, topics)
+
+	assert.Equal(t, "unsubscribed", send("unsubscribe", userTopic).Type)
+	publish(events.StatusChanged(models.Order{ID: mine.ID, Status: models.StatusReady}, ""))
+	var reply websocket.Reply
+	assert.NoError(t, conn.ReadJSON(&reply))
+	assert.Equal(t, "order:"+mine.ID, reply.Topic)
+	assert.Equal(t, "pong", send("ping", "").Type)
+
+	// The admin key is only taken from the header.
+	_, resp, err = gorillaws.DefaultDialer.Dial(url+"?admin_key=kitchen-key", nil)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// A kitchen display may follow its own outlet only.
+	display, _, err := gorillaws.DefaultDialer.Dial(url+"?token="+kitchenToken(4), nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer display.Close()
+	display.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for topic, want := range map[string]string{"kitchen:4": "subscribed", "kitchen:1": "error", "order:" + mine.ID: "error"} {
+		assert.NoError(t, display.WriteJSON(websocket.Control{Op: "subscribe", Topic: topic}))
+		assert.NoError(t, display.ReadJSON(&reply))
+		assert.Equal(t, want, reply.Type, topic)
+	}
+}
+
+func TestRiderDelivery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/orders", CreateOrder)
+	r.POST("/kitchen/orders/:id/accept", RequireAdmin, AcceptOrder)
+	r.POST("/kitchen/orders/:id/ready", RequireAdmin, MarkOrderReady)
+	r.POST("/admin/riders", RequireAdmin, CreateRider)
+	rider := r.Group("/rider", RequireRider)
+	rider.POST("/availability", SetRiderAvailability)
+	rider.GET("/orders", GetRiderOrders)
+	rider.POST("/orders/:id/accept", AcceptDelivery)
+	rider.POST("/orders/:id/pickup", PickUpOrder)
+	rider.POST("/orders/:id/deliver", DeliverOrder)
+
+	t.Setenv("ADMIN_API_KEY", "secret")
+	pinClock(t, "2026-03-05 12:00")
+	// Earlier tests leave ready orders behind, which riders here would pick up.
+	database.DB.Model(&models.Order{}).Where("status = ?", models.StatusReady).Update("status", models.StatusDelivered)
+
+	call := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-Admin-Key", "secret")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	hire := func(name, phone string) (models.Rider, string) {
+		w := call("POST", "/admin/riders", "", `{"name":"`+name+`","phone":"`+phone+`"}`)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var body struct {
+			Rider models.Rider `json:"rider"`
+			Token string       `json:"token"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return body.Rider, body.Token
+	}
+	ready := func() models.Order {
+		payload := `{"customer_name":"Jane","customer_address":"1 Road","customer_phone":"1234567890","latitude":12.97,"longitude":77.59,"outlet_id":4,"items":[{"item_id":1,"quantity":1}]}`
+		w := call("POST", "/orders", "", payload)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var order models.Order
+		json.Unmarshal(w.Body.Bytes(), &order)
+		assert.Equal(t, http.StatusOK, call("POST", "/kitchen/orders/"+order.ID+"/accept", "", "").Code)
+		assert.Equal(t, http.StatusOK, call("POST", "/kitchen/orders/"+order.ID+"/ready", "", "").Code)
+		database.DB.First(&order, "id = ?", order.ID)
+		return order
+	}
+	riderOf := func(order models.Order) uint {
+		database.DB.First(&order, "id = ?", order.ID)
+		if order.RiderID == nil {
+			return 0
+		}
+		return *order.RiderID
+	}
+	codeOf := func(order models.Order) string {
+		database.DB.First(&order, "id = ?", order.ID)
+		return `{"code":"` + order.DeliveryCode + `"}`
+	}
+
+	far, farToken := hire("Arjun", "9000000001")
+	near, nearToken := hire("Bela", "9000000002")
+	assert.Equal(t, http.StatusConflict, call("POST", "/admin/riders", "", `{"name":"Bela","phone":"9000000002"}`).Code)
+	assert.Equal(t, http.StatusUnauthorized, call("GET", "/rider/orders", "", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, call("GET", "/rider/orders", trackingToken("x"), "").Code)
+
+	assert.Equal(t, http.StatusOK, call("POST", "/rider/availability", farToken, `{"available":true,"lat":12.99,"lng":77.62}`).Code)
+	assert.Equal(t, http.StatusOK, call("POST", "/rider/availability", nearToken, `{"available":true,"lat":12.9726,"lng":77.5950}`).Code)
+	assert.Equal(t, http.StatusBadRequest, call("POST", "/rider/availability", nearToken, `{"available":true,"lat":95,"lng":0}`).Code)
+
+	// The nearest rider gets the first order.
+	first := ready()
+	assert.Equal(t, near.ID, riderOf(first))
+	assert.Equal(t, http.StatusNotFound, call("POST", "/rider/orders/"+first.ID+"/accept", farToken, "").Code)
+	assert.Equal(t, http.StatusConflict, call("POST", "/rider/orders/"+first.ID+"/pickup", nearToken, "").Code)
+	assert.Equal(t, http.StatusOK, call("POST", "/rider/orders/"+first.ID+"/accept", nearToken, "").Code)
+	assert.Equal(t, http.StatusConflict, call("POST", "/rider/orders/"+first.ID+"/deliver", nearToken, codeOf(first)).Code)
+	assert.Equal(t, http.StatusOK, call("POST", "/rider/orders/"+first.ID+"/pickup", nearToken, "").Code)
+	w := call("POST", "/rider/orders/"+first.ID+"/deliver", nearToken, codeOf(first))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var delivered models.Order
+	json.Unmarshal(w.Body.Bytes(), &delivered)
+	assert.Equal(t, models.StatusDelivered, delivered.Status)
+	assert.Equal(t, models.DeliveredWithCode, delivered.DeliveredWith)
+	assert.NotNil(t, delivered.DeliveredAt)
+	trail, _ := orderEvents().Since(context.Background(), first.ID, 0)
+	if assert.Greater(t, len(trail), 3) {
+		trail = trail[len(trail)-3:]
+		assert.Equal(t, events.TypeRiderAssigned, trail[0].Type)
+		assert.Equal(t, "Bela", trail[0].Rider.Name)
+		assert.Equal(t, models.StatusOutForDelivery, trail[1].Status)
+		assert.Equal(t, models.StatusDelivered, trail[2].Status)
+	}
+
+	// Round robin turns to the rider who has not had an order yet.
+	dispatcher = dispatch.RoundRobin{}
+	t.Cleanup(func() { dispatcher = dispatch.Nearest{} })
+	second := ready()
+	assert.Equal(t, far.ID, riderOf(second))
+
+	// With Bela off shift and Arjun full, the next order waits for Arjun.
+	assert.Equal(t, http.StatusOK, call("POST", "/rider/availability", nearToken, `{"available":false}`).Code)
+	third := ready()
+	assert.Zero(t, riderOf(third))
+	w = call("GET", "/rider/orders", farToken, "")
+	var open []models.Order
+	json.Unmarshal(w.Body.Bytes(), &open)
+	if assert.Len(t, open, 1) {
+		assert.Equal(t, second.ID, open[0].ID)
+	}
+	assert.Equal(t, http.StatusOK, call("POST", "/rider/orders/"+second.ID+"/accept", farToken, "").Code)
+	assert.Equal(t, http.StatusOK, call("POST", "/rider/orders/"+second.ID+"/pickup", farToken, "").Code)
+	assert.Equal(t, http.StatusOK, call("POST", "/rider/orders/"+second.ID+"/deliver", farToken, codeOf(second)).Code)
+	assert.Equal(t, far.ID, riderOf(third))
+
+	// Going off shift hands back orders not yet accepted.
+	assert.Equal(t, http.StatusOK, call("POST", "/rider/availability", farToken, `{"available":false}`).Code)
+	assert.Zero(t, riderOf(third))
+
+	// At an outlet without a display, the simulated kitchen hands the
+	// order to a rider once it is ready.
+	assert.Equal(t, http.StatusOK, call("POST", "/rider/availability", nearToken, `{"available":true,"lat":12.9726,"lng":77.5950}`).Code)
+	assert.Equal(t, near.ID, riderOf(third))
+	assert.Equal(t, http.StatusOK, call("POST", "/rider/availability", farToken, `{"available":true,"lat":12.99,"lng":77.62}`).Code)
+	simulatedOutlet := uint(1)
+	lat, lng := 12.97, 77.59
+	cooked := models.NewOrder()
+	cooked.Status, cooked.OutletID = models.StatusPreparing, &simulatedOutlet
+	cooked.DeliveryLat, cooked.DeliveryLng = &lat, &lng
+	assert.NoError(t, database.DB.Create(cooked).Error)
+	assert.True(t, advanceSimulation(cooked, models.StatusReady))
+	assert.Equal(t, far.ID, riderOf(*cooked))
+}
+
+func TestRiderTracking(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/orders/:id/track", GetOrderTrack)
+	rider := r.Group("/rider", RequireRider)
+	rider.POST("/location", RecordRiderLocation)
+	rider.GET("/ws", RiderWS)
+	rider.POST("/orders/:id/deliver", DeliverOrder)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	now := time.Date(2026, 3, 5, 6, 30, 0, 0, time.UTC)
+	clock.Now = func() time.Time { return now }
+	config, throttle := trackingConfig, locationThrottle
+	trackingConfig.TrackLength = 2
+	locationThrottle = tracking.NewThrottle(trackingConfig.PublishEvery)
+	t.Cleanup(func() {
+		clock.Now = time.Now
+		trackingConfig, locationThrottle = config, throttle
+	})
+
+	courier := models.Rider{Name: "Chitra", Phone: "9000000101", Available: true}
+	assert.NoError(t, database.DB.Create(&courier).Error)
+	token := riderToken(courier.ID)
+	dropLat, dropLng := 13.0, 77.5946
+	order := models.NewOrder()
+	order.Status = models.StatusOutForDelivery
+	order.RiderID, order.RiderAcceptedAt = &courier.ID, &now
+	order.DeliveryLat, order.DeliveryLng = &dropLat, &dropLng
+	order.DeliveryCode = "4821"
+	assert.NoError(t, database.DB.Create(order).Error)
+
+	sub := websocket.GlobalHub.Subscribe(order.ID)
+	defer sub.Close()
+	received := func() []events.Event {
+		var got []events.Event
+		for {
+			select {
+			case msg := <-sub.Messages():
+				var ev events.Event
+				json.Unmarshal(msg, &ev)
+				got = append(got, ev)
+			default:
+				return got
+			}
+		}
+	}
+	ping := func(body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/rider/location", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	stored := func() models.Order {
+		var o models.Order
+		database.DB.First(&o, "id = ?", order.ID)
+		return o
+	}
+
+	// The first ping places the rider about 3.2 km out, at the default speed.
+	w := ping(`{"lat":12.9716,"lng":77.5946}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"kept":true}`, w.Body.String())
+	got := received()
+	if assert.Len(t, got, 2) {
+		assert.Equal(t, events.TypeRiderLocation, got[0].Type)
+		assert.Zero(t, got[0].Seq)
+		assert.Equal(t, 12.9716, got[0].Location.Lat)
+		assert.Equal(t, events.TypeETAUpdated, got[1].Type)
+	}
+	first := *stored().EstimatedDeliveryAt
+	assert.InDelta(t, 560, first.Sub(now).Seconds(), 20)
+
+	// Standing still a moment later is sampled away.
+	now = now.Add(2 * time.Second)
+	assert.JSONEq(t, `{"kept":false}`, ping(`{"lat":12.97161,"lng":77.5946}`).Body.String())
+	assert.Empty(t, received())
+
+	// A kilometre in a minute is fast: the estimate comes well forward.
+	now = now.Add(time.Minute)
+	assert.JSONEq(t, `{"kept":true}`, ping(`{"lat":12.9806,"lng":77.5946,"speed_kmh":55}`).Body.String())
+	got = received()
+	assert.Len(t, got, 2)
+	assert.True(t, stored().EstimatedDeliveryAt.Before(first.Add(-5*time.Minute)))
+
+	// Moving on soon after is kept, but the customer is not told again yet.
+	now = now.Add(3 * time.Second)
+	assert.JSONEq(t, `{"kept":true}`, ping(`{"lat":12.9812,"lng":77.5946}`).Body.String())
+	for _, ev := range received() {
+		assert.NotEqual(t, events.TypeRiderLocation, ev.Type)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, ping(`{"lat":95,"lng":0}`).Code)
+	assert.Equal(t, http.StatusBadRequest, ping(`{"lng":77.5}`).Code)
+
+	// Only the latest pings are kept, oldest first.
+	req, _ := http.NewRequest("GET", "/orders/"+order.ID+"/track?token="+trackingToken(order.ID), nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var track []models.RiderPing
+	json.Unmarshal(w.Body.Bytes(), &track)
+	if assert.Len(t, track, 2) {
+		assert.Equal(t, 12.9806, track[0].Lat)
+		assert.Equal(t, 12.9812, track[1].Lat)
+	}
+
+	// Pings also arrive over the rider's socket, next to their offers.
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/rider/ws?token=" + token
+	conn, _, err := gorillaws.DefaultDialer.Dial(url, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	now = now.Add(time.Minute)
+	assert.NoError(t, conn.WriteMessage(gorillaws.TextMessage, []byte(`{"lat":12.99,"lng":77.5946}`)))
+	var ack map[string]interface{}
+	assert.NoError(t, conn.ReadJSON(&ack))
+	assert.Equal(t, map[string]interface{}{"type": "ack", "kept": true}, ack)
+	assert.NoError(t, conn.WriteMessage(gorillaws.TextMessage, []byte(`not json`)))
+	assert.NoError(t, conn.ReadJSON(&ack))
+	assert.Equal(t, "error", ack["type"])
+	database.DB.First(&courier, courier.ID)
+	assert.Equal(t, 12.99, *courier.Lat)
+
+	// Delivery ends the track.
+	req, _ = http.NewRequest("POST", "/rider/orders/"+order.ID+"/deliver", strings.NewReader(`{"code":"4821"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	remaining, _ := orderTrack(order.ID)
+	assert.Empty(t, remaining)
+}
+
+func TestDeliveryConfirmation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/orders/:id/delivery-code", GetDeliveryCode)
+	rider := r.Group("/rider", RequireRider)
+	rider.POST("/orders/:id/pickup", PickUpOrder)
+	rider.POST("/orders/:id/deliver", DeliverOrder)
+	rider.POST("/orders/:id/proof", SubmitDeliveryProof)
+	admin := r.Group("/admin", RequireAdmin)
+	admin.POST("/orders/:id/deliver", OverrideDelivery)
+	admin.GET("/orders/:id/proofs", GetDeliveryProofs)
+	admin.GET("/orders/:id/proofs/:proof", GetDeliveryProofFile)
+
+	t.Setenv("ADMIN_API_KEY", "secret")
+	pinClock(t, "2026-03-05 12:00")
+	store := storage.Default
+	storage.Default = storage.NewMemory()
+	t.Cleanup(func() { storage.Default = store })
+
+	courier := models.Rider{Name: "Dev", Phone: "9000000201", Available: true}
+	assert.NoError(t, database.DB.Create(&courier).Error)
+	token := riderToken(courier.ID)
+	newOrder := func(status string) *models.Order {
+		now := clock.Now()
+		order := models.NewOrder()
+		order.Status = status
+		order.RiderID, order.RiderAcceptedAt = &courier.ID, &now
+		assert.NoError(t, database.DB.Create(order).Error)
+		return order
+	}
+	call := func(method, path, auth, contentType string, body io.Reader) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, body)
+		if auth == "admin" {
+			req.Header.Set("X-Admin-Key", "secret")
+		} else if auth != "" {
+			req.Header.Set("Authorization", "Bearer "+auth)
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	deliver := func(order *models.Order, code string) *httptest.ResponseRecorder {
+		return call("POST", "/rider/orders/"+order.ID+"/deliver", token, "application/json", strings.NewReader(`{"code":"`+code+`"}`))
+	}
+	upload := func(order *models.Order, kind string, data []byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		form.WriteField("kind", kind)
+		part, _ := form.CreateFormFile("file", "proof")
+		part.Write(data)
+		form.Close()
+		return call("POST", "/rider/orders/"+order.ID+"/proof", token, form.FormDataContentType(), &body)
+	}
+
+	// The code is made at pickup and shown to the customer alone.
+	order := newOrder(models.StatusReady)
+	customer := trackingToken(order.ID)
+	assert.Equal(t, http.StatusConflict, call("GET", "/orders/"+order.ID+"/delivery-code", customer, "", nil).Code)
+	w := call("POST", "/rider/orders/"+order.ID+"/pickup", token, "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "code")
+	w = call("GET", "/orders/"+order.ID+"/delivery-code", customer, "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var shown struct{ Code string }
+	json.Unmarshal(w.Body.Bytes(), &shown)
+	assert.Regexp(t, `^\d{4}$`, shown.Code)
+	assert.Equal(t, http.StatusForbidden, call("GET", "/orders/"+order.ID+"/delivery-code", token, "", nil).Code)
+	assert.Equal(t, http.StatusForbidden, call("GET", "/orders/"+order.ID+"/delivery-code", "admin", "", nil).Code)
+	assert.Equal(t, http.StatusForbidden, call("GET", "/orders/"+order.ID+"/delivery-code", trackingToken("other"), "", nil).Code)
+
+	// Wrong codes count down, and then even the right one is refused. Until
+	// then, a proof is no way around the code.
+	wrong := fmt.Sprintf("%04d", (mustAtoi(t, shown.Code)+1)%10000)
+	w = deliver(order, wrong)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), `"tries_left":4`)
+	for i := 0; i < 3; i++ {
+		deliver(order, wrong)
+	}
+	w = upload(order, "photo", []byte("\xff\xd8\xff\xe0photo"))
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), codeDeliveryCodeFirst)
+	deliver(order, wrong)
+	w = deliver(order, shown.Code)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), codeDeliveryCodeLocked)
+
+	// A signature completes it instead, and admins can look at it.
+	assert.Equal(t, http.StatusBadRequest, upload(order, "selfie", []byte("\x89PNG\r\n\x1a\n")).Code)
+	assert.Equal(t, http.StatusUnsupportedMediaType, upload(order, "signature", []byte("<svg></svg>")).Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, upload(order, "photo", make([]byte, maxProofBytes+1)).Code)
+	signature := []byte("\x89PNG\r\n\x1a\nsigned")
+	w = upload(order, "signature", signature)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var delivered models.Order
+	json.Unmarshal(w.Body.Bytes(), &delivered)
+	assert.Equal(t, models.StatusDelivered, delivered.Status)
+	assert.Equal(t, models.DeliveredWithSignature, delivered.DeliveredWith)
+	assert.Equal(t, http.StatusConflict, upload(order, "signature", signature).Code)
+
+	w = call("GET", "/admin/orders/"+order.ID+"/proofs", "admin", "", nil)
+	var record struct {
+		DeliveredWith string                 `json:"delivered_with"`
+		Proofs        []models.DeliveryProof `json:"proofs"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &record)
+	assert.Equal(t, models.DeliveredWithSignature, record.DeliveredWith)
+	if assert.Len(t, record.Proofs, 1) {
+		w = call("GET", fmt.Sprintf("/admin/orders/%s/proofs/%d", order.ID, record.Proofs[0].ID), "admin", "", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+		assert.Equal(t, signature, w.Body.Bytes())
+	}
+
+	// Admins can override, saying who and why.
+	stuck := newOrder(models.StatusOutForDelivery)
+	assert.Equal(t, http.StatusBadRequest, call("POST", "/admin/orders/"+stuck.ID+"/deliver", "admin", "application/json", strings.NewReader(`{"overridden_by":"ops"}`)).Code)
+	override := `{"overridden_by":"ops","reason":"Customer confirmed by phone"}`
+	w = call("POST", "/admin/orders/"+stuck.ID+"/deliver", "admin", "application/json", strings.NewReader(override))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"delivered_with":"override"`)
+	assert.Equal(t, http.StatusConflict, call("POST", "/admin/orders/"+stuck.ID+"/deliver", "admin", "application/json", strings.NewReader(override)).Code)
+	var audit []models.DeliveryOverride
+	database.DB.Where("order_id = ?", stuck.ID).Find(&audit)
+	if assert.Len(t, audit, 1) {
+		assert.Equal(t, "ops", audit[0].OverriddenBy)
+		assert.Equal(t, "Customer confirmed by phone", audit[0].Reason)
+		assert.Equal(t, courier.ID, *audit[0].RiderID)
+	}
+}
+
+func mustAtoi(t *testing.T, s string) int {
+	n, err := strconv.Atoi(s)
+	assert.NoError(t, err)
+	return n
+}
+
+func TestOrderBatching(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/rider/orders", RequireRider, GetRiderOrders)
+
+	now := time.Date(2026, 3, 5, 6, 30, 0, 0, time.UTC)
+	clock.Now = func() time.Time { return now }
+	throttle := locationThrottle
+	locationThrottle = tracking.NewThrottle(trackingConfig.PublishEvery)
+	t.Cleanup(func() {
+		clock.Now = time.Now
+		locationThrottle = throttle
+	})
+	outletLat, outletLng := 12.9716, 77.5946
+	// Riders and ready orders left by earlier tests would join in.
+	database.DB.Model(&models.Rider{}).Where("1 = 1").Update("available", false)
+	database.DB.Model(&models.Order{}).Where("status = ?", models.StatusReady).Update("status", models.StatusDelivered)
+
+	esha := models.Rider{Name: "Esha", Phone: "9000000301", Available: true, Capacity: 3, Lat: &outletLat, Lng: &outletLng}
+	farLat := 12.90
+	farid := models.Rider{Name: "Farid", Phone: "9000000302", Available: true, Capacity: 3, Lat: &farLat, Lng: &outletLng}
+	assert.NoError(t, database.DB.Create(&esha).Error)
+	assert.NoError(t, database.DB.Create(&farid).Error)
+
+	outlet := uint(4)
+	ready := func(kmNorth float64) *models.Order {
+		lat := outletLat + kmNorth/111.2
+		order := models.NewOrder()
+		order.Status, order.OutletID = models.StatusReady, &outlet
+		order.DeliveryLat, order.DeliveryLng = &lat, &outletLng
+		assert.NoError(t, database.DB.Create(order).Error)
+		orderReady(order)
+		return order
+	}
+	stored := func(order *models.Order) models.Order {
+		var o models.Order
+		database.DB.First(&o, "id = ?", order.ID)
+		return o
+	}
+
+	// Drop-offs up the same road go out in one run, nearest first, and
+	// each customer hears their own estimate.
+	a := ready(2)
+	b := ready(3)
+	sub := websocket.GlobalHub.Subscribe(a.ID)
+	defer sub.Close()
+	c := ready(1)
+	for _, o := range []*models.Order{a, b, c} {
+		assert.Equal(t, esha.ID, *stored(o).RiderID)
+		assert.Equal(t, a.BatchID, stored(o).BatchID)
+	}
+	assert.Equal(t, 1, stored(c).BatchStop)
+	assert.Equal(t, 2, stored(a).BatchStop)
+	assert.Equal(t, 3, stored(b).BatchStop)
+	select {
+	case msg := <-sub.Messages():
+		var ev events.Event
+		json.Unmarshal(msg, &ev)
+		assert.Equal(t, events.TypeETAUpdated, ev.Type)
+		assert.Equal(t, stored(a).EstimatedDeliveryAt.Unix(), ev.ETA.DeliveryAt.Unix())
+	default:
+		t.Error("no ETA update for the order moved down the run")
+	}
+
+	req, _ := http.NewRequest("GET", "/rider/orders", nil)
+	req.Header.Set("Authorization", "Bearer "+riderToken(esha.ID))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var open []models.Order
+	json.Unmarshal(w.Body.Bytes(), &open)
+	if assert.Len(t, open, 3) {
+		assert.Equal(t, []string{c.ID, a.ID, b.ID}, []string{open[0].ID, open[1].ID, open[2].ID})
+	}
+
+	// A drop-off the other way starts a run of its own.
+	d := ready(-2)
+	assert.Equal(t, farid.ID, *stored(d).RiderID)
+	assert.NotEqual(t, a.BatchID, stored(d).BatchID)
+
+	// On the road, estimates count the stops before each order.
+	database.DB.Model(&models.Order{}).Where("batch_id = ?", a.BatchID).
+		Updates(map[string]interface{}{"status": models.StatusOutForDelivery, "rider_accepted_at": now, "picked_up_at": now})
+	now = now.Add(5 * time.Minute)
+	kept, err := recordPing(esha.ID, models.RiderLocationRequest{Lat: &outletLat, Lng: &outletLng})
+	assert.NoError(t, err)
+	assert.True(t, kept)
+	gap := stored(b).EstimatedDeliveryAt.Sub(*stored(a).EstimatedDeliveryAt)
+	assert.InDelta(t, (3*time.Minute + batchConfig.StopTime).Seconds(), gap.Seconds(), 5)
+
+	// Outlets without a kitchen display batch the same way, once the
+	// simulation has their orders ready.
+	gita := models.Rider{Name: "Gita", Phone: "9000000303", Available: true, Capacity: 3, Lat: &outletLat, Lng: &outletLng}
+	assert.NoError(t, database.DB.Create(&gita).Error)
+	simulated := uint(1)
+	cooked := func(kmNorth float64) *models.Order {
+		lat := outletLat + kmNorth/111.2
+		order := models.NewOrder()
+		order.Status, order.OutletID = models.StatusPreparing, &simulated
+		order.DeliveryLat, order.DeliveryLng = &lat, &outletLng
+		assert.NoError(t, database.DB.Create(order).Error)
+		assert.True(t, advanceSimulation(order, models.StatusReady))
+		return order
+	}
+	e, f := cooked(2), cooked(1)
+	for _, o := range []*models.Order{e, f} {
+		assert.Equal(t, gita.ID, *stored(o).RiderID)
+		assert.NotEmpty(t, stored(o).BatchID)
+	}
+	assert.Equal(t, stored(e).BatchID, stored(f).BatchID)
+	assert.Equal(t, 1, stored(f).BatchStop)
+	assert.Equal(t, 2, stored(e).BatchStop)
+}
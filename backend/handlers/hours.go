@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"order-mgmt-backend/database"
+	"order-mgmt-backend/models"
+	"order-mgmt-backend/schedule"
+	"time"
+)
+
+var allDay = []schedule.Window{{Start: "00:00", End: "00:00"}}
+
+// openStatus reports whether an outlet takes orders at now, and when it next
+// will if it does not. A nil outlet is only subject to store-wide pauses.
+func openStatus(outlet *models.Outlet, now time.Time) (bool, *time.Time, error) {
+	loc := schedule.StoreLocation()
+	windows := allDay
+	var closures []schedule.Closure
+
+	pauses := database.DB.Where("until > ?", now.UTC())
+	if outlet == nil {
+		pauses = pauses.Where("outlet_id IS NULL")
+	} else {
+		loc = schedule.LoadLocation(outlet.TimeZone)
+
+		var hours []models.OutletHours
+		if err := database.DB.Where("outlet_id = ?", outlet.ID).Find(&hours).Error; err != nil {
+			return false, nil, err
+		}
+		switch {
+		case len(hours) > 0:
+			windows = make([]schedule.Window, 0, len(hours))
+			for _, h := range hours {
+				windows = append(windows, schedule.Window{Days: h.Days, Start: h.OpensAt, End: h.ClosesAt})
+			}
+		case outlet.OpensAt != "" && outlet.ClosesAt != "":
+			windows = []schedule.Window{{Start: outlet.OpensAt, End: outlet.ClosesAt}}
+		}
+
+		var holidays []models.OutletHoliday
+		today := now.In(loc).Format("2006-01-02")
+		if err := database.DB.Where("outlet_id = ? AND date >= ?", outlet.ID, today).Find(&holidays).Error; err != nil {
+			return false, nil, err
+		}
+		for _, h := range holidays {
+			if c, err := schedule.DayClosure(h.Date, loc); err == nil {
+				closures = append(closures, c)
+			}
+		}
+		pauses = pauses.Where("outlet_id IS NULL OR outlet_id = ?", outlet.ID)
+	}
+
+	var active []models.OrderingPause
+	if err := pauses.Find(&active).Error; err != nil {
+		return false, nil, err
+	}
+	for _, p := range active {
+		closures = append(closures, schedule.Closure{To: p.Until})
+	}
+
+	open, next, ok := schedule.OpenWithClosures(windows, closures, now, loc)
+	if open || !ok {
+		return open, nil, nil
+	}
+	return false, &next, nil
+}
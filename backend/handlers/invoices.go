@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"order-mgmt-backend/clock"
+	"order-mgmt-backend/database"
+	"order-mgmt-backend/invoice"
+	"order-mgmt-backend/models"
+	"order-mgmt-backend/schedule"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+// invoiceSeller describes the outlet that issues an order's invoice.
+func invoiceSeller(outletID *uint) invoice.Seller {
+	seller := invoice.Seller{
+		Name:     defaultStoreName,
+		GSTIN:    os.Getenv("STORE_GSTIN"),
+		Location: schedule.StoreLocation(),
+	}
+	if outletID == nil {
+		return seller
+	}
+	var outlet models.Outlet
+	if err := database.DB.First(&outlet, *outletID).Error; err == nil {
+		seller.Name = outlet.Name
+		seller.Address = outlet.Address
+		seller.Location = schedule.LoadLocation(outlet.TimeZone)
+		if outlet.GSTIN != "" {
+			seller.GSTIN = outlet.GSTIN
+		}
+	}
+	return seller
+}
+
+// issueInvoice numbers an order once it is paid or delivered. Orders that
+// already have a number keep it.
+func issueInvoice(order *models.Order) {
+	now := clock.Now()
+	number, err := invoice.Assign(database.DB, order.ID, now, invoiceSeller(order.OutletID).Location)
+	if err != nil && !errors.Is(err, invoice.ErrAlreadyInvoiced) {
+		log.Printf("INVOICE ERROR: order %s: %v", order.ID, err)
+		return
+	}
+	order.InvoiceNumber = &number
+	if order.InvoicedAt == nil {
+		order.InvoicedAt = &now
+	}
+}
+
+func GetOrderInvoice(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	if !followOrder(c) {
+		return
+	}
+	format := c.DefaultQuery("format", "html")
+	if format != "html" && format != "pdf" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be html or pdf"})
+		return
+	}
+
+	var order models.Order
+	if err := database.DB.Preload("OrderItems.Item").First(&order, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if order.InvoiceNumber == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "An invoice is issued once the order is paid or delivered"})
+		return
+	}
+
+	doc := invoice.Build(&order, invoiceSeller(order.OutletID))
+	if format == "pdf" {
+		c.Header("Content-Disposition", `inline; filename="invoice-`+order.ID+`.pdf"`)
+		c.Data(http.StatusOK, "application/pdf", invoice.PDF(doc))
+		return
+	}
+	html, err := invoice.HTML(doc)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render invoice"})
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", html)
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"net/http"
+	"order-mgmt-backend/auth"
+	"order-mgmt-backend/clock"
+	"order-mgmt-backend/database"
+	"order-mgmt-backend/events"
+	"order-mgmt-backend/models"
+	"order-mgmt-backend/websocket"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const kitchenTokenTTL = 90 * 24 * time.Hour
+
+// kdsStatuses are the columns shown on a kitchen display, in board order.
+var kdsStatuses = []string{models.StatusReceived, models.StatusPreparing, models.StatusReady}
+
+type kitchenColumn struct {
+	Status string         `json:"status"`
+	Orders []models.Order `json:"orders"`
+}
+
+// notifyKitchen pushes an order to the display screens of its outlet.
+func notifyKitchen(event string, order *models.Order) {
+	if order.OutletID == nil {
+		return
+	}
+	topic := websocket.KitchenTopic(strconv.FormatUint(uint64(*order.OutletID), 10))
+	websocket.GlobalHub.Broadcast(topic, gin.H{"type": event, "order": order})
+}
+
+// shiftDelivery moves the order's delivery estimate by as much as the
+// kitchen moved its ready estimate from before, and reports whether either
+// estimate changed.
+func shiftDelivery(order *models.Order, before *time.Time) bool {
+	after := order.EstimatedReadyAt
+	if after == nil || (before != nil && before.Equal(*after)) {
+		return false
+	}
+	if before != nil && order.EstimatedDeliveryAt != nil {
+		delivery := order.EstimatedDeliveryAt.Add(after.Sub(*before))
+		order.EstimatedDeliveryAt = &delivery
+	}
+	return true
+}
+
+// kitchenToken lets the display screens of one outlet work its orders, and
+// nothing else.
+func kitchenToken(outletID uint) string {
+	return auth.Sign(tokenSecret, auth.Claims{OutletID: outletID}, clock.Now().Add(kitchenTokenTTL))
+}
+
+// RequireKitchen lets through the kitchen token of an outlet, storing the
+// outlet's id as "kitchen_outlet", or the admin key, which may work the
+// orders of every outlet.
+func RequireKitchen(c *gin.Context) {
+	if hasAdminKey(c) {
+		c.Next()
+		return
+	}
+	claims, err := auth.Verify(tokenSecret, requestToken(c), clock.Now())
+	if err != nil || claims.OutletID == 0 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Kitchen access required"})
+		return
+	}
+	c.Set("kitchen_outlet", claims.OutletID)
+	c.Next()
+}
+
+// kitchenAllows reports whether the caller may work the orders of outletID:
+// a kitchen token only those of its own outlet.
+func kitchenAllows(c *gin.Context, outletID *uint) bool {
+	scoped := c.GetUint("kitchen_outlet")
+	return scoped == 0 || (outletID != nil && *outletID == scoped)
+}
+
+// IssueKitchenToken gives an outlet's kitchen displays a token of their own.
+func IssueKitchenToken(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	var outlet models.Outlet
+	if err := database.DB.First(&outlet, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Outlet not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"outlet": outlet, "token": kitchenToken(outlet.ID)})
+}
+
+// KitchenWS streams an outlet's new and updated orders to its displays.
+func KitchenWS(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Query("outletId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Outlet ID required"})
+		return
+	}
+	outletID := uint(id)
+	if !kitchenAllows(c, &outletID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This display belongs to another outlet"})
+		return
+	}
+	websocket.GlobalHub.HandleKitchenWS(c.Writer, c.Request)
+}
+
+// usesKDS reports whether the order's outlet drives orders from the kitchen
+// display rather than the status simulation.
+func usesKDS(outletID *uint) bool {
+	if outletID == nil {
+		return false
+	}
+	var outlet models.Outlet
+	if err := database.DB.Select("uses_kds").First(&outlet, *outletID).Error; err != nil {
+		return false
+	}
+	return outlet.UsesKDS
+}
+
+func GetKitchenOrders(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid outlet id"})
+		return
+	}
+	outletID := uint(id)
+	if !kitchenAllows(c, &outletID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This display belongs to another outlet"})
+		return
+	}
+	var orders []models.Order
+	if err := database.DB.Preload("OrderItems.Item").
+		Where("outlet_id = ? AND status IN ?", outletID, kdsStatuses).
+		Order("created_at").Find(&orders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
+		return
+	}
+
+	columns := make([]kitchenColumn, len(kdsStatuses))
+	for i, status := range kdsStatuses {
+		columns[i] = kitchenColumn{Status: status, Orders: []models.Order{}}
+	}
+	for _, o := range orders {
+		for i := range columns {
+			if columns[i].Status == o.Status {
+				columns[i].Orders = append(columns[i].Orders, o)
+			}
+		}
+	}
+	c.JSON(http.StatusOK, columns)
+}
+
+func AcceptOrder(c *gin.Context) {
+	kitchenTransition(c, models.StatusPreparing, func(order *models.Order, now time.Time) {
+		ready := now.Add(time.Duration(order.PrepMinutes) * time.Minute)
+		order.KitchenStartAt = &now
+		order.EstimatedReadyAt = &ready
+	})
+}
+
+func RejectOrder(c *gin.Context) {
+	var req models.RejectOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	kitchenTransition(c, models.StatusRejected, func(order *models.Order, now time.Time) {
+		order.StatusReason = req.Reason
+	})
+}
+
+func MarkOrderReady(c *gin.Context) {
+	kitchenTransition(c, models.StatusReady, func(order *models.Order, now time.Time) {
+		order.EstimatedReadyAt = &now
+	})
+}
+
+// kitchenTransition moves the order in the :id param to status, applying
+// update first, and tells the customer and the kitchen about the change.
+func kitchenTransition(c *gin.Context, status string, update func(order *models.Order, now time.Time)) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	id := c.Param("id")
+	var order models.Order
+	if err := database.DB.Preload("OrderItems.Item").First(&order, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if !kitchenAllows(c, order.OutletID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This display belongs to another outlet"})
+		return
+	}
+	if !models.CanTransition(order.Status, status) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot move order from " + order.Status + " to " + status})
+		return
+	}
+
+	previous := order.Status
+	readyBefore := order.EstimatedReadyAt
+	order.Status = status
+	update(&order, clock.Now())
+	etaMoved := shiftDelivery(&order, readyBefore)
+	result := database.DB.Model(&order).Where("status = ?", previous).
+		Select("status", "status_reason", "kitchen_start_at", "estimated_ready_at", "estimated_delivery_at").Updates(&order)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Order was updated by someone else, please refresh"})
+		return
+	}
+
+	publishChanges(&order, previous, order.PaymentStatus)
+	if etaMoved {
+		publish(events.ETAUpdated(order))
+	}
+	notifyKitchen("order.updated", &order)
+	if status == models.StatusReady {
+		orderReady(&order)
+	}
+	if status == models.StatusRejected {
+		refundCancelledOrder(c.Request.Context(), &order)
+		loadRefunds(&order)
+	}
+	c.JSON(http.StatusOK, order)
+}
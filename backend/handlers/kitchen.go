@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"errors"
+	"order-mgmt-backend/geo"
+	"order-mgmt-backend/kitchen"
+	"order-mgmt-backend/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	codeKitchenFull = "KITCHEN_AT_CAPACITY"
+
+	riderSpeedKmh = 20.0
+	handoffTime   = 5 * time.Minute
+)
+
+var kitchenStatuses = []string{models.StatusReceived, models.StatusPreparing}
+
+var errKitchenFull = errors.New("kitchen is at capacity")
+
+// kitchenQueue loads the orders an outlet is still cooking. The outlet's
+// row is locked in tx until it ends, so the caller can queue an order on
+// the result without another taking its place. Orders without an outlet
+// share one unbounded store-wide queue.
+func kitchenQueue(tx *gorm.DB, outlet *models.Outlet, now time.Time) (kitchen.Queue, error) {
+	q := kitchen.Queue{Stations: 1}
+	query := tx.Where("status IN ?", kitchenStatuses)
+	if outlet == nil {
+		query = query.Where("outlet_id IS NULL")
+	} else {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.Outlet{}, outlet.ID).Error; err != nil {
+			return q, err
+		}
+		query = query.Where("outlet_id = ?", outlet.ID)
+		q.Stations = outlet.KitchenStations
+		q.Capacity = outlet.MaxActiveOrders
+	}
+
+	var orders []models.Order
+	if err := query.Select("id", "prep_minutes", "estimated_ready_at").Find(&orders).Error; err != nil {
+		return q, err
+	}
+	for _, o := range orders {
+		if o.EstimatedReadyAt != nil && !o.EstimatedReadyAt.After(now) {
+			continue
+		}
+		q.InFlight++
+		q.Backlog += time.Duration(o.PrepMinutes) * time.Minute
+		if o.EstimatedReadyAt != nil && (q.NextFreed.IsZero() || o.EstimatedReadyAt.Before(q.NextFreed)) {
+			q.NextFreed = *o.EstimatedReadyAt
+		}
+	}
+	return q, nil
+}
+
+// deliveryTime estimates the trip from outlet to customer, including the
+// handoff to the rider.
+func deliveryTime(distanceKm float64) time.Duration {
+	return handoffTime + geo.TravelTime(distanceKm, riderSpeedKmh)
+}
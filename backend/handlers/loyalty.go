@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"order-mgmt-backend/database"
+	"order-mgmt-backend/loyalty"
+	"order-mgmt-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const codeInsufficientPoints = "INSUFFICIENT_POINTS"
+
+var errInsufficientPoints = errors.New("not enough loyalty points")
+
+func loadLoyaltyRules() (models.LoyaltyRules, error) {
+	var rules models.LoyaltyRules
+	err := database.DB.First(&rules).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return loyalty.Defaults(), nil
+	}
+	if err != nil {
+		return rules, err
+	}
+	return rules, loyalty.Validate(&rules)
+}
+
+func lockLoyalty(tx *gorm.DB, userID uint) error {
+	account := models.LoyaltyAccount{UserID: userID}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&account).Error; err != nil {
+		return err
+	}
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ?", userID).First(&account).Error
+}
+
+// pointsTotals returns a customer's spendable points and the points they
+// have earned over time, which sets their tier.
+func pointsTotals(tx *gorm.DB, userID uint) (balance, lifetime int, err error) {
+	err = tx.Model(&models.LoyaltyMovement{}).Where("user_id = ?", userID).
+		Select("COALESCE(SUM(points), 0)").Scan(&balance).Error
+	if err != nil {
+		return 0, 0, err
+	}
+	err = tx.Model(&models.LoyaltyMovement{}).
+		Where("user_id = ? AND kind IN ?", userID, []string{models.PointsEarned, models.PointsReversed}).
+		Select("COALESCE(SUM(points), 0)").Scan(&lifetime).Error
+	return balance, lifetime, err
+}
+
+// movePoints records m unless its reference has been used, and reports
+// whether it did.
+func movePoints(tx *gorm.DB, m *models.LoyaltyMovement) (bool, error) {
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(m)
+	return result.RowsAffected > 0, result.Error
+}
+
+// redeemPoints spends the points a new order was discounted with.
+func redeemPoints(order *models.Order) error {
+	if order.PointsRedeemed == 0 {
+		return nil
+	}
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockLoyalty(tx, *order.UserID); err != nil {
+			return err
+		}
+		balance, _, err := pointsTotals(tx, *order.UserID)
+		if err != nil {
+			return err
+		}
+		if balance < order.PointsRedeemed {
+			return errInsufficientPoints
+		}
+		_, err = movePoints(tx, &models.LoyaltyMovement{
+			UserID:    *order.UserID,
+			OrderID:   order.ID,
+			Kind:      models.PointsRedeemed,
+			Points:    -order.PointsRedeemed,
+			Reference: "redeem:" + order.ID,
+			Reason:    "Redeemed at checkout",
+		})
+		return err
+	})
+}
+
+// awardPoints credits the points a delivered order earns on what the
+// customer paid for it, net of refunds.
+func awardPoints(order *models.Order) {
+	if order.UserID == nil {
+		return
+	}
+	rules, err := loadLoyaltyRules()
+	if err != nil {
+		log.Printf("LOYALTY ERROR: rules: %v", err)
+		return
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockLoyalty(tx, *order.UserID); err != nil {
+			return err
+		}
+		var stored models.Order
+		if err := tx.Select("total_price", "refunded_amount").First(&stored, "id = ?", order.ID).Error; err != nil {
+			return err
+		}
+		_, lifetime, err := pointsTotals(tx, *order.UserID)
+		if err != nil {
+			return err
+		}
+		points := loyalty.Earn(rules, stored.TotalPrice-stored.RefundedAmount, lifetime)
+		if points == 0 {
+			return nil
+		}
+		moved, err := movePoints(tx, &models.LoyaltyMovement{
+			UserID:    *order.UserID,
+			OrderID:   order.ID,
+			Kind:      models.PointsEarned,
+			Points:    points,
+			Reference: "earn:" + order.ID,
+			Reason:    loyalty.Tier(rules, lifetime).Name + " points for delivered order",
+		})
+		if err != nil || !moved {
+			return err
+		}
+		order.PointsEarned = points
+		return tx.Model(&models.Order{}).Where("id = ?", order.ID).Update("points_earned", points).Error
+	})
+	if err != nil {
+		log.Printf("LOYALTY ERROR: award for order %s: %v", order.ID, err)
+	}
+}
+
+// reversePoints takes back the share of earned points that a refund paid
+// back. The balance may go negative if the points were already spent.
+func reversePoints(orderID string, refund *models.Refund) {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		if err := tx.Select("id", "user_id", "total_price", "points_earned").First(&order, "id = ?", orderID).Error; err != nil {
+			return err
+		}
+		if order.UserID == nil || order.PointsEarned == 0 {
+			return nil
+		}
+		if err := lockLoyalty(tx, *order.UserID); err != nil {
+			return err
+		}
+		var reversed int
+		if err := tx.Model(&models.LoyaltyMovement{}).
+			Where("order_id = ? AND kind = ?", orderID, models.PointsReversed).
+			Select("COALESCE(-SUM(points), 0)").Scan(&reversed).Error; err != nil {
+			return err
+		}
+		points := loyalty.Reversal(order.PointsEarned, reversed, refund.Amount, order.TotalPrice)
+		if points == 0 {
+			return nil
+		}
+		_, err := movePoints(tx, &models.LoyaltyMovement{
+			UserID:    *order.UserID,
+			OrderID:   orderID,
+			Kind:      models.PointsReversed,
+			Points:    -points,
+			Reference: fmt.Sprintf("reverse:%d", refund.ID),
+			Reason:    "Order refunded",
+		})
+		return err
+	})
+	if err != nil {
+		log.Printf("LOYALTY ERROR: reverse for order %s: %v", orderID, err)
+	}
+}
+
+// restorePoints gives back the points spent on an order that was cancelled.
+func restorePoints(order *models.Order) {
+	if order.UserID == nil || order.PointsRedeemed == 0 {
+		return
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var redeemed int64
+		if err := tx.Model(&models.LoyaltyMovement{}).Where("reference = ?", "redeem:"+order.ID).Count(&redeemed).Error; err != nil || redeemed == 0 {
+			return err
+		}
+		if err := lockLoyalty(tx, *order.UserID); err != nil {
+			return err
+		}
+		_, err := movePoints(tx, &models.LoyaltyMovement{
+			UserID:    *order.UserID,
+			OrderID:   order.ID,
+			Kind:      models.PointsRestored,
+			Points:    order.PointsRedeemed,
+			Reference: "restore:" + order.ID,
+			Reason:    "Order cancelled",
+		})
+		return err
+	})
+	if err != nil {
+		log.Printf("LOYALTY ERROR: restore for order %s: %v", order.ID, err)
+	}
+}
+
+func GetLoyalty(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	user, ok := accountUser(c)
+	if !ok {
+		return
+	}
+	rules, err := loadLoyaltyRules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load loyalty rules"})
+		return
+	}
+	balance, lifetime, err := pointsTotals(database.DB, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load points"})
+		return
+	}
+	var movements []models.LoyaltyMovement
+	if err := database.DB.Where("user_id = ?", user.ID).Order("id").Find(&movements).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load points"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":         user.ID,
+		"balance":         balance,
+		"lifetime_points": lifetime,
+		"tier":            loyalty.Tier(rules, lifetime),
+		"movements":       movements,
+	})
+}
+
+func GetLoyaltyRules(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	rules, err := loadLoyaltyRules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load loyalty rules"})
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+func UpdateLoyaltyRules(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	var rules models.LoyaltyRules
+	if err := c.ShouldBindJSON(&rules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := loyalty.Validate(&rules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var stored models.LoyaltyRules
+	if err := database.DB.First(&stored).Error; err == nil {
+		rules.ID = stored.ID
+	}
+	if err := database.DB.Save(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save loyalty rules"})
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"order-mgmt-backend/database"
+	"order-mgmt-backend/models"
+	"order-mgmt-backend/schedule"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// outletMenu resolves per-outlet availability and pricing. A nil outlet
+// stands for the store-wide menu.
+type outletMenu struct {
+	outlet    *models.Outlet
+	overrides map[uint]models.OutletItem
+}
+
+func loadOutletMenu(outletID uint) (outletMenu, error) {
+	om := outletMenu{overrides: make(map[uint]models.OutletItem)}
+	if outletID == 0 {
+		return om, nil
+	}
+	var outlet models.Outlet
+	if err := database.DB.First(&outlet, outletID).Error; err != nil {
+		return om, err
+	}
+	om.outlet = &outlet
+
+	var overrides []models.OutletItem
+	if err := database.DB.Where("outlet_id = ?", outletID).Find(&overrides).Error; err != nil {
+		return om, err
+	}
+	for _, o := range overrides {
+		om.overrides[o.ItemID] = o
+	}
+	return om, nil
+}
+
+func (om outletMenu) location() *time.Location {
+	if om.outlet == nil {
+		return schedule.StoreLocation()
+	}
+	return schedule.LoadLocation(om.outlet.TimeZone)
+}
+
+// apply returns item with the outlet's price, and false when the outlet does
+// not sell it.
+func (om outletMenu) apply(item models.Item) (models.Item, bool) {
+	o, ok := om.overrides[item.ID]
+	if !ok {
+		return item, true
+	}
+	if o.Price != nil {
+		item.Price = *o.Price
+	}
+	return item, o.Available
+}
+
+func GetOutlets(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	query := database.DB.Preload("Location").Preload("Hours")
+	if locationID := c.Query("location_id"); locationID != "" {
+		id, err := strconv.ParseUint(locationID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location_id"})
+			return
+		}
+		query = query.Where("location_id = ?", id)
+	}
+	var outlets []models.Outlet
+	if err := query.Find(&outlets).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch outlets"})
+		return
+	}
+	c.JSON(http.StatusOK, outlets)
+}
@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"order-mgmt-backend/clock"
+	"order-mgmt-backend/database"
+	"order-mgmt-backend/models"
+	"order-mgmt-backend/payments"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	codePaymentFailed      = "PAYMENT_FAILED"
+	codeInvalidPayment     = "INVALID_PAYMENT"
+	codeInsufficientWallet = "INSUFFICIENT_WALLET_BALANCE"
+	codeAmountMismatch     = "AMOUNT_MISMATCH"
+	codeAwaitingPayment    = "AWAITING_PAYMENT"
+)
+
+var errAlreadyCollected = errors.New("cash has already been collected")
+
+// orderPayments turns a payment split into pending components of order.
+func orderPayments(orderID string, parts []payments.Component) []models.OrderPayment {
+	components := make([]models.OrderPayment, len(parts))
+	for i, p := range parts {
+		components[i] = models.OrderPayment{
+			OrderID: orderID,
+			Method:  string(p.Method),
+			Amount:  p.Amount,
+			Status:  models.PaymentPending,
+		}
+	}
+	return components
+}
+
+// component returns the order's component paid with method, if any.
+func component(order *models.Order, method payments.Method) *models.OrderPayment {
+	for i := range order.Payments {
+		if order.Payments[i].Method == string(method) {
+			return &order.Payments[i]
+		}
+	}
+	return nil
+}
+
+// onlineComponent returns the component collected through the provider.
+func onlineComponent(order *models.Order) *models.OrderPayment {
+	for i := range order.Payments {
+		if payments.Method(order.Payments[i].Method).Online() {
+			return &order.Payments[i]
+		}
+	}
+	return nil
+}
+
+func paidInFull(order *models.Order) bool {
+	for _, p := range order.Payments {
+		if p.Status != models.PaymentCaptured {
+			return false
+		}
+	}
+	return len(order.Payments) > 0
+}
+
+// cancelUnpaid cancels a new order before any money was taken from it.
+func cancelUnpaid(order *models.Order, reason string) {
+	previousStatus, previousPayment := order.Status, order.PaymentStatus
+	if failed, _ := updatePayment(database.DB, order, []string{models.PaymentPending}, models.PaymentFailed, map[string]interface{}{
+		"status":        models.StatusCancelled,
+		"status_reason": reason,
+	}); failed {
+		order.Status = models.StatusCancelled
+		order.StatusReason = reason
+		publishChanges(order, previousStatus, previousPayment)
+	}
+}
+
+// chargeWallet debits the wallet share of a new order, after redeemPoints
+// and chargeGiftCard. On failure it cancels the order, and the caller hands
+// it to refundCancelledOrder, which restores the points and refunds the
+// gift card share.
+func chargeWallet(ctx context.Context, order *models.Order) error {
+	p := component(order, payments.MethodWallet)
+	if p == nil {
+		return nil
+	}
+	err := payments.DefaultWallet.Debit(ctx, *order.UserID, p.Amount, "order:"+order.ID)
+	if err != nil {
+		p.Status = models.PaymentFailed
+		database.DB.Model(p).Update("status", p.Status)
+		cancelUnpaid(order, "Wallet payment failed: "+err.Error())
+		return err
+	}
+	p.Status = models.PaymentCaptured
+	return database.DB.Model(p).Update("status", p.Status).Error
+}
+
+// startKitchen releases an order to its kitchen, either onto the kitchen
+// display or into the status simulation.
+func startKitchen(order *models.Order) {
+	if !usesKDS(order.OutletID) {
+		go simulateOrderStatus(order.ID, clock.Now())
+	}
+	notifyKitchen("order.created", order)
+}
+
+// updatePayment moves the order's payment status from one of from to to,
+// with any extra columns, and reports whether this call made the change.
+// The guard keeps repeated notifications from applying twice.
+func updatePayment(db *gorm.DB, order *models.Order, from []string, to string, extra map[string]interface{}) (bool, error) {
+	fields := map[string]interface{}{"payment_status": to}
+	for k, v := range extra {
+		fields[k] = v
+	}
+	result := db.Model(&models.Order{}).
+		Where("id = ? AND payment_status IN ?", order.ID, from).
+		Updates(fields)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	order.PaymentStatus = to
+	return true, nil
+}
+
+// applyIntent records an intent's outcome on the order through db and
+// reports whether the order was released to the kitchen. It makes no
+// provider calls, so it is safe inside a transaction.
+func applyIntent(db *gorm.DB, order *models.Order, intent payments.Intent) (bool, error) {
+	unsettled := []string{models.PaymentPending, models.PaymentAuthorized}
+	if intent.Status == payments.StatusCaptured || intent.Status == payments.StatusFailed {
+		if err := db.Model(&models.OrderPayment{}).Where("intent_id = ?", intent.ID).
+			Update("status", string(intent.Status)).Error; err != nil {
+			return false, err
+		}
+	}
+	switch intent.Status {
+	case payments.StatusAuthorized:
+		_, err := updatePayment(db, order, []string{models.PaymentPending}, models.PaymentAuthorized, nil)
+		return false, err
+	case payments.StatusCaptured:
+		if order.Status == models.StatusCancelled {
+			// Cancelled while the payment was in flight: record the
+			// capture so that it is refunded rather than cooked.
+			_, err := updatePayment(db, order, unsettled, models.PaymentCaptured, nil)
+			return false, err
+		}
+		released, err := updatePayment(db, order, unsettled, models.PaymentCaptured, map[string]interface{}{
+			"status": models.StatusReceived,
+		})
+		if released {
+			order.Status = models.StatusReceived
+		}
+		return released, err
+	case payments.StatusFailed:
+		reason := "Payment failed: " + intent.Error
+		failed, err := updatePayment(db, order, unsettled, models.PaymentFailed, map[string]interface{}{
+			"status":        models.StatusCancelled,
+			"status_reason": reason,
+		})
+		if failed {
+			order.Status = models.StatusCancelled
+			order.StatusReason = reason
+		}
+		return false, err
+	}
+	return false, nil
+}
+
+// orderDelivered runs the side effects of an order reaching Delivered.
+func orderDelivered(order *models.Order) {
+	issueInvoice(order)
+	awardPoints(order)
+}
+
+// releaseOrder runs the side effects of a captured payment once it is
+// committed.
+func releaseOrder(order *models.Order) {
+	issueInvoice(order)
+	startKitchen(order)
+}
+
+// settlePayment brings an order in line with its payment intent. Authorized
+// payments are captured straight away; a capture releases the order to the
+// kitchen and a failure cancels it.
+func settlePayment(ctx context.Context, order *models.Order, intent payments.Intent) {
+	if intent.Status == payments.StatusAuthorized {
+		previousPayment := order.PaymentStatus
+		if _, err := applyIntent(database.DB, order, intent); err != nil {
+			log.Printf("PAYMENT ERROR: order %s: %v", order.ID, err)
+			return
+		}
+		publishChanges(order, order.Status, previousPayment)
+		captured, err := payments.Default.Capture(ctx, intent.ID)
+		if err != nil {
+			log.Printf("PAYMENT ERROR: capture %s for order %s: %v", intent.ID, order.ID, err)
+			return
+		}
+		intent = captured
+	}
+
+	previousStatus, previousPayment := order.Status, order.PaymentStatus
+	released, err := applyIntent(database.DB, order, intent)
+	if err != nil {
+		log.Printf("PAYMENT ERROR: order %s: %v", order.ID, err)
+		return
+	}
+	publishChanges(order, previousStatus, previousPayment)
+	if released {
+		releaseOrder(order)
+	}
+	if order.Status == models.StatusCancelled {
+		refundCancelledOrder(ctx, order)
+	}
+}
+
+// PaymentSettled applies an intent that the provider confirmed after the
+// order was created.
+func PaymentSettled(intent payments.Intent) {
+	var order models.Order
+	if err := database.DB.First(&order, "id = ? AND payment_intent_id = ?", intent.OrderID, intent.ID).Error; err != nil {
+		log.Printf("PAYMENT ERROR: no order for intent %s: %v", intent.ID, err)
+		return
+	}
+	settlePayment(context.Background(), &order, intent)
+}
+
+// CollectCash records the cash a rider took for an order on delivery. The
+// amount must match the order's cash component exactly; once every component
+// is paid the order's payment is captured.
+func CollectCash(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	var req models.CollectCashRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var order models.Order
+	if err := database.DB.Preload("Payments").First(&order, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if order.Status != models.StatusOutForDelivery && order.Status != models.StatusDelivered {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cash can only be collected on delivery"})
+		return
+	}
+	cash := component(&order, payments.MethodCOD)
+	if cash == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Order is not paid in cash"})
+		return
+	}
+	if err := payments.Reconcile(cash.Amount, []payments.Component{{Method: payments.MethodCOD, Amount: req.Amount}}); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Collected amount does not match the cash due", "code": codeAmountMismatch, "expected": cash.Amount})
+		return
+	}
+
+	now := clock.Now()
+	previousPayment := order.PaymentStatus
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(cash).Where("status = ?", models.PaymentPending).Updates(map[string]interface{}{
+			"status":       models.PaymentCaptured,
+			"collected_by": req.CollectedBy,
+			"collected_at": now,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errAlreadyCollected
+		}
+		cash.Status = models.PaymentCaptured
+		cash.CollectedBy = req.CollectedBy
+		cash.CollectedAt = &now
+		if !paidInFull(&order) {
+			return nil
+		}
+		_, err := updatePayment(tx, &order, []string{models.PaymentPending}, models.PaymentCaptured, nil)
+		return err
+	})
+	if errors.Is(err, errAlreadyCollected) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cash has already been collected"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record collection"})
+		return
+	}
+	publishChanges(&order, order.Status, previousPayment)
+	c.JSON(http.StatusOK, order)
+}
@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"order-mgmt-backend/database"
+	"order-mgmt-backend/events"
+	"order-mgmt-backend/models"
+	"order-mgmt-backend/payments"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const codeRefundNotAllowed = "REFUND_NOT_ALLOWED"
+
+var (
+	errNotRefundable   = errors.New("order has no captured payment to refund")
+	errNothingToRefund = errors.New("order has already been refunded in full")
+	errRefundTooBig    = errors.New("refund exceeds what is left to refund")
+	errUnknownLine     = errors.New("order item not found on this order")
+	errNoWallet        = errors.New("order has no customer account to credit")
+)
+
+func roundMoney(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// refundSource is a captured payment component that money can go back to.
+type refundSource struct {
+	method     string
+	amount     float64
+	intentID   string
+	giftCardID *uint
+}
+
+// refundSources lists where an order's money came from: provider payments
+// first, then gift cards, then the wallet. Cash is handed back by the rider,
+// so it is never a source. Orders placed before payment components fall
+// back to their provider payment.
+func refundSources(order *models.Order) []refundSource {
+	var online, cards, wallet []refundSource
+	for _, p := range order.Payments {
+		if p.Status != models.PaymentCaptured {
+			continue
+		}
+		switch m := payments.Method(p.Method); {
+		case m == payments.MethodWallet:
+			wallet = append(wallet, refundSource{method: p.Method, amount: p.Amount})
+		case m == payments.MethodGiftCard:
+			cards = append(cards, refundSource{method: p.Method, amount: p.Amount, giftCardID: p.GiftCardID})
+		case m.Online():
+			online = append(online, refundSource{method: p.Method, amount: p.Amount, intentID: p.IntentID})
+		}
+	}
+	if len(order.Payments) == 0 && order.PaymentStatus == models.PaymentCaptured && order.PaymentIntentID != "" {
+		online = append(online, refundSource{method: order.PaymentMethod, amount: order.TotalPrice, intentID: order.PaymentIntentID})
+	}
+	return append(append(online, cards...), wallet...)
+}
+
+// reserveRefund checks req against what is left to refund on the order and
+// records it as pending refunds, one per payment component it draws on.
+// Refunds are counted against the component they came from even when they
+// are paid out as store credit.
+// Pending refunds count as spent, so two concurrent requests cannot both
+// claim the same money.
+func reserveRefund(orderID string, req models.CreateRefundRequest) ([]models.Refund, models.Order, error) {
+	var refunds []models.Refund
+	var order models.Order
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Preload("OrderItems").Preload("Payments").First(&order, "id = ?", orderID).Error; err != nil {
+			return err
+		}
+		sources := refundSources(&order)
+		if len(sources) == 0 {
+			return errNotRefundable
+		}
+		if req.ToWallet && order.UserID == nil {
+			return errNoWallet
+		}
+
+		var open []models.Refund
+		if err := tx.Where("order_id = ? AND status <> ?", orderID, models.RefundFailed).Find(&open).Error; err != nil {
+			return err
+		}
+		spent := make(map[string]float64)
+		for _, r := range open {
+			spent[r.Method] += r.Amount
+		}
+		remaining := 0.0
+		for _, src := range sources {
+			remaining += math.Max(src.amount-spent[src.method], 0)
+		}
+		remaining = roundMoney(remaining)
+
+		amount, quantity := 0.0, 0
+		switch {
+		case req.OrderItemID != nil:
+			var line *models.OrderItem
+			for i := range order.OrderItems {
+				if order.OrderItems[i].ID == *req.OrderItemID {
+					line = &order.OrderItems[i]
+				}
+			}
+			if line == nil {
+				return errUnknownLine
+			}
+			refunded := 0
+			for _, r := range open {
+				if r.OrderItemID != nil && *r.OrderItemID == line.ID {
+					refunded += r.Quantity
+				}
+			}
+			quantity = req.Quantity
+			if quantity == 0 {
+				quantity = line.Quantity - refunded
+			}
+			if quantity <= 0 || refunded+quantity > line.Quantity {
+				return errRefundTooBig
+			}
+			amount = roundMoney(line.Price * float64(quantity))
+		case req.Amount != nil:
+			amount = roundMoney(*req.Amount)
+		default:
+			if remaining <= 0 {
+				return errNothingToRefund
+			}
+			amount = remaining
+		}
+		if amount <= 0 || amount > remaining {
+			return errRefundTooBig
+		}
+
+		// Item quantities go on the first refund only so that a line split
+		// across two components is not counted twice.
+		for _, src := range sources {
+			part := roundMoney(math.Min(src.amount-spent[src.method], amount))
+			if part <= 0 {
+				continue
+			}
+			refunds = append(refunds, models.Refund{
+				OrderID:     orderID,
+				OrderItemID: req.OrderItemID,
+				Quantity:    quantity,
+				Method:      src.method,
+				ToWallet:    req.ToWallet || src.method == string(payments.MethodWallet),
+				Amount:      part,
+				Reason:      req.Reason,
+				Status:      models.RefundPending,
+			})
+			quantity = 0
+			amount = roundMoney(amount - part)
+			if amount <= 0 {
+				break
+			}
+		}
+		return tx.Create(&refunds).Error
+	})
+	return refunds, order, err
+}
+
+// sendRefund pays a reserved refund back through its method, onto the gift
+// card it was paid with, or as store credit, and records the outcome.
+func sendRefund(ctx context.Context, order *models.Order, refund *models.Refund) error {
+	var perr error
+	source := refundSource{intentID: order.PaymentIntentID}
+	for _, src := range refundSources(order) {
+		if src.method == refund.Method {
+			source = src
+		}
+	}
+	switch {
+	case refund.ToWallet:
+		perr = payments.DefaultWallet.Credit(ctx, *order.UserID, refund.Amount, fmt.Sprintf("refund:%d", refund.ID))
+	case source.giftCardID != nil:
+		_, perr = giftCards().Refund(ctx, *source.giftCardID, refund.Amount, order.ID, fmt.Sprintf("refund:%d", refund.ID))
+	default:
+		_, perr = payments.Default.Refund(ctx, source.intentID, refund.Amount)
+	}
+	if perr != nil {
+		refund.Status = models.RefundFailed
+		refund.Error = perr.Error()
+		if err := database.DB.Model(refund).Updates(map[string]interface{}{
+			"status": refund.Status,
+			"error":  refund.Error,
+		}).Error; err != nil {
+			return err
+		}
+		return perr
+	}
+
+	refund.Status = models.RefundSucceeded
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(refund).Update("status", refund.Status).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Order{}).Where("id = ?", order.ID).
+			Update("refunded_amount", gorm.Expr("refunded_amount + ?", refund.Amount)).Error
+	})
+	if err == nil {
+		reversePoints(order.ID, refund)
+	}
+	return err
+}
+
+// refundOrder reserves refunds and sends each to where the money came from.
+// The refunds are returned with their final status even when one fails.
+func refundOrder(ctx context.Context, orderID string, req models.CreateRefundRequest) ([]models.Refund, error) {
+	refunds, order, err := reserveRefund(orderID, req)
+	if err != nil {
+		return nil, err
+	}
+	refunded := false
+	for i := range refunds {
+		if rerr := sendRefund(ctx, &order, &refunds[i]); rerr != nil && err == nil {
+			err = rerr
+		}
+		refunded = refunded || refunds[i].Status == models.RefundSucceeded
+	}
+	if refunded {
+		loadRefunds(&order)
+		publish(events.PaymentUpdated(order))
+	}
+	return refunds, err
+}
+
+// refundCancelledOrder gives back whatever is left of a cancelled or
+// rejected order's payment, and the points spent on it. Orders with nothing
+// captured, such as unpaid cash orders, have no money to refund.
+func refundCancelledOrder(ctx context.Context, order *models.Order) {
+	restorePoints(order)
+	reason := "Order cancelled"
+	if order.Status == models.StatusRejected {
+		reason = "Order rejected: " + order.StatusReason
+	}
+	_, err := refundOrder(ctx, order.ID, models.CreateRefundRequest{Reason: reason})
+	if err != nil && !errors.Is(err, errNothingToRefund) && !errors.Is(err, errNotRefundable) {
+		log.Printf("REFUND ERROR: order %s: %v", order.ID, err)
+	}
+}
+
+func orderByID(db *gorm.DB) *gorm.DB {
+	return db.Order("id")
+}
+
+// loadRefunds fills in the order's refund history, oldest first.
+func loadRefunds(order *models.Order) {
+	var refunds []models.Refund
+	database.DB.Where("order_id = ?", order.ID).Order("id").Find(&refunds)
+	order.Refunds = refunds
+	var stored models.Order
+	if err := database.DB.Select("refunded_amount").First(&stored, "id = ?", order.ID).Error; err == nil {
+		order.RefundedAmount = stored.RefundedAmount
+	}
+}
+
+func CreateRefund(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	var req models.CreateRefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.OrderItemID != nil && req.Amount != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Send either order_item_id or amount, not both"})
+		return
+	}
+
+	refunds, err := refundOrder(c.Request.Context(), c.Param("id"), req)
+	failed := false
+	for _, r := range refunds {
+		failed = failed || r.Status == models.RefundFailed
+	}
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+	case errors.Is(err, errUnknownLine):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errNotRefundable), errors.Is(err, errNothingToRefund), errors.Is(err, errRefundTooBig), errors.Is(err, errNoWallet):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": codeRefundNotAllowed})
+	case failed:
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Refund could not be paid out", "refunds": refunds})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record refund"})
+	default:
+		c.JSON(http.StatusCreated, refunds)
+	}
+}
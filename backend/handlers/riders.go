@@ -0,0 +1,467 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"order-mgmt-backend/auth"
+	"order-mgmt-backend/clock"
+	"order-mgmt-backend/database"
+	"order-mgmt-backend/dispatch"
+	"order-mgmt-backend/events"
+	"order-mgmt-backend/geo"
+	"order-mgmt-backend/models"
+	"order-mgmt-backend/websocket"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const riderTokenTTL = 30 * 24 * time.Hour
+
+// dispatcher picks the rider for each ready order. DISPATCH_STRATEGY names
+// it: nearest (the default), round_robin or least_loaded.
+var dispatcher = loadDispatcher()
+
+func loadDispatcher() dispatch.Strategy {
+	s, err := dispatch.ByName(os.Getenv("DISPATCH_STRATEGY"))
+	if err != nil {
+		log.Printf("WARNING: %v, dispatching to the nearest rider", err)
+		return dispatch.Nearest{}
+	}
+	return s
+}
+
+// closedStatuses are the statuses in which an order no longer counts
+// against its rider.
+var closedStatuses = []string{models.StatusDelivered, models.StatusCancelled, models.StatusRejected}
+
+func riderToken(riderID uint) string {
+	return auth.Sign(tokenSecret, auth.Claims{RiderID: riderID}, clock.Now().Add(riderTokenTTL))
+}
+
+// RequireRider only lets through requests with a rider's token, and stores
+// the rider's id as "rider_id".
+func RequireRider(c *gin.Context) {
+	claims, err := auth.Verify(tokenSecret, requestToken(c), clock.Now())
+	if err != nil || claims.RiderID == 0 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Rider access required"})
+		return
+	}
+	c.Set("rider_id", claims.RiderID)
+	c.Next()
+}
+
+func currentRider(c *gin.Context) uint {
+	return c.GetUint("rider_id")
+}
+
+// riderLoads counts the open orders of each rider in ids.
+func riderLoads(db *gorm.DB, ids []uint) (map[uint]int, error) {
+	var rows []struct {
+		RiderID uint
+		Orders  int
+	}
+	if err := db.Model(&models.Order{}).Select("rider_id, count(*) AS orders").
+		Where("rider_id IN ? AND status NOT IN ?", ids, closedStatuses).
+		Group("rider_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	loads := make(map[uint]int, len(rows))
+	for _, r := range rows {
+		loads[r.RiderID] = r.Orders
+	}
+	return loads, nil
+}
+
+func dispatchRider(r models.Rider, load int) dispatch.Rider {
+	d := dispatch.Rider{ID: r.ID, Load: load, Capacity: r.Capacity}
+	if r.Lat != nil && r.Lng != nil {
+		d.Location = &geo.Point{Lat: *r.Lat, Lng: *r.Lng}
+	}
+	if r.LastAssignedAt != nil {
+		d.LastAssignedAt = *r.LastAssignedAt
+	}
+	return d
+}
+
+// outletPoint is where orders from an outlet are picked up, or nil for an
+// outlet with no location set.
+func outletPoint(outletID *uint) *geo.Point {
+	if outletID == nil {
+		return nil
+	}
+	var outlet models.Outlet
+	if err := database.DB.Select("latitude", "longitude").First(&outlet, *outletID).Error; err != nil {
+		return nil
+	}
+	if outlet.Latitude == 0 && outlet.Longitude == 0 {
+		return nil
+	}
+	return &geo.Point{Lat: outlet.Latitude, Lng: outlet.Longitude}
+}
+
+// assignRider offers a ready order to a rider, and reports whether there
+// was one free. The order joins a run waiting at its outlet if it fits into
+// one; otherwise it starts a run of its own with the rider the dispatcher
+// picks. Available riders are locked while their loads are counted, so
+// that two orders cannot both take a rider's last slot.
+func assignRider(order *models.Order) (bool, error) {
+	job := dispatch.Job{OrderID: order.ID, Pickup: outletPoint(order.OutletID)}
+	now := clock.Now()
+	var picked *models.Rider
+	var moved []models.Order
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var riders []models.Rider
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("available = ?", true).Order("id").Find(&riders).Error; err != nil {
+			return err
+		}
+		if len(riders) == 0 {
+			return nil
+		}
+		ids := make([]uint, len(riders))
+		for i, r := range riders {
+			ids[i] = r.ID
+		}
+		loads, err := riderLoads(tx, ids)
+		if err != nil {
+			return err
+		}
+		candidates := make([]dispatch.Rider, len(riders))
+		for i, r := range riders {
+			candidates[i] = dispatchRider(r, loads[r.ID])
+		}
+		run, err := findRun(tx, order, job.Pickup, riders, loads, now)
+		if err != nil {
+			return err
+		}
+		var choiceID uint
+		batchID := uuid.New().String()
+		if run != nil {
+			choiceID, batchID = run.rider.ID, run.batchID
+		} else {
+			choice, ok := dispatcher.Pick(job, candidates)
+			if !ok {
+				return nil
+			}
+			choiceID = choice.ID
+		}
+		result := tx.Model(&models.Order{}).Where("id = ? AND rider_id IS NULL", order.ID).
+			Updates(map[string]interface{}{"rider_id": choiceID, "rider_assigned_at": now, "batch_id": batchID, "batch_stop": 1})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		order.BatchID, order.BatchStop = batchID, 1
+		if run != nil {
+			if moved, err = run.apply(tx, order); err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&models.Rider{}).Where("id = ?", choiceID).Update("last_assigned_at", now).Error; err != nil {
+			return err
+		}
+		for i := range riders {
+			if riders[i].ID == choiceID {
+				picked = &riders[i]
+			}
+		}
+		return nil
+	})
+	if err != nil || picked == nil {
+		return false, err
+	}
+	order.RiderID, order.RiderAssignedAt = &picked.ID, &now
+	for _, o := range moved {
+		publish(events.ETAUpdated(o))
+	}
+	topic := websocket.RiderTopic(strconv.FormatUint(uint64(picked.ID), 10))
+	websocket.GlobalHub.Broadcast(topic, gin.H{"type": "order.offered", "order": order})
+	return true, nil
+}
+
+// orderReady runs the side effects of an order becoming ready for pickup.
+func orderReady(order *models.Order) {
+	if _, err := assignRider(order); err != nil {
+		log.Printf("DISPATCH ERROR: order %s: %v", order.ID, err)
+	}
+}
+
+// dispatchWaiting offers ready orders that have no rider, oldest first,
+// until no rider is free.
+func dispatchWaiting() {
+	var waiting []models.Order
+	if err := database.DB.Where("status = ? AND rider_id IS NULL", models.StatusReady).
+		Order("created_at").Find(&waiting).Error; err != nil {
+		log.Printf("DISPATCH ERROR: %v", err)
+		return
+	}
+	for i := range waiting {
+		assigned, err := assignRider(&waiting[i])
+		if err != nil {
+			log.Printf("DISPATCH ERROR: order %s: %v", waiting[i].ID, err)
+			return
+		}
+		if !assigned {
+			return
+		}
+	}
+}
+
+// CreateRider adds a rider. The response carries the token the rider's app
+// signs in with.
+func CreateRider(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	var req models.CreateRiderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var existing int64
+	database.DB.Model(&models.Rider{}).Where("phone = ?", req.Phone).Count(&existing)
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A rider with this phone already exists"})
+		return
+	}
+	rider := models.Rider{Name: req.Name, Phone: req.Phone, Capacity: req.Capacity}
+	if rider.Capacity == 0 {
+		rider.Capacity = 1
+	}
+	if err := database.DB.Create(&rider).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create rider"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"rider": rider, "token": riderToken(rider.ID)})
+}
+
+func ListRiders(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	var riders []models.Rider
+	if err := database.DB.Order("id").Find(&riders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch riders"})
+		return
+	}
+	c.JSON(http.StatusOK, riders)
+}
+
+// IssueRiderToken gives a rider a new token, for a new phone or once the
+// old one expires.
+func IssueRiderToken(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	var rider models.Rider
+	if err := database.DB.First(&rider, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rider not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rider": rider, "token": riderToken(rider.ID)})
+}
+
+// SetRiderAvailability starts or ends the rider's shift. A rider going off
+// shift gives back the orders they have not accepted; either way waiting
+// orders are dispatched again.
+func SetRiderAvailability(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	var req models.RiderAvailabilityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	fields := map[string]interface{}{"available": *req.Available}
+	if req.Lat != nil && req.Lng != nil {
+		if !(geo.Point{Lat: *req.Lat, Lng: *req.Lng}).Valid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location"})
+			return
+		}
+		fields["lat"], fields["lng"], fields["located_at"] = *req.Lat, *req.Lng, clock.Now()
+	}
+	id := currentRider(c)
+	if err := database.DB.Model(&models.Rider{}).Where("id = ?", id).Updates(fields).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update rider"})
+		return
+	}
+	if !*req.Available {
+		database.DB.Model(&models.Order{}).
+			Where("rider_id = ? AND rider_accepted_at IS NULL AND status = ?", id, models.StatusReady).
+			Updates(map[string]interface{}{"rider_id": nil, "rider_assigned_at": nil, "batch_id": "", "batch_stop": 0})
+	}
+	dispatchWaiting()
+
+	var rider models.Rider
+	if err := database.DB.First(&rider, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rider not found"})
+		return
+	}
+	c.JSON(http.StatusOK, rider)
+}
+
+// GetRiderOrders lists the rider's open orders, offered or accepted, run by
+// run in the order they were offered and in stop order within a run.
+func GetRiderOrders(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	var orders []models.Order
+	if err := database.DB.Preload("OrderItems.Item").
+		Where("rider_id = ? AND status NOT IN ?", currentRider(c), closedStatuses).
+		Order("rider_assigned_at").Find(&orders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
+		return
+	}
+	runs := make(map[string]int)
+	for i, o := range orders {
+		if _, ok := runs[o.BatchID]; !ok {
+			runs[o.BatchID] = i
+		}
+	}
+	sort.SliceStable(orders, func(i, j int) bool {
+		if a, b := runs[orders[i].BatchID], runs[orders[j].BatchID]; a != b {
+			return a < b
+		}
+		return orders[i].BatchStop < orders[j].BatchStop
+	})
+	c.JSON(http.StatusOK, orders)
+}
+
+// riderOrder loads the order in the :id param if it is the rider's. Other
+// orders are not found, so that riders cannot look at each other's.
+func riderOrder(c *gin.Context) (models.Order, bool) {
+	var order models.Order
+	if err := database.DB.First(&order, "id = ? AND rider_id = ?", c.Param("id"), currentRider(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return order, false
+	}
+	return order, true
+}
+
+// AcceptDelivery confirms that the rider will take an order offered to
+// them, and tells the customer who is coming.
+func AcceptDelivery(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	order, ok := riderOrder(c)
+	if !ok {
+		return
+	}
+	if order.RiderAcceptedAt != nil {
+		c.JSON(http.StatusOK, order)
+		return
+	}
+	now := clock.Now()
+	result := database.DB.Model(&order).Where("rider_accepted_at IS NULL").Update("rider_accepted_at", now)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept order"})
+		return
+	}
+	order.RiderAcceptedAt = &now
+	if result.RowsAffected > 0 {
+		var rider models.Rider
+		if err := database.DB.First(&rider, *order.RiderID).Error; err == nil {
+			publish(events.RiderAssigned(order, events.Rider{ID: rider.ID, Name: rider.Name, Phone: rider.Phone}))
+		}
+	}
+	c.JSON(http.StatusOK, order)
+}
+
+// PickUpOrder sets the rider off with the order and gives it the delivery
+// code the customer will read out at the door.
+func PickUpOrder(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	order, ok := acceptedOrder(c, models.StatusReady, models.StatusOutForDelivery)
+	if !ok {
+		return
+	}
+	code, err := newDeliveryCode()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order"})
+		return
+	}
+	if !advanceOrder(c, &order, models.StatusReady, models.StatusOutForDelivery, func(tx *gorm.DB, order *models.Order, now time.Time) error {
+		order.PickedUpAt, order.DeliveryCode = &now, code
+		return nil
+	}) {
+		return
+	}
+	c.JSON(http.StatusOK, order)
+}
+
+// acceptedOrder loads the rider's order in the :id param, which they must
+// have accepted and which must be in status from to move on to to.
+func acceptedOrder(c *gin.Context, from, to string) (models.Order, bool) {
+	order, ok := riderOrder(c)
+	if !ok {
+		return order, false
+	}
+	if order.RiderAcceptedAt == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Accept the order first"})
+		return order, false
+	}
+	if order.Status != from {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot move order from " + order.Status + " to " + to})
+		return order, false
+	}
+	return order, true
+}
+
+var errOrderMoved = errors.New("order moved on")
+
+// advanceOrder moves order from one status to the next and tells the
+// customer. update sets the order's other fields and may write alongside
+// it in tx. It reports whether the order moved; if not the request has been
+// answered. A delivered order frees its rider for the next one waiting.
+func advanceOrder(c *gin.Context, order *models.Order, from, to string, update func(tx *gorm.DB, order *models.Order, now time.Time) error) bool {
+	order.Status = to
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := update(tx, order, clock.Now()); err != nil {
+			return err
+		}
+		result := tx.Model(order).Where("status = ?", from).
+			Select("status", "picked_up_at", "delivered_at", "delivered_with", "delivery_code").Updates(order)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errOrderMoved
+		}
+		return nil
+	})
+	if errors.Is(err, errOrderMoved) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Order was updated by someone else, please refresh"})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order"})
+		return false
+	}
+
+	publishChanges(order, from, order.PaymentStatus)
+	if to == models.StatusDelivered {
+		endTracking(order.ID)
+		orderDelivered(order)
+		dispatchWaiting()
+	}
+	return true
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"order-mgmt-backend/database"
+	"order-mgmt-backend/geo"
+	"order-mgmt-backend/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const codeNotServiceable = "ADDRESS_NOT_SERVICEABLE"
+
+var (
+	errNotServiceable = errors.New("delivery address is outside the service area")
+	errNoOutlet       = errors.New("outlet not found")
+)
+
+// findServingOutlet returns the outlet that can deliver to p together with
+// its distance. With a non-zero outletID only that outlet is considered,
+// and errNoOutlet is returned if there is no such outlet; otherwise the
+// nearest outlet whose radius covers p wins.
+func findServingOutlet(p geo.Point, outletID uint) (*models.Outlet, float64, error) {
+	var outlets []models.Outlet
+	query := database.DB
+	if outletID != 0 {
+		query = query.Where("id = ?", outletID)
+	}
+	if err := query.Find(&outlets).Error; err != nil {
+		return nil, 0, err
+	}
+	if outletID != 0 && len(outlets) == 0 {
+		return nil, 0, errNoOutlet
+	}
+
+	var best *models.Outlet
+	bestDistance := 0.0
+	for i := range outlets {
+		o := &outlets[i]
+		d := geo.DistanceKm(p, geo.Point{Lat: o.Latitude, Lng: o.Longitude})
+		if d > o.DeliveryRadiusKm {
+			continue
+		}
+		if best == nil || d < bestDistance {
+			best, bestDistance = o, d
+		}
+	}
+	if best == nil {
+		return nil, 0, errNotServiceable
+	}
+	return best, bestDistance, nil
+}
+
+// requestPoint reads the delivery coordinates from an order request. Every
+// order needs them, since without them there is no telling whether the
+// address is served.
+func requestPoint(req models.CreateOrderRequest) (geo.Point, error) {
+	if req.Latitude == nil || req.Longitude == nil {
+		return geo.Point{}, errors.New("latitude and longitude of the delivery address are required")
+	}
+	p := geo.Point{Lat: *req.Latitude, Lng: *req.Longitude}
+	if !p.Valid() {
+		return geo.Point{}, errors.New("invalid coordinates")
+	}
+	return p, nil
+}
+
+func GetServiceability(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	lat, latErr := strconv.ParseFloat(c.Query("lat"), 64)
+	lng, lngErr := strconv.ParseFloat(c.Query("lng"), 64)
+	p := geo.Point{Lat: lat, Lng: lng}
+	if latErr != nil || lngErr != nil || !p.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Valid lat and lng are required"})
+		return
+	}
+	var outletID uint64
+	if raw := c.Query("outlet_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid outlet_id"})
+			return
+		}
+		outletID = id
+	}
+
+	outlet, distance, err := findServingOutlet(p, uint(outletID))
+	if errors.Is(err, errNoOutlet) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Outlet not found"})
+		return
+	}
+	if errors.Is(err, errNotServiceable) {
+		c.JSON(http.StatusOK, gin.H{"serviceable": false, "code": codeNotServiceable})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check serviceability"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"serviceable": true, "outlet": outlet, "distance_km": distance})
+}
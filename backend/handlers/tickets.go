@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"net/http"
+	"order-mgmt-backend/database"
+	"order-mgmt-backend/models"
+	"order-mgmt-backend/printing"
+	"order-mgmt-backend/schedule"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultStoreName = "Order Management"
+
+// ticketHeader names the outlet that fulfils the order, or the store when
+// the order has none.
+func ticketHeader(order *models.Order) printing.Header {
+	h := printing.Header{StoreName: defaultStoreName, Location: schedule.StoreLocation()}
+	if order.OutletID == nil {
+		return h
+	}
+	var outlet models.Outlet
+	if err := database.DB.First(&outlet, *order.OutletID).Error; err == nil {
+		h.StoreName = outlet.Name
+		h.Address = outlet.Address
+		h.Location = schedule.LoadLocation(outlet.TimeZone)
+	}
+	return h
+}
+
+// GetOrderTicket renders a kitchen ticket (type=kitchen) or customer receipt
+// (type=receipt) as plain text or ESC/POS (format=text|escpos) for 58mm or
+// 80mm paper (width=58|80).
+func GetOrderTicket(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	if !followOrder(c) {
+		return
+	}
+
+	var width int
+	switch c.DefaultQuery("width", "80") {
+	case "58":
+		width = printing.Width58mm
+	case "80":
+		width = printing.Width80mm
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "width must be 58 or 80"})
+		return
+	}
+
+	var layout func(*models.Order, printing.Header, int) []printing.Line
+	switch c.DefaultQuery("type", "receipt") {
+	case "receipt":
+		layout = printing.Receipt
+	case "kitchen":
+		layout = printing.KitchenTicket
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be receipt or kitchen"})
+		return
+	}
+
+	format := c.DefaultQuery("format", "text")
+	if format != "text" && format != "escpos" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be text or escpos"})
+		return
+	}
+
+	var order models.Order
+	if err := database.DB.Preload("OrderItems.Item").First(&order, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	lines := layout(&order, ticketHeader(&order), width)
+	if format == "escpos" {
+		c.Data(http.StatusOK, "application/octet-stream", printing.ESCPOS(lines, width))
+		return
+	}
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", printing.Text(lines, width))
+}
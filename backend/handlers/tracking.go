@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"order-mgmt-backend/clock"
+	"order-mgmt-backend/database"
+	"order-mgmt-backend/events"
+	"order-mgmt-backend/geo"
+	"order-mgmt-backend/models"
+	"order-mgmt-backend/tracking"
+	"order-mgmt-backend/websocket"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// trackingConfig sets how rider pings are sampled and how often
+	// customers hear about them; see tracking.FromEnv.
+	trackingConfig   = loadTrackingConfig()
+	locationThrottle = tracking.NewThrottle(trackingConfig.PublishEvery)
+)
+
+var errInvalidLocation = errors.New("invalid location")
+
+func loadTrackingConfig() tracking.Config {
+	c, err := tracking.FromEnv()
+	if err != nil {
+		log.Printf("WARNING: %v, using the default tracking settings", err)
+	}
+	return c
+}
+
+// recordPing takes a GPS ping from a rider and reports whether it was kept.
+// A kept ping moves the rider and is added to the track of every order they
+// are carrying.
+func recordPing(riderID uint, req models.RiderLocationRequest) (bool, error) {
+	if req.Lat == nil || req.Lng == nil {
+		return false, errInvalidLocation
+	}
+	now := clock.Now()
+	p := tracking.Ping{Point: geo.Point{Lat: *req.Lat, Lng: *req.Lng}, SpeedKmh: req.SpeedKmh, At: now}
+	if !p.Point.Valid() || req.SpeedKmh < 0 {
+		return false, errInvalidLocation
+	}
+	if req.RecordedAt != nil && req.RecordedAt.Before(now) {
+		p.At = *req.RecordedAt
+	}
+
+	var rider models.Rider
+	if err := database.DB.First(&rider, riderID).Error; err != nil {
+		return false, err
+	}
+	var last *tracking.Ping
+	if rider.Lat != nil && rider.Lng != nil && rider.LocatedAt != nil {
+		last = &tracking.Ping{Point: geo.Point{Lat: *rider.Lat, Lng: *rider.Lng}, At: *rider.LocatedAt}
+	}
+	if !trackingConfig.Keep(last, p) {
+		return false, nil
+	}
+	if err := database.DB.Model(&rider).Updates(map[string]interface{}{
+		"lat":        p.Point.Lat,
+		"lng":        p.Point.Lng,
+		"located_at": p.At,
+	}).Error; err != nil {
+		return false, err
+	}
+
+	var carrying []models.Order
+	if err := database.DB.Where("rider_id = ? AND status = ?", riderID, models.StatusOutForDelivery).
+		Find(&carrying).Error; err != nil {
+		return true, err
+	}
+	for i := range carrying {
+		if err := trackOrder(&carrying[i], riderID, p); err != nil {
+			log.Printf("TRACKING ERROR: order %s: %v", carrying[i].ID, err)
+		}
+	}
+	return true, nil
+}
+
+// orderTrack returns the pings kept for an order, oldest first.
+func orderTrack(orderID string) ([]models.RiderPing, error) {
+	var track []models.RiderPing
+	err := database.DB.Where("order_id = ?", orderID).Order("recorded_at, id").Find(&track).Error
+	return track, err
+}
+
+// trackOrder adds p to the order's track, keeping only the latest pings,
+// and tells the customer where the rider is and, once it moves enough, when
+// they will arrive, after any stops before theirs in the rider's run.
+func trackOrder(order *models.Order, riderID uint, p tracking.Ping) error {
+	ping := models.RiderPing{OrderID: order.ID, RiderID: riderID, Lat: p.Point.Lat, Lng: p.Point.Lng, SpeedKmh: p.SpeedKmh, RecordedAt: p.At}
+	if err := database.DB.Create(&ping).Error; err != nil {
+		return err
+	}
+	latest := database.DB.Model(&models.RiderPing{}).Select("id").Where("order_id = ?", order.ID).
+		Order("recorded_at DESC, id DESC").Limit(trackingConfig.TrackLength)
+	if err := database.DB.Where("order_id = ? AND id NOT IN (?)", order.ID, latest).Delete(&models.RiderPing{}).Error; err != nil {
+		return err
+	}
+
+	now := clock.Now()
+	if locationThrottle.Allow(order.ID, now) {
+		publishLive(events.RiderLocation(*order, events.Location{Lat: p.Point.Lat, Lng: p.Point.Lng, SpeedKmh: p.SpeedKmh}))
+	}
+	if order.DeliveryLat == nil || order.DeliveryLng == nil {
+		return nil
+	}
+	stored, err := orderTrack(order.ID)
+	if err != nil {
+		return err
+	}
+	track := make([]tracking.Ping, len(stored))
+	for i, s := range stored {
+		track[i] = tracking.Ping{Point: geo.Point{Lat: s.Lat, Lng: s.Lng}, SpeedKmh: s.SpeedKmh, At: s.RecordedAt}
+	}
+	drops, err := dropsUntil(order)
+	if err != nil {
+		return err
+	}
+	arrivals := batchConfig.Arrivals(p.Point, drops, trackingConfig.Speed(track), now)
+	eta := arrivals[len(arrivals)-1]
+	if !trackingConfig.Moved(order.EstimatedDeliveryAt, eta) {
+		return nil
+	}
+	if err := database.DB.Model(order).Update("estimated_delivery_at", eta).Error; err != nil {
+		return err
+	}
+	order.EstimatedDeliveryAt = &eta
+	publish(events.ETAUpdated(*order))
+	return nil
+}
+
+// endTracking drops a delivered order's track.
+func endTracking(orderID string) {
+	locationThrottle.Forget(orderID)
+	database.DB.Where("order_id = ?", orderID).Delete(&models.RiderPing{})
+}
+
+// RecordRiderLocation takes one GPS ping. Pings that sampling drops are
+// still answered 200, with kept false.
+func RecordRiderLocation(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	var req models.RiderLocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	kept, err := recordPing(currentRider(c), req)
+	if errors.Is(err, errInvalidLocation) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record location"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"kept": kept})
+}
+
+// RiderWS streams the orders offered to the rider and takes their GPS
+// pings, each answered with an ack or an error.
+func RiderWS(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	id := currentRider(c)
+	topic := websocket.RiderTopic(strconv.FormatUint(uint64(id), 10))
+	websocket.GlobalHub.ServeInbound(topic, c.Writer, c.Request, func(msg []byte) []byte {
+		var req models.RiderLocationRequest
+		reply := gin.H{"type": "ack"}
+		if err := json.Unmarshal(msg, &req); err != nil {
+			reply = gin.H{"type": "error", "error": "invalid message"}
+		} else if kept, err := recordPing(id, req); errors.Is(err, errInvalidLocation) {
+			reply = gin.H{"type": "error", "error": "invalid location"}
+		} else if err != nil {
+			reply = gin.H{"type": "error", "error": "failed to record location"}
+		} else {
+			reply["kept"] = kept
+		}
+		out, _ := json.Marshal(reply)
+		return out
+	})
+}
+
+// GetOrderTrack returns the recent positions of the rider carrying an order,
+// oldest first, to whoever may follow the order.
+func GetOrderTrack(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	orderID := c.Param("id")
+	v, ok := requestViewer(c)
+	if !ok {
+		return
+	}
+	if err := v.canFollowOrder(orderID); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	track, err := orderTrack(orderID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load track"})
+		return
+	}
+	c.JSON(http.StatusOK, track)
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"order-mgmt-backend/clock"
+	"order-mgmt-backend/database"
+	"order-mgmt-backend/models"
+	"order-mgmt-backend/wallet"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// actorAdmin records credits granted through the admin API. Admins share a
+// single key, so individual staff cannot be told apart.
+const actorAdmin = "admin"
+
+func ledger() wallet.Ledger {
+	return wallet.Ledger{DB: database.DB}
+}
+
+// pathUser loads the user in the :id param.
+func pathUser(c *gin.Context) (models.User, bool) {
+	var user models.User
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return user, false
+	}
+	if err := database.DB.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return user, false
+	}
+	return user, true
+}
+
+// accountUser loads the user in the :id param for that user's own token or
+// an admin, and answers anyone else with 401 or 403.
+func accountUser(c *gin.Context) (models.User, bool) {
+	v, ok := requestViewer(c)
+	if !ok {
+		return models.User{}, false
+	}
+	if !v.admin && (v.claims.UserID == 0 || c.Param("id") != strconv.FormatUint(uint64(v.claims.UserID), 10)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not your account"})
+		return models.User{}, false
+	}
+	return pathUser(c)
+}
+
+func GetWallet(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	user, ok := accountUser(c)
+	if !ok {
+		return
+	}
+	txns, err := ledger().Statement(c.Request.Context(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load wallet"})
+		return
+	}
+	balance, err := ledger().Balance(c.Request.Context(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load wallet"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user_id": user.ID, "balance": balance, "transactions": txns})
+}
+
+func GrantCredit(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	var req models.GrantCreditRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := pathUser(c)
+	if !ok {
+		return
+	}
+	grant := wallet.Grant{
+		UserID:    user.ID,
+		Amount:    req.Amount,
+		Reference: "grant:" + req.Reference,
+		Reason:    req.Reason,
+		Actor:     actorAdmin,
+	}
+	if req.ExpiresInDays > 0 {
+		expires := clock.Now().Add(time.Duration(req.ExpiresInDays) * 24 * time.Hour)
+		grant.ExpiresAt = &expires
+	}
+
+	txn, created, err := ledger().Grant(c.Request.Context(), grant)
+	if errors.Is(err, wallet.ErrReferenceReuse) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to grant credit"})
+		return
+	}
+	if !created {
+		c.JSON(http.StatusOK, txn)
+		return
+	}
+	c.JSON(http.StatusCreated, txn)
+}
+
+// ExpireWallets writes off every expired credit that has not been spent.
+func ExpireWallets(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	checked, err := ledger().ExpireAll(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to expire credits"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"checked": checked})
+}
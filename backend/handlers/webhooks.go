@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"order-mgmt-backend/clock"
+	"order-mgmt-backend/database"
+	"order-mgmt-backend/models"
+	"order-mgmt-backend/payments"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	webhookTolerance   = 5 * time.Minute
+	maxWebhookBody     = 1 << 20
+	maxWebhookAttempts = 8
+)
+
+var errUnknownIntent = errors.New("no order matches the payment intent")
+
+// webhookBackoff is the wait before retry attempt n+1: one minute doubling
+// up to an hour.
+func webhookBackoff(attempts int) time.Duration {
+	wait := time.Minute << (attempts - 1)
+	if wait > time.Hour || wait <= 0 {
+		return time.Hour
+	}
+	return wait
+}
+
+// applyPaymentEvent applies event to its order exactly once. The event is
+// recorded in the same transaction as the order change, so a replay either
+// finds the record and is skipped or the whole change is rolled back.
+func applyPaymentEvent(ctx context.Context, event payments.Event) (bool, error) {
+	var order models.Order
+	var previousStatus, previousPayment string
+	duplicate, released := false, false
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		record := models.WebhookEvent{
+			Provider:    event.Provider,
+			EventID:     event.ID,
+			Type:        event.Type,
+			OrderID:     event.Intent.OrderID,
+			ProcessedAt: clock.Now().UTC(),
+		}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			duplicate = true
+			return nil
+		}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&order, "payment_intent_id = ?", event.Intent.ID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errUnknownIntent
+			}
+			return err
+		}
+		previousStatus, previousPayment = order.Status, order.PaymentStatus
+		var err error
+		released, err = applyIntent(tx, &order, event.Intent)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	database.DB.Where("provider = ? AND event_id = ?", event.Provider, event.ID).Delete(&models.WebhookRetry{})
+	if duplicate {
+		return true, nil
+	}
+	publishChanges(&order, previousStatus, previousPayment)
+	if released {
+		releaseOrder(&order)
+	}
+	if order.Status == models.StatusCancelled {
+		refundCancelledOrder(ctx, &order)
+	}
+	if event.Intent.Status == payments.StatusAuthorized {
+		settlePayment(ctx, &order, event.Intent)
+	}
+	return false, nil
+}
+
+// queueWebhookRetry stores an event that failed so RetryWebhooks can apply
+// it later. A redelivery of an already queued event counts as an attempt.
+func queueWebhookRetry(event payments.Event, body []byte, cause error) error {
+	now := clock.Now().UTC()
+	retry := models.WebhookRetry{
+		Provider:      event.Provider,
+		EventID:       event.ID,
+		Payload:       string(body),
+		Attempts:      1,
+		LastError:     cause.Error(),
+		NextAttemptAt: now.Add(webhookBackoff(1)),
+	}
+	return database.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "provider"}, {Name: "event_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"attempts":   gorm.Expr("webhook_retries.attempts + 1"),
+			"last_error": retry.LastError,
+		}),
+	}).Create(&retry).Error
+}
+
+func PaymentWebhook(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	secret := os.Getenv("PAYMENT_WEBHOOK_SECRET")
+	if secret == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Payment webhooks are not configured"})
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookBody))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read body"})
+		return
+	}
+	err = payments.Verify([]byte(secret), c.GetHeader(payments.TimestampHeader), c.GetHeader(payments.SignatureHeader), body, clock.Now(), webhookTolerance)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var event payments.Event
+	if err := json.Unmarshal(body, &event); err != nil || event.ID == "" || event.Intent.ID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event payload"})
+		return
+	}
+	if event.Provider == "" {
+		event.Provider = payments.Default.Name()
+	}
+
+	duplicate, err := applyPaymentEvent(c.Request.Context(), event)
+	if err != nil {
+		log.Printf("WEBHOOK ERROR: event %s: %v", event.ID, err)
+		if err := queueWebhookRetry(event, body, err); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process event"})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"status": "queued"})
+		return
+	}
+	if duplicate {
+		c.JSON(http.StatusOK, gin.H{"status": "duplicate"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "processed"})
+}
+
+// RetryWebhooks applies queued events whose next attempt is due.
+func RetryWebhooks(c *gin.Context) {
+	if database.DB == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not connected"})
+		return
+	}
+	now := clock.Now().UTC()
+	var due []models.WebhookRetry
+	if err := database.DB.Where("exhausted = ? AND next_attempt_at <= ?", false, now).Find(&due).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load retries"})
+		return
+	}
+
+	processed, failed := 0, 0
+	for _, retry := range due {
+		var event payments.Event
+		err := json.Unmarshal([]byte(retry.Payload), &event)
+		if err == nil {
+			if event.Provider == "" {
+				event.Provider = retry.Provider
+			}
+			_, err = applyPaymentEvent(c.Request.Context(), event)
+		} else {
+			err = fmt.Errorf("invalid payload: %w", err)
+		}
+		if err == nil {
+			processed++
+			continue
+		}
+
+		failed++
+		retry.Attempts++
+		retry.LastError = err.Error()
+		retry.NextAttemptAt = now.Add(webhookBackoff(retry.Attempts))
+		retry.Exhausted = retry.Attempts >= maxWebhookAttempts
+		database.DB.Save(&retry)
+	}
+	c.JSON(http.StatusOK, gin.H{"processed": processed, "failed": failed})
+}
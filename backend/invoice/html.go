@@ -0,0 +1,78 @@
+package invoice
+
+import (
+	"bytes"
+	"html/template"
+)
+
+var htmlTemplate = template.Must(template.New("invoice").Funcs(template.FuncMap{
+	"money": money,
+	"inc":   func(i int) int { return i + 1 },
+	"rate":  halfRateLabel,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Tax Invoice {{.Number}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; color: #222; max-width: 760px; margin: 32px auto; }
+h1 { font-size: 20px; text-align: center; letter-spacing: 2px; }
+table { width: 100%; border-collapse: collapse; margin-top: 16px; }
+th, td { padding: 6px 8px; border-bottom: 1px solid #ddd; text-align: left; }
+.num { text-align: right; }
+.meta td { border: none; padding: 2px 8px; vertical-align: top; }
+.totals td { border: none; }
+.grand td { font-weight: bold; border-top: 2px solid #222; }
+</style>
+</head>
+<body>
+<h1>TAX INVOICE</h1>
+<table class="meta">
+<tr>
+<td>
+<strong>{{.Seller.Name}}</strong><br>
+{{.Seller.Address}}<br>
+GSTIN: {{.Seller.GSTIN}}
+</td>
+<td class="num">
+Invoice No: <strong>{{.Number}}</strong><br>
+Date: {{.Date.Format "02 Jan 2006"}}<br>
+Order: {{.OrderID}}
+</td>
+</tr>
+<tr>
+<td colspan="2">
+<strong>Bill to</strong><br>
+{{.CustomerName}}<br>
+{{.Address}}<br>
+{{.Phone}}
+</td>
+</tr>
+</table>
+<table>
+<thead>
+<tr><th>#</th><th>Item</th><th class="num">Qty</th><th class="num">Rate</th><th class="num">Amount</th></tr>
+</thead>
+<tbody>
+{{range $i, $l := .Lines}}<tr><td>{{inc $i}}</td><td>{{$l.Description}}</td><td class="num">{{$l.Quantity}}</td><td class="num">{{money $l.Rate}}</td><td class="num">{{money $l.Amount}}</td></tr>
+{{end}}</tbody>
+</table>
+<table class="totals">
+{{if .Discount}}<tr><td class="num">Loyalty discount</td><td class="num">-{{money .Discount}}</td></tr>
+{{end}}<tr><td class="num">Taxable value</td><td class="num">{{money .Taxable}}</td></tr>
+<tr><td class="num">CGST @ {{rate}}</td><td class="num">{{money .CGST}}</td></tr>
+<tr><td class="num">SGST @ {{rate}}</td><td class="num">{{money .SGST}}</td></tr>
+<tr class="grand"><td class="num">Total (incl. GST)</td><td class="num">{{money .Total}}</td></tr>
+</table>
+</body>
+</html>
+`))
+
+// HTML renders the invoice as a standalone HTML page.
+func HTML(doc Document) ([]byte, error) {
+	var b bytes.Buffer
+	if err := htmlTemplate.Execute(&b, doc); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
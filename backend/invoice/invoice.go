@@ -0,0 +1,148 @@
+package invoice
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"order-mgmt-backend/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GSTRate is the GST charged on restaurant food. Menu prices include it, so
+// invoices back the taxable value out of the amount paid and split the tax
+// equally into CGST and SGST for intra-state supply.
+const GSTRate = 0.05
+
+// Seller is the outlet issuing the invoice.
+type Seller struct {
+	Name     string
+	Address  string
+	GSTIN    string
+	Location *time.Location
+}
+
+type Line struct {
+	Description string
+	Quantity    int
+	Rate        float64
+	Amount      float64
+}
+
+// Document is everything printed on a tax invoice.
+type Document struct {
+	Number       string
+	Date         time.Time
+	OrderID      string
+	Seller       Seller
+	CustomerName string
+	Address      string
+	Phone        string
+	Lines        []Line
+	Discount     float64
+	Taxable      float64
+	CGST         float64
+	SGST         float64
+	Total        float64
+}
+
+func money(v float64) string {
+	return fmt.Sprintf("%.2f", v)
+}
+
+// halfRateLabel is the CGST or SGST rate, each being half of GSTRate.
+func halfRateLabel() string {
+	return fmt.Sprintf("%g%%", GSTRate*100/2)
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// Build prepares the invoice for an order that already has a number.
+func Build(order *models.Order, seller Seller) Document {
+	doc := Document{
+		Seller:       seller,
+		OrderID:      order.ID,
+		CustomerName: order.CustomerName,
+		Address:      order.CustomerAddress,
+		Phone:        order.CustomerPhone,
+		Discount:     round2(order.Discount),
+		Total:        round2(order.TotalPrice),
+	}
+	if order.InvoiceNumber != nil {
+		doc.Number = *order.InvoiceNumber
+	}
+	if order.InvoicedAt != nil {
+		doc.Date = order.InvoicedAt.In(seller.Location)
+	}
+	for _, item := range order.OrderItems {
+		doc.Lines = append(doc.Lines, Line{
+			Description: item.Item.Name,
+			Quantity:    item.Quantity,
+			Rate:        round2(item.Price),
+			Amount:      round2(item.Price * float64(item.Quantity)),
+		})
+	}
+	doc.Taxable = round2(doc.Total / (1 + GSTRate))
+	tax := round2(doc.Total - doc.Taxable)
+	// Put any odd paisa on CGST so the halves always add back up to the tax.
+	doc.SGST = math.Floor(tax*100/2) / 100
+	doc.CGST = round2(tax - doc.SGST)
+	return doc
+}
+
+// FinancialYear returns the Indian financial year (April to March) that t
+// falls in, e.g. "2025-26".
+func FinancialYear(t time.Time) string {
+	start := t.Year()
+	if t.Month() < time.April {
+		start--
+	}
+	return fmt.Sprintf("%d-%02d", start, (start+1)%100)
+}
+
+// ErrAlreadyInvoiced is returned by Assign for orders that have a number.
+var ErrAlreadyInvoiced = errors.New("order already has an invoice number")
+
+// Assign gives the order the next invoice number for its outlet and the
+// financial year of now. The counter and the order are updated in one
+// transaction with the counter row locked, so numbers are gap-free even when
+// several orders are invoiced at once.
+func Assign(db *gorm.DB, orderID string, now time.Time, loc *time.Location) (string, error) {
+	var number string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, "id = ?", orderID).Error; err != nil {
+			return err
+		}
+		if order.InvoiceNumber != nil {
+			number = *order.InvoiceNumber
+			return ErrAlreadyInvoiced
+		}
+
+		var outletID uint
+		if order.OutletID != nil {
+			outletID = *order.OutletID
+		}
+		seq := models.InvoiceSequence{OutletID: outletID, FinancialYear: FinancialYear(now.In(loc))}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&seq).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("outlet_id = ? AND financial_year = ?", seq.OutletID, seq.FinancialYear).
+			First(&seq).Error; err != nil {
+			return err
+		}
+		seq.Last++
+		if err := tx.Model(&seq).Update("last", seq.Last).Error; err != nil {
+			return err
+		}
+
+		number = fmt.Sprintf("INV/%d/%s/%06d", seq.OutletID, seq.FinancialYear, seq.Last)
+		return tx.Model(&order).Updates(map[string]interface{}{"invoice_number": number, "invoiced_at": now}).Error
+	})
+	return number, err
+}
@@ -0,0 +1,124 @@
+package invoice
+
+import (
+	"bytes"
+	"fmt"
+	"order-mgmt-backend/database"
+	"order-mgmt-backend/models"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func sampleDocument() Document {
+	number := "INV/1/2025-26/000042"
+	invoiced := time.Date(2026, 3, 5, 12, 0, 0, 0, time.UTC)
+	order := &models.Order{
+		ID:              "3f2a9c1e-5b7d-4e8f-a1b2-c3d4e5f60718",
+		CustomerName:    "Priya <Sharma>",
+		CustomerAddress: "12th Main Road, Indiranagar",
+		CustomerPhone:   "9876543210",
+		TotalPrice:      1097,
+		InvoiceNumber:   &number,
+		InvoicedAt:      &invoiced,
+		OrderItems: []models.OrderItem{
+			{Quantity: 2, Price: 299, Item: models.Item{Name: "Margherita Pizza"}},
+			{Quantity: 1, Price: 499, Item: models.Item{Name: "Pepperoni (Large)"}},
+		},
+	}
+	return Build(order, Seller{Name: "Bengaluru Central Kitchen", GSTIN: "29ABCDE1234F1Z5", Location: time.UTC})
+}
+
+func TestBuildTaxBreakup(t *testing.T) {
+	doc := sampleDocument()
+	assert.Equal(t, 1044.76, doc.Taxable)
+	assert.Equal(t, 26.12, doc.CGST)
+	assert.Equal(t, 26.12, doc.SGST)
+	assert.InDelta(t, doc.Total, doc.Taxable+doc.CGST+doc.SGST, 1e-9)
+	assert.Equal(t, 598.0, doc.Lines[0].Amount)
+}
+
+func TestFinancialYear(t *testing.T) {
+	assert.Equal(t, "2025-26", FinancialYear(time.Date(2026, 3, 31, 23, 0, 0, 0, time.UTC)))
+	assert.Equal(t, "2026-27", FinancialYear(time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, "1999-00", FinancialYear(time.Date(1999, 12, 1, 0, 0, 0, 0, time.UTC)))
+}
+
+func TestAssignIsSequentialPerOutletAndYear(t *testing.T) {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	database.Migrate(db)
+
+	outlet := uint(7)
+	march := time.Date(2026, 3, 20, 10, 0, 0, 0, time.UTC)
+	april := time.Date(2026, 4, 2, 10, 0, 0, 0, time.UTC)
+
+	assign := func(outletID *uint, at time.Time) string {
+		order := models.NewOrder()
+		order.OutletID = outletID
+		db.Create(order)
+		number, err := Assign(db, order.ID, at, time.UTC)
+		assert.NoError(t, err)
+		return number
+	}
+
+	assert.Equal(t, "INV/7/2025-26/000001", assign(&outlet, march))
+	assert.Equal(t, "INV/7/2025-26/000002", assign(&outlet, march))
+	assert.Equal(t, "INV/0/2025-26/000001", assign(nil, march))
+	assert.Equal(t, "INV/7/2026-27/000001", assign(&outlet, april))
+
+	order := models.NewOrder()
+	db.Create(order)
+	first, _ := Assign(db, order.ID, april, time.UTC)
+	again, err := Assign(db, order.ID, april, time.UTC)
+	assert.ErrorIs(t, err, ErrAlreadyInvoiced)
+	assert.Equal(t, first, again)
+}
+
+func TestHTML(t *testing.T) {
+	out, err := HTML(sampleDocument())
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), "INV/1/2025-26/000042")
+	assert.Contains(t, string(out), "29ABCDE1234F1Z5")
+	assert.Contains(t, string(out), "Priya &lt;Sharma&gt;")
+	assert.Contains(t, string(out), "CGST @ 2.5%")
+	assert.Contains(t, string(out), "1097.00")
+	assert.NotContains(t, string(out), "Loyalty discount")
+
+	doc := sampleDocument()
+	doc.Discount = 50
+	out, _ = HTML(doc)
+	assert.Contains(t, string(out), "Loyalty discount")
+	assert.Contains(t, string(out), "-50.00")
+}
+
+func TestPDFStructure(t *testing.T) {
+	out := PDF(sampleDocument())
+	assert.True(t, bytes.HasPrefix(out, []byte("%PDF-1.4\n")))
+	assert.True(t, bytes.HasSuffix(out, []byte("%%EOF\n")))
+	assert.Contains(t, string(out), `(Pepperoni \(Large\))`)
+
+	// Every xref entry must point at the start of its object.
+	xref := regexp.MustCompile(`startxref\n(\d+)`).FindSubmatch(out)
+	start, _ := strconv.Atoi(string(xref[1]))
+	assert.True(t, bytes.HasPrefix(out[start:], []byte("xref\n")))
+	entries := regexp.MustCompile(`(\d{10}) 00000 n`).FindAllSubmatch(out[start:], -1)
+	assert.Len(t, entries, 6)
+	for i, e := range entries {
+		off, _ := strconv.Atoi(string(e[1]))
+		assert.True(t, bytes.HasPrefix(out[off:], []byte(fmt.Sprintf("%d 0 obj", i+1))))
+	}
+}
+
+func TestPDFPaginates(t *testing.T) {
+	doc := sampleDocument()
+	for i := 0; i < 80; i++ {
+		doc.Lines = append(doc.Lines, Line{Description: "Masala Dosa", Quantity: 1, Rate: 120, Amount: 120})
+	}
+	out := PDF(doc)
+	assert.Contains(t, string(out), "/Count 2")
+}
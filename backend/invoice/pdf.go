@@ -0,0 +1,212 @@
+package invoice
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A small PDF 1.4 writer, enough for text-only invoices. It uses the
+// built-in Courier fonts, which every reader ships and whose fixed advance
+// (600/1000 em) makes right-aligned columns easy without font metrics.
+
+const (
+	pageWidth  = 595.0 // A4 in points
+	pageHeight = 842.0
+	margin     = 50.0
+	charWidth  = 0.6 // Courier advance per point of font size
+)
+
+type pdfPage struct {
+	content bytes.Buffer
+}
+
+type pdfWriter struct {
+	pages []*pdfPage
+	y     float64
+}
+
+func newPDFWriter() *pdfWriter {
+	w := &pdfWriter{}
+	w.newPage()
+	return w
+}
+
+func (w *pdfWriter) newPage() {
+	w.pages = append(w.pages, &pdfPage{})
+	w.y = pageHeight - margin
+}
+
+func (w *pdfWriter) page() *pdfPage {
+	return w.pages[len(w.pages)-1]
+}
+
+// ensure starts a new page when fewer than height points remain.
+func (w *pdfWriter) ensure(height float64) {
+	if w.y-height < margin {
+		w.newPage()
+	}
+}
+
+func pdfEscape(s string) string {
+	s = ascii(s)
+	r := strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`)
+	return r.Replace(s)
+}
+
+// ascii keeps text inside the standard fonts' character set.
+func ascii(s string) string {
+	s = strings.ReplaceAll(s, "₹", "Rs.")
+	return strings.Map(func(r rune) rune {
+		if r >= 0x20 && r < 0x7f {
+			return r
+		}
+		return '?'
+	}, s)
+}
+
+func textWidth(s string, size float64) float64 {
+	return float64(len(ascii(s))) * size * charWidth
+}
+
+func (w *pdfWriter) text(x float64, s string, size float64, bold bool) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(&w.page().content, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, w.y, pdfEscape(s))
+}
+
+func (w *pdfWriter) textRight(right float64, s string, size float64, bold bool) {
+	w.text(right-textWidth(s, size), s, size, bold)
+}
+
+func (w *pdfWriter) rule() {
+	fmt.Fprintf(&w.page().content, "%.2f %.2f m %.2f %.2f l S\n", margin, w.y, pageWidth-margin, w.y)
+}
+
+func (w *pdfWriter) down(points float64) {
+	w.y -= points
+}
+
+// bytes assembles the document: catalog, page tree, fonts, then one page
+// and content stream per page, followed by the cross-reference table.
+func (w *pdfWriter) bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+	kids := make([]string, len(w.pages))
+	for i := range w.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(w.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>")
+	for i, p := range w.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", p.content.Len(), p.content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+// PDF renders the invoice as an A4 PDF document.
+func PDF(doc Document) []byte {
+	w := newPDFWriter()
+	right := pageWidth - margin
+
+	w.text(pageWidth/2-textWidth("TAX INVOICE", 16)/2, "TAX INVOICE", 16, true)
+	w.down(30)
+
+	w.text(margin, doc.Seller.Name, 11, true)
+	w.textRight(right, "Invoice No: "+doc.Number, 10, true)
+	w.down(14)
+	w.text(margin, doc.Seller.Address, 9, false)
+	w.textRight(right, "Date: "+doc.Date.Format("02 Jan 2006"), 10, false)
+	w.down(14)
+	w.text(margin, "GSTIN: "+doc.Seller.GSTIN, 9, false)
+	w.textRight(right, "Order: "+doc.OrderID, 8, false)
+	w.down(26)
+
+	w.text(margin, "Bill to", 10, true)
+	w.down(14)
+	for _, s := range []string{doc.CustomerName, doc.Address, doc.Phone} {
+		w.text(margin, s, 9, false)
+		w.down(12)
+	}
+	w.down(10)
+
+	qtyRight, rateRight := right-170.0, right-90.0
+	header := func() {
+		w.rule()
+		w.down(14)
+		w.text(margin, "#", 9, true)
+		w.text(margin+25, "Item", 9, true)
+		w.textRight(qtyRight, "Qty", 9, true)
+		w.textRight(rateRight, "Rate", 9, true)
+		w.textRight(right, "Amount", 9, true)
+		w.down(8)
+		w.rule()
+		w.down(14)
+	}
+	header()
+	for i, l := range doc.Lines {
+		if w.y-14 < margin {
+			w.newPage()
+			header()
+		}
+		maxChars := int((qtyRight - 40 - margin - 25) / (9 * charWidth))
+		w.text(margin, fmt.Sprint(i+1), 9, false)
+		w.text(margin+25, truncate(l.Description, maxChars), 9, false)
+		w.textRight(qtyRight, fmt.Sprint(l.Quantity), 9, false)
+		w.textRight(rateRight, money(l.Rate), 9, false)
+		w.textRight(right, money(l.Amount), 9, false)
+		w.down(14)
+	}
+
+	w.ensure(94)
+	w.rule()
+	w.down(16)
+	type total struct {
+		label  string
+		amount string
+	}
+	var totals []total
+	if doc.Discount > 0 {
+		totals = append(totals, total{"Loyalty discount", "-" + money(doc.Discount)})
+	}
+	totals = append(totals,
+		total{"Taxable value", money(doc.Taxable)},
+		total{"CGST @ " + halfRateLabel(), money(doc.CGST)},
+		total{"SGST @ " + halfRateLabel(), money(doc.SGST)},
+	)
+	for _, t := range totals {
+		w.textRight(rateRight, t.label, 9, false)
+		w.textRight(right, t.amount, 9, false)
+		w.down(14)
+	}
+	w.textRight(rateRight, "Total (incl. GST)", 10, true)
+	w.textRight(right, "Rs. "+money(doc.Total), 10, true)
+
+	return w.bytes()
+}
+
+func truncate(s string, n int) string {
+	if n < 1 || len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
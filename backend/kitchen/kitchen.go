@@ -0,0 +1,71 @@
+package kitchen
+
+import "time"
+
+const (
+	// DefaultPrepTime applies to items that have no prep time configured.
+	DefaultPrepTime = 10 * time.Minute
+	// extraPortionTime is added for every portion beyond the first, since a
+	// station can usually cook several portions of a dish together.
+	extraPortionTime = time.Minute
+)
+
+type Line struct {
+	PrepTime time.Duration
+	Quantity int
+}
+
+// PrepTime estimates how long one order takes at a single station: the
+// slowest dish sets the pace and each additional portion adds a little.
+func PrepTime(lines []Line) time.Duration {
+	var slowest time.Duration
+	portions := 0
+	for _, l := range lines {
+		prep := l.PrepTime
+		if prep <= 0 {
+			prep = DefaultPrepTime
+		}
+		if prep > slowest {
+			slowest = prep
+		}
+		portions += l.Quantity
+	}
+	if portions > 1 {
+		slowest += time.Duration(portions-1) * extraPortionTime
+	}
+	return slowest
+}
+
+// Queue is the work already accepted by a kitchen.
+type Queue struct {
+	Stations  int
+	Capacity  int           // maximum in-flight orders, zero for no limit
+	InFlight  int           // orders accepted but not yet ready
+	Backlog   time.Duration // summed prep time of in-flight orders
+	NextFreed time.Time     // earliest time an in-flight order is ready
+}
+
+// Full reports whether the queue has reached its capacity.
+func (q Queue) Full() bool {
+	return q.Capacity > 0 && q.InFlight >= q.Capacity
+}
+
+// Estimate is when a new order starts cooking and when it will be ready.
+type Estimate struct {
+	StartAt time.Time
+	ReadyAt time.Time
+}
+
+// Schedule places an order that needs prep behind the queue at now. When the
+// queue is full the order waits for the next slot to free up.
+func (q Queue) Schedule(prep time.Duration, now time.Time) Estimate {
+	stations := q.Stations
+	if stations < 1 {
+		stations = 1
+	}
+	start := now.Add(q.Backlog / time.Duration(stations))
+	if q.Full() && q.NextFreed.After(start) {
+		start = q.NextFreed
+	}
+	return Estimate{StartAt: start, ReadyAt: start.Add(prep)}
+}
@@ -0,0 +1,36 @@
+package kitchen
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrepTime(t *testing.T) {
+	assert.Equal(t, 15*time.Minute, PrepTime([]Line{{PrepTime: 15 * time.Minute, Quantity: 1}}))
+	assert.Equal(t, 17*time.Minute, PrepTime([]Line{
+		{PrepTime: 15 * time.Minute, Quantity: 1},
+		{PrepTime: 5 * time.Minute, Quantity: 2},
+	}))
+	assert.Equal(t, DefaultPrepTime, PrepTime([]Line{{Quantity: 1}}))
+}
+
+func TestQueueSchedule(t *testing.T) {
+	now := time.Date(2026, 3, 5, 12, 0, 0, 0, time.UTC)
+
+	idle := Queue{Stations: 2}
+	est := idle.Schedule(10*time.Minute, now)
+	assert.Equal(t, now, est.StartAt)
+	assert.Equal(t, now.Add(10*time.Minute), est.ReadyAt)
+
+	busy := Queue{Stations: 2, InFlight: 3, Backlog: 40 * time.Minute}
+	est = busy.Schedule(10*time.Minute, now)
+	assert.Equal(t, now.Add(20*time.Minute), est.StartAt)
+	assert.Equal(t, now.Add(30*time.Minute), est.ReadyAt)
+
+	full := Queue{Stations: 1, Capacity: 2, InFlight: 2, Backlog: 10 * time.Minute, NextFreed: now.Add(25 * time.Minute)}
+	assert.True(t, full.Full())
+	est = full.Schedule(10*time.Minute, now)
+	assert.Equal(t, now.Add(25*time.Minute), est.StartAt)
+}
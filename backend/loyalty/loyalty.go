@@ -0,0 +1,96 @@
+// Package loyalty holds the arithmetic of the loyalty programme: how many
+// points an order earns and what redeeming points is worth at checkout.
+package loyalty
+
+import (
+	"errors"
+	"math"
+	"order-mgmt-backend/models"
+	"sort"
+)
+
+var ErrInvalidRules = errors.New("invalid loyalty rules")
+
+// Defaults are used until an admin saves rules of their own: one point per
+// ten rupees, a point worth 25 paise, and at most half an order paid in
+// points.
+func Defaults() models.LoyaltyRules {
+	return models.LoyaltyRules{
+		PointsPerRupee:   0.1,
+		PointValue:       0.25,
+		MaxRedeemPercent: 50,
+		Tiers: []models.LoyaltyTier{
+			{Name: "Bronze", MinPoints: 0, Multiplier: 1},
+			{Name: "Silver", MinPoints: 500, Multiplier: 1.25},
+			{Name: "Gold", MinPoints: 2000, Multiplier: 1.5},
+		},
+	}
+}
+
+// Validate checks that rules can be applied and sorts the tiers by
+// threshold. There must be a tier starting at zero points.
+func Validate(rules *models.LoyaltyRules) error {
+	if rules.PointsPerRupee < 0 || rules.PointValue <= 0 ||
+		rules.MaxRedeemPercent < 0 || rules.MaxRedeemPercent > 100 || len(rules.Tiers) == 0 {
+		return ErrInvalidRules
+	}
+	sort.SliceStable(rules.Tiers, func(i, j int) bool { return rules.Tiers[i].MinPoints < rules.Tiers[j].MinPoints })
+	if rules.Tiers[0].MinPoints != 0 {
+		return ErrInvalidRules
+	}
+	for _, t := range rules.Tiers {
+		if t.Name == "" || t.Multiplier <= 0 {
+			return ErrInvalidRules
+		}
+	}
+	return nil
+}
+
+// Tier returns the tier a customer is in after earning lifetime points.
+// Tiers must be sorted, as Validate leaves them.
+func Tier(rules models.LoyaltyRules, lifetime int) models.LoyaltyTier {
+	tier := rules.Tiers[0]
+	for _, t := range rules.Tiers {
+		if lifetime >= t.MinPoints {
+			tier = t
+		}
+	}
+	return tier
+}
+
+// Earn returns the points an order paying amount earns for a customer who
+// has already earned lifetime points. Fractions of a point are dropped.
+func Earn(rules models.LoyaltyRules, amount float64, lifetime int) int {
+	if amount <= 0 {
+		return 0
+	}
+	points := amount * rules.PointsPerRupee * Tier(rules, lifetime).Multiplier
+	return int(math.Floor(points + 1e-9))
+}
+
+// Redeem returns how many of the requested points can be spent on an order
+// of total and the discount they give, within MaxRedeemPercent of it.
+func Redeem(rules models.LoyaltyRules, requested int, total float64) (int, float64) {
+	if requested <= 0 || total <= 0 {
+		return 0, 0
+	}
+	maxDiscount := total * rules.MaxRedeemPercent / 100
+	points := requested
+	if cap := int(math.Floor(maxDiscount/rules.PointValue + 1e-9)); points > cap {
+		points = cap
+	}
+	return points, math.Round(float64(points)*rules.PointValue*100) / 100
+}
+
+// Reversal returns how many earned points to take back when refunded of an
+// order's total is refunded, never more than remain.
+func Reversal(earned, reversed int, refunded, total float64) int {
+	if earned <= 0 || total <= 0 {
+		return 0
+	}
+	points := int(math.Round(float64(earned) * refunded / total))
+	if left := earned - reversed; points > left {
+		points = left
+	}
+	return points
+}
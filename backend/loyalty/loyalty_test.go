@@ -0,0 +1,50 @@
+package loyalty
+
+import (
+	"order-mgmt-backend/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateSortsTiers(t *testing.T) {
+	rules := Defaults()
+	rules.Tiers = []models.LoyaltyTier{{Name: "Gold", MinPoints: 100, Multiplier: 2}, {Name: "Base", Multiplier: 1}}
+	assert.NoError(t, Validate(&rules))
+	assert.Equal(t, "Base", rules.Tiers[0].Name)
+
+	rules.Tiers = []models.LoyaltyTier{{Name: "Silver", MinPoints: 10, Multiplier: 1}}
+	assert.ErrorIs(t, Validate(&rules), ErrInvalidRules)
+
+	rules = Defaults()
+	rules.PointValue = 0
+	assert.ErrorIs(t, Validate(&rules), ErrInvalidRules)
+}
+
+func TestEarnUsesTierMultiplier(t *testing.T) {
+	rules := Defaults()
+	assert.Equal(t, "Bronze", Tier(rules, 499).Name)
+	assert.Equal(t, "Silver", Tier(rules, 500).Name)
+	assert.Equal(t, 29, Earn(rules, 299, 0))
+	assert.Equal(t, 37, Earn(rules, 299, 500))
+	assert.Equal(t, 44, Earn(rules, 299, 5000))
+	assert.Equal(t, 0, Earn(rules, 0, 0))
+}
+
+func TestRedeemIsCapped(t *testing.T) {
+	rules := Defaults()
+	points, discount := Redeem(rules, 40, 100)
+	assert.Equal(t, 40, points)
+	assert.Equal(t, 10.0, discount)
+
+	// At most half of a 30 rupee order: 60 points.
+	points, discount = Redeem(rules, 1000, 30)
+	assert.Equal(t, 60, points)
+	assert.Equal(t, 15.0, discount)
+}
+
+func TestReversal(t *testing.T) {
+	assert.Equal(t, 10, Reversal(30, 0, 100, 300))
+	assert.Equal(t, 5, Reversal(30, 25, 300, 300))
+	assert.Equal(t, 0, Reversal(0, 0, 100, 300))
+}
@@ -12,27 +12,107 @@ type Item struct {
 	Description string  `json:"description"`
 	Price       float64 `json:"price"`
 	ImageURL    string  `json:"image_url"`
+	Category    string  `json:"category"`
+	PrepMinutes int     `json:"prep_minutes"`
+}
+
+// MenuSchedule limits when an item, or every item in a category, can be
+// ordered. Days is a bitmask of 1<<time.Weekday (zero means every day) and
+// StartTime/EndTime are "HH:MM" in the outlet's time zone.
+type MenuSchedule struct {
+	ID        uint   `json:"id" gorm:"primaryKey"`
+	ItemID    *uint  `json:"item_id,omitempty" gorm:"index"`
+	Category  string `json:"category,omitempty" gorm:"index"`
+	Days      int    `json:"days"`
+	StartTime string `json:"start_time"`
+	EndTime   string `json:"end_time"`
+}
+
+type MenuItem struct {
+	Item
+	Available       bool       `json:"available"`
+	AvailableFrom   string     `json:"available_from,omitempty"`
+	NextAvailableAt *time.Time `json:"next_available_at,omitempty"`
+}
+
+// Menu is what an outlet sells, and whether it takes orders now. While it
+// is closed, NextOpeningAt is when it opens again, if it ever does.
+type Menu struct {
+	IsOpen        bool       `json:"is_open"`
+	NextOpeningAt *time.Time `json:"next_opening_at,omitempty"`
+	Items         []MenuItem `json:"items"`
 }
 
 type Order struct {
-	ID              string      `json:"id" gorm:"primaryKey"`
-	CustomerName    string      `json:"customer_name"`
-	CustomerAddress string      `json:"customer_address"`
-	CustomerPhone   string      `json:"customer_phone"`
-	TotalPrice      float64     `json:"total_price"`
-	Status          string      `json:"status"`
-	PaymentStatus   string      `json:"payment_status"`
-	CreatedAt       time.Time   `json:"created_at"`
-	OrderItems      []OrderItem `json:"order_items" gorm:"foreignKey:OrderID"`
+	ID                  string         `json:"id" gorm:"primaryKey"`
+	CustomerName        string         `json:"customer_name"`
+	CustomerAddress     string         `json:"customer_address"`
+	CustomerPhone       string         `json:"customer_phone"`
+	UserID              *uint          `json:"user_id,omitempty" gorm:"index"`
+	TotalPrice          float64        `json:"total_price"`
+	Discount            float64        `json:"discount"`
+	PointsRedeemed      int            `json:"points_redeemed,omitempty"`
+	PointsEarned        int            `json:"points_earned,omitempty"`
+	Status              string         `json:"status"`
+	StatusReason        string         `json:"status_reason,omitempty"`
+	PaymentStatus       string         `json:"payment_status"`
+	PaymentMethod       string         `json:"payment_method,omitempty"`
+	PaymentProvider     string         `json:"payment_provider,omitempty"`
+	PaymentIntentID     string         `json:"payment_intent_id,omitempty" gorm:"index"`
+	OutletID            *uint          `json:"outlet_id,omitempty" gorm:"index"`
+	DeliveryLat         *float64       `json:"delivery_lat,omitempty"`
+	DeliveryLng         *float64       `json:"delivery_lng,omitempty"`
+	PrepMinutes         int            `json:"prep_minutes"`
+	KitchenStartAt      *time.Time     `json:"kitchen_start_at,omitempty"`
+	EstimatedReadyAt    *time.Time     `json:"estimated_ready_at,omitempty"`
+	EstimatedDeliveryAt *time.Time     `json:"eta,omitempty"`
+	InvoiceNumber       *string        `json:"invoice_number,omitempty" gorm:"uniqueIndex"`
+	InvoicedAt          *time.Time     `json:"invoiced_at,omitempty"`
+	RefundedAmount      float64        `json:"refunded_amount"`
+	RiderID             *uint          `json:"rider_id,omitempty" gorm:"index"`
+	RiderAssignedAt     *time.Time     `json:"rider_assigned_at,omitempty"`
+	RiderAcceptedAt     *time.Time     `json:"rider_accepted_at,omitempty"`
+	BatchID             string         `json:"batch_id,omitempty" gorm:"index"`
+	BatchStop           int            `json:"batch_stop,omitempty"`
+	PickedUpAt          *time.Time     `json:"picked_up_at,omitempty"`
+	DeliveredAt         *time.Time     `json:"delivered_at,omitempty"`
+	DeliveredWith       string         `json:"delivered_with,omitempty"`
+	DeliveryCode        string         `json:"-"`
+	DeliveryCodeTries   int            `json:"-"`
+	EventSeq            int64          `json:"event_seq"`
+	TrackingToken       string         `json:"tracking_token,omitempty" gorm:"-"`
+	CreatedAt           time.Time      `json:"created_at"`
+	OrderItems          []OrderItem    `json:"order_items" gorm:"foreignKey:OrderID"`
+	Payments            []OrderPayment `json:"payments,omitempty" gorm:"foreignKey:OrderID"`
+	Refunds             []Refund       `json:"refunds" gorm:"foreignKey:OrderID"`
+}
+
+// OrderPayment is the share of an order paid with one method. An order has
+// one component per method and their amounts add up to its TotalPrice. Cash
+// components stay Pending until the rider records the collection. Gift card
+// components name the card they were paid with.
+type OrderPayment struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	OrderID     string     `json:"order_id" gorm:"index"`
+	Method      string     `json:"method"`
+	Amount      float64    `json:"amount"`
+	Status      string     `json:"status"`
+	IntentID    string     `json:"intent_id,omitempty" gorm:"index"`
+	GiftCardID  *uint      `json:"gift_card_id,omitempty"`
+	CollectedBy string     `json:"collected_by,omitempty"`
+	CollectedAt *time.Time `json:"collected_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
 }
 
 type OrderItem struct {
-	ID       uint    `json:"id" gorm:"primaryKey"`
-	OrderID  string  `json:"order_id"`
-	ItemID   uint    `json:"item_id"`
-	Quantity int     `json:"quantity"`
-	Price    float64 `json:"price"`
-	Item     Item    `json:"item" gorm:"foreignKey:ItemID"`
+	ID        uint     `json:"id" gorm:"primaryKey"`
+	OrderID   string   `json:"order_id"`
+	ItemID    uint     `json:"item_id"`
+	Quantity  int      `json:"quantity"`
+	Price     float64  `json:"price"`
+	Modifiers []string `json:"modifiers,omitempty" gorm:"serializer:json"`
+	Notes     string   `json:"notes,omitempty"`
+	Item      Item     `json:"item" gorm:"foreignKey:ItemID"`
 }
 
 type User struct {
@@ -54,6 +134,324 @@ type Location struct {
 	Name string `json:"name"`
 }
 
+// Outlet is a physical kitchen that fulfils orders for a city. OpensAt and
+// ClosesAt are "HH:MM" in the outlet's TimeZone. Addresses further than
+// DeliveryRadiusKm from the outlet are not served. Once MaxActiveOrders are
+// in the kitchen, new orders are refused unless DeferWhenFull pushes them to
+// the next free slot. Outlets that UsesKDS drive their orders from the
+// kitchen display instead of the built-in status simulation.
+type Outlet struct {
+	ID               uint          `json:"id" gorm:"primaryKey"`
+	Name             string        `json:"name"`
+	Address          string        `json:"address"`
+	Latitude         float64       `json:"latitude"`
+	Longitude        float64       `json:"longitude"`
+	DeliveryRadiusKm float64       `json:"delivery_radius_km"`
+	LocationID       uint          `json:"location_id" gorm:"index"`
+	Location         Location      `json:"location"`
+	TimeZone         string        `json:"time_zone"`
+	OpensAt          string        `json:"opens_at"`
+	ClosesAt         string        `json:"closes_at"`
+	KitchenStations  int           `json:"kitchen_stations"`
+	MaxActiveOrders  int           `json:"max_active_orders"`
+	DeferWhenFull    bool          `json:"defer_when_full"`
+	UsesKDS          bool          `json:"uses_kds"`
+	GSTIN            string        `json:"gstin"`
+	Hours            []OutletHours `json:"hours,omitempty" gorm:"foreignKey:OutletID"`
+}
+
+// InvoiceSequence is the last invoice number issued by an outlet in a
+// financial year. OutletID is zero for orders placed without an outlet.
+type InvoiceSequence struct {
+	ID            uint   `json:"id" gorm:"primaryKey"`
+	OutletID      uint   `json:"outlet_id" gorm:"uniqueIndex:idx_invoice_sequence"`
+	FinancialYear string `json:"financial_year" gorm:"uniqueIndex:idx_invoice_sequence"`
+	Last          int    `json:"last"`
+}
+
+// OutletHours replaces an outlet's daily OpensAt/ClosesAt on the weekdays in
+// Days (a bitmask of 1<<time.Weekday).
+type OutletHours struct {
+	ID       uint   `json:"id" gorm:"primaryKey"`
+	OutletID uint   `json:"outlet_id" gorm:"index"`
+	Days     int    `json:"days"`
+	OpensAt  string `json:"opens_at"`
+	ClosesAt string `json:"closes_at"`
+}
+
+// OutletHoliday closes an outlet for a whole calendar date ("2006-01-02").
+type OutletHoliday struct {
+	ID       uint   `json:"id" gorm:"primaryKey"`
+	OutletID uint   `json:"outlet_id" gorm:"index"`
+	Date     string `json:"date"`
+	Reason   string `json:"reason"`
+}
+
+// OrderingPause stops new orders until Until. A nil OutletID pauses the
+// whole store.
+type OrderingPause struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	OutletID  *uint     `json:"outlet_id,omitempty" gorm:"index"`
+	Until     time.Time `json:"until"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OutletItem overrides an item for a single outlet. Items without a row are
+// sold at their base price; Price replaces it when set.
+type OutletItem struct {
+	ID        uint     `json:"id" gorm:"primaryKey"`
+	OutletID  uint     `json:"outlet_id" gorm:"uniqueIndex:idx_outlet_item"`
+	ItemID    uint     `json:"item_id" gorm:"uniqueIndex:idx_outlet_item"`
+	Available bool     `json:"available"`
+	Price     *float64 `json:"price,omitempty"`
+}
+
+// Refund returns part or all of a captured payment to the Method it was paid
+// with. OrderItemID is set when the refund is for a single line of the
+// order. Refunds start Pending and
+// become Succeeded or Failed once the provider answers; the order's
+// RefundedAmount only counts succeeded ones.
+type Refund struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	OrderID     string    `json:"order_id" gorm:"index"`
+	OrderItemID *uint     `json:"order_item_id,omitempty" gorm:"index"`
+	Quantity    int       `json:"quantity,omitempty"`
+	Method      string    `json:"method"`
+	ToWallet    bool      `json:"to_wallet"`
+	Amount      float64   `json:"amount"`
+	Reason      string    `json:"reason"`
+	Status      string    `json:"status"`
+	Error       string    `json:"error,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// WalletAccount exists once per customer with a wallet. Ledger writes lock
+// it first so that one customer's movements are applied one at a time.
+type WalletAccount struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"uniqueIndex"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WalletTransaction is one movement of store credit: a credit, a debit for
+// an order, or the expiry of an unspent credit (SourceID). Reference is
+// unique, which makes every movement idempotent. Transactions are never
+// updated or deleted; the balance is the sum of their ledger entries.
+type WalletTransaction struct {
+	ID        uint          `json:"id" gorm:"primaryKey"`
+	UserID    uint          `json:"user_id" gorm:"index"`
+	Kind      string        `json:"kind"`
+	Amount    float64       `json:"amount"`
+	Reference string        `json:"reference" gorm:"uniqueIndex"`
+	Reason    string        `json:"reason"`
+	Actor     string        `json:"actor"`
+	ExpiresAt *time.Time    `json:"expires_at,omitempty"`
+	SourceID  *uint         `json:"source_id,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+	Entries   []LedgerEntry `json:"entries" gorm:"foreignKey:TransactionID"`
+}
+
+// LedgerEntry is one leg of a wallet transaction. Each transaction has two
+// legs of opposite sign, one on the customer's account ("user:<id>") and one
+// on a store account, so the whole ledger always sums to zero.
+type LedgerEntry struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	TransactionID uint      `json:"transaction_id" gorm:"index"`
+	Account       string    `json:"account" gorm:"index"`
+	Amount        float64   `json:"amount"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// LoyaltyRules configures the loyalty programme. There is at most one row;
+// until an admin saves one the defaults in package loyalty apply. Points are
+// earned at PointsPerRupee times the tier multiplier, and each point is
+// worth PointValue rupees off an order, up to MaxRedeemPercent of it.
+type LoyaltyRules struct {
+	ID               uint          `json:"-" gorm:"primaryKey"`
+	PointsPerRupee   float64       `json:"points_per_rupee"`
+	PointValue       float64       `json:"point_value"`
+	MaxRedeemPercent float64       `json:"max_redeem_percent"`
+	Tiers            []LoyaltyTier `json:"tiers" gorm:"serializer:json"`
+	UpdatedAt        time.Time     `json:"updated_at"`
+}
+
+// LoyaltyTier applies to customers who have earned at least MinPoints.
+type LoyaltyTier struct {
+	Name       string  `json:"name"`
+	MinPoints  int     `json:"min_points"`
+	Multiplier float64 `json:"multiplier"`
+}
+
+// LoyaltyAccount is locked while a customer's points change, so that
+// concurrent orders cannot spend the same points.
+type LoyaltyAccount struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"uniqueIndex"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LoyaltyMovement adds (positive Points) or removes points. Reference is
+// unique so that each movement applies once; the balance is the sum of a
+// customer's movements.
+type LoyaltyMovement struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"index"`
+	OrderID   string    `json:"order_id,omitempty" gorm:"index"`
+	Kind      string    `json:"kind"`
+	Points    int       `json:"points"`
+	Reference string    `json:"reference" gorm:"uniqueIndex"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const (
+	PointsEarned   = "earn"
+	PointsRedeemed = "redeem"
+	PointsReversed = "reverse"
+	PointsRestored = "restore"
+)
+
+// GiftCard is a prepaid card that pays for orders until its balance runs
+// out. Only a hash of the code is stored; Last4 lets staff tell cards apart.
+// Reference is the issuer's idempotency key.
+type GiftCard struct {
+	ID           uint                  `json:"id" gorm:"primaryKey"`
+	CodeHash     string                `json:"-" gorm:"uniqueIndex"`
+	Last4        string                `json:"last4"`
+	InitialValue float64               `json:"initial_value"`
+	Balance      float64               `json:"balance"`
+	Status       string                `json:"status"`
+	Reference    string                `json:"reference" gorm:"uniqueIndex"`
+	Reason       string                `json:"reason"`
+	ExpiresAt    *time.Time            `json:"expires_at,omitempty"`
+	VoidedAt     *time.Time            `json:"voided_at,omitempty"`
+	VoidReason   string                `json:"void_reason,omitempty"`
+	CreatedAt    time.Time             `json:"created_at"`
+	UpdatedAt    time.Time             `json:"updated_at"`
+	Transactions []GiftCardTransaction `json:"transactions,omitempty" gorm:"foreignKey:GiftCardID"`
+}
+
+// GiftCardTransaction is one change to a gift card's balance. Reference is
+// unique, so redeeming or refunding the same order twice has no effect.
+type GiftCardTransaction struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	GiftCardID   uint      `json:"gift_card_id" gorm:"index"`
+	OrderID      string    `json:"order_id,omitempty" gorm:"index"`
+	Kind         string    `json:"kind"`
+	Amount       float64   `json:"amount"`
+	BalanceAfter float64   `json:"balance_after"`
+	Reference    string    `json:"reference" gorm:"uniqueIndex"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+const (
+	GiftCardActive = "active"
+	GiftCardVoid   = "void"
+)
+
+// Rider delivers orders. A rider on shift is Available for up to Capacity
+// orders at a time; Lat and Lng are where they last reported being.
+type Rider struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	Name           string     `json:"name"`
+	Phone          string     `json:"phone" gorm:"uniqueIndex"`
+	Available      bool       `json:"available"`
+	Capacity       int        `json:"capacity"`
+	Lat            *float64   `json:"lat,omitempty"`
+	Lng            *float64   `json:"lng,omitempty"`
+	LocatedAt      *time.Time `json:"located_at,omitempty"`
+	LastAssignedAt *time.Time `json:"last_assigned_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// RiderPing is one position on the track of an order out for delivery.
+// Only the latest few are kept for each order.
+type RiderPing struct {
+	ID         uint      `json:"-" gorm:"primaryKey"`
+	OrderID    string    `json:"-" gorm:"index"`
+	RiderID    uint      `json:"-" gorm:"index"`
+	Lat        float64   `json:"lat"`
+	Lng        float64   `json:"lng"`
+	SpeedKmh   float64   `json:"speed_kmh,omitempty"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// Ways an order can be confirmed delivered, kept in Order.DeliveredWith.
+const (
+	DeliveredWithCode      = "code"
+	DeliveredWithPhoto     = "photo"
+	DeliveredWithSignature = "signature"
+	DeliveredWithOverride  = "override"
+)
+
+// DeliveryProof is a photo or signature the rider took at the door, for
+// when the customer cannot give them the delivery code. The file is kept in
+// storage under Key.
+type DeliveryProof struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	OrderID     string    `json:"order_id" gorm:"index"`
+	RiderID     uint      `json:"rider_id"`
+	Kind        string    `json:"kind"`
+	Key         string    `json:"-"`
+	ContentType string    `json:"content_type"`
+	Size        int       `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// DeliveryOverride is the audit record of an admin marking an order
+// delivered without the customer's code or a proof.
+type DeliveryOverride struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	OrderID        string    `json:"order_id" gorm:"index"`
+	RiderID        *uint     `json:"rider_id,omitempty"`
+	PreviousStatus string    `json:"previous_status"`
+	OverriddenBy   string    `json:"overridden_by"`
+	Reason         string    `json:"reason"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// OrderEvent is one event pushed to an order's subscribers, kept so that a
+// client that reconnects can be sent what it missed. Seq counts up from 1
+// for each order; Order.EventSeq holds the last one issued. Data is the
+// event as it was sent.
+type OrderEvent struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	OrderID   string    `json:"order_id" gorm:"uniqueIndex:idx_order_event_seq"`
+	Seq       int64     `json:"seq" gorm:"uniqueIndex:idx_order_event_seq"`
+	Type      string    `json:"type"`
+	Status    string    `json:"status"`
+	Data      string    `json:"data"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookEvent records a provider event that has been applied, so that
+// redeliveries of the same event are ignored.
+type WebhookEvent struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Provider    string    `json:"provider" gorm:"uniqueIndex:idx_webhook_event"`
+	EventID     string    `json:"event_id" gorm:"uniqueIndex:idx_webhook_event"`
+	Type        string    `json:"type"`
+	OrderID     string    `json:"order_id" gorm:"index"`
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+// WebhookRetry holds an event that could not be applied when it arrived.
+// Exhausted is set once it has failed too many times to retry again.
+type WebhookRetry struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	Provider      string    `json:"provider" gorm:"uniqueIndex:idx_webhook_retry"`
+	EventID       string    `json:"event_id" gorm:"uniqueIndex:idx_webhook_retry"`
+	Payload       string    `json:"payload"`
+	Attempts      int       `json:"attempts"`
+	LastError     string    `json:"last_error"`
+	NextAttemptAt time.Time `json:"next_attempt_at" gorm:"index"`
+	Exhausted     bool      `json:"exhausted"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required"`
 	Password string `json:"password" binding:"required"`
@@ -63,24 +461,177 @@ type CreateOrderRequest struct {
 	CustomerName    string             `json:"customer_name" binding:"required"`
 	CustomerAddress string             `json:"customer_address" binding:"required"`
 	CustomerPhone   string             `json:"customer_phone" binding:"required"`
+	UserID          *uint              `json:"user_id"`
+	OutletID        uint               `json:"outlet_id"`
+	Latitude        *float64           `json:"latitude"`
+	Longitude       *float64           `json:"longitude"`
 	PaymentMethod   string             `json:"payment_method"`
+	PaymentToken    string             `json:"payment_token"`
+	WalletAmount    float64            `json:"wallet_amount" binding:"gte=0"`
+	RedeemPoints    int                `json:"redeem_points" binding:"gte=0"`
+	GiftCardCode    string             `json:"gift_card_code"`
+	GiftCardAmount  float64            `json:"gift_card_amount" binding:"gte=0"`
 	Items           []OrderItemRequest `json:"items" binding:"required,gt=0"`
 }
 
 type OrderItemRequest struct {
-	ItemID   uint `json:"item_id" binding:"required"`
-	Quantity int  `json:"quantity" binding:"required,gt=0"`
+	ItemID    uint     `json:"item_id" binding:"required"`
+	Quantity  int      `json:"quantity" binding:"required,gt=0"`
+	Modifiers []string `json:"modifiers"`
+	Notes     string   `json:"notes"`
+}
+
+const (
+	StatusAwaitingPayment = "Awaiting Payment"
+	StatusReceived        = "Order Received"
+	StatusPreparing       = "Preparing"
+	StatusReady           = "Ready for Pickup"
+	StatusOutForDelivery  = "Out for Delivery"
+	StatusDelivered       = "Delivered"
+	StatusRejected        = "Rejected"
+	StatusCancelled       = "Cancelled"
+)
+
+var statusTransitions = map[string][]string{
+	StatusAwaitingPayment: {StatusReceived, StatusCancelled},
+	StatusReceived:        {StatusPreparing, StatusRejected, StatusCancelled},
+	StatusPreparing:       {StatusReady, StatusCancelled},
+	StatusReady:           {StatusOutForDelivery},
+	StatusOutForDelivery:  {StatusDelivered},
+}
+
+// CanTransition reports whether an order may move from one status to another.
+func CanTransition(from, to string) bool {
+	for _, s := range statusTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
 }
 
+// IsFinal reports whether status ends an order's lifecycle.
+func IsFinal(status string) bool {
+	return len(statusTransitions[status]) == 0
+}
+
+const (
+	PaymentPending    = "Pending"
+	PaymentAuthorized = "Authorized"
+	PaymentCaptured   = "Captured"
+	PaymentFailed     = "Failed"
+)
+
+const (
+	RefundPending   = "Pending"
+	RefundSucceeded = "Succeeded"
+	RefundFailed    = "Failed"
+)
+
 func NewOrder() *Order {
 	return &Order{
 		ID:            uuid.New().String(),
 		CreatedAt:     time.Now(),
-		Status:        "Order Received",
-		PaymentStatus: "Pending",
+		Status:        StatusReceived,
+		PaymentStatus: PaymentPending,
 	}
 }
 
 type UpdateOrderStatusRequest struct {
 	Status string `json:"status" binding:"required"`
 }
+
+type PauseOrderingRequest struct {
+	OutletID *uint  `json:"outlet_id"`
+	Minutes  int    `json:"minutes" binding:"required,gt=0"`
+	Reason   string `json:"reason"`
+}
+
+// AddHolidayRequest closes an outlet for the whole of Date ("2006-01-02"),
+// in the outlet's time zone.
+type AddHolidayRequest struct {
+	Date   string `json:"date" binding:"required"`
+	Reason string `json:"reason"`
+}
+
+// CreateRefundRequest refunds either Quantity units of one order line or a
+// plain Amount. Without OrderItemID or Amount the rest of the order is
+// refunded. ToWallet pays the refund as store credit instead of reversing
+// the original payment.
+type CreateRefundRequest struct {
+	OrderItemID *uint    `json:"order_item_id"`
+	Quantity    int      `json:"quantity" binding:"gte=0"`
+	Amount      *float64 `json:"amount" binding:"omitempty,gt=0"`
+	Reason      string   `json:"reason" binding:"required"`
+	ToWallet    bool     `json:"to_wallet"`
+}
+
+// GrantCreditRequest adds store credit to a customer's wallet. Reference is
+// the caller's idempotency key.
+type GrantCreditRequest struct {
+	Amount        float64 `json:"amount" binding:"required,gt=0"`
+	Reason        string  `json:"reason" binding:"required"`
+	Reference     string  `json:"reference" binding:"required"`
+	ExpiresInDays int     `json:"expires_in_days" binding:"gte=0"`
+}
+
+// IssueGiftCardRequest issues a card worth Amount. Reference is the
+// caller's idempotency key.
+type IssueGiftCardRequest struct {
+	Amount        float64 `json:"amount" binding:"required,gt=0"`
+	Reference     string  `json:"reference" binding:"required"`
+	Reason        string  `json:"reason"`
+	ExpiresInDays int     `json:"expires_in_days" binding:"gte=0"`
+}
+
+// GiftCardCodeRequest carries a code in the body, so that codes stay out of
+// URLs and access logs.
+type GiftCardCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type VoidGiftCardRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+type CollectCashRequest struct {
+	Amount      float64 `json:"amount" binding:"required,gt=0"`
+	CollectedBy string  `json:"collected_by" binding:"required"`
+}
+
+// DeliverOrderRequest carries the delivery code the customer read out.
+type DeliverOrderRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type OverrideDeliveryRequest struct {
+	OverriddenBy string `json:"overridden_by" binding:"required"`
+	Reason       string `json:"reason" binding:"required"`
+}
+
+type RejectOrderRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+type CreateRiderRequest struct {
+	Name     string `json:"name" binding:"required"`
+	Phone    string `json:"phone" binding:"required"`
+	Capacity int    `json:"capacity" binding:"gte=0"`
+}
+
+// RiderAvailabilityRequest starts or ends a rider's shift, optionally with
+// where they are.
+type RiderAvailabilityRequest struct {
+	Available *bool    `json:"available" binding:"required"`
+	Lat       *float64 `json:"lat"`
+	Lng       *float64 `json:"lng"`
+}
+
+// RiderLocationRequest is one GPS ping from a rider's phone. RecordedAt is
+// when the phone took it, if it was queued while offline.
+type RiderLocationRequest struct {
+	Lat        *float64   `json:"lat" binding:"required"`
+	Lng        *float64   `json:"lng" binding:"required"`
+	SpeedKmh   float64    `json:"speed_kmh" binding:"gte=0"`
+	RecordedAt *time.Time `json:"recorded_at"`
+}
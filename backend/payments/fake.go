@@ -0,0 +1,138 @@
+package payments
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Tokens understood by the fake provider. Any other token succeeds.
+const (
+	TokenFail    = "fake_fail"
+	TokenDelayed = "fake_delayed"
+)
+
+// Fake is an in-memory provider for local development and tests. Payments
+// authorize immediately unless the token asks for a failure or a delayed
+// confirmation, in which case the intent stays Pending for Delay and is then
+// authorized and reported through OnSettle.
+type Fake struct {
+	Delay    time.Duration
+	OnSettle func(Intent)
+
+	mu      sync.Mutex
+	intents map[string]*Intent
+}
+
+func NewFake() *Fake {
+	return &Fake{Delay: 5 * time.Second, intents: make(map[string]*Intent)}
+}
+
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+func (f *Fake) CreateIntent(ctx context.Context, req IntentRequest) (Intent, error) {
+	intent := &Intent{
+		ID:      "pi_" + uuid.New().String(),
+		OrderID: req.OrderID,
+		Amount:  req.Amount,
+		Method:  req.Method,
+		Status:  StatusAuthorized,
+	}
+	switch req.Token {
+	case TokenFail:
+		intent.Status = StatusFailed
+		intent.Error = "card declined"
+	case TokenDelayed:
+		intent.Status = StatusPending
+		if f.Delay > 0 {
+			time.AfterFunc(f.Delay, func() { f.Settle(intent.ID, true) })
+		}
+	}
+
+	f.mu.Lock()
+	f.intents[intent.ID] = intent
+	f.mu.Unlock()
+	return *intent, nil
+}
+
+// Settle completes a pending intent, authorizing it when ok and failing it
+// otherwise, then reports it through OnSettle. Tests call it directly to
+// confirm delayed payments deterministically.
+func (f *Fake) Settle(intentID string, ok bool) (Intent, error) {
+	f.mu.Lock()
+	intent, found := f.intents[intentID]
+	if !found {
+		f.mu.Unlock()
+		return Intent{}, ErrUnknownIntent
+	}
+	if intent.Status != StatusPending {
+		f.mu.Unlock()
+		return Intent{}, ErrInvalidState
+	}
+	intent.Status = StatusAuthorized
+	if !ok {
+		intent.Status = StatusFailed
+		intent.Error = "payment was not confirmed"
+	}
+	settled := *intent
+	onSettle := f.OnSettle
+	f.mu.Unlock()
+
+	if onSettle != nil {
+		onSettle(settled)
+	}
+	return settled, nil
+}
+
+func (f *Fake) Capture(ctx context.Context, intentID string) (Intent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	intent, ok := f.intents[intentID]
+	if !ok {
+		return Intent{}, ErrUnknownIntent
+	}
+	if intent.Status == StatusCaptured {
+		return *intent, nil
+	}
+	if intent.Status != StatusAuthorized {
+		return Intent{}, ErrInvalidState
+	}
+	intent.Status = StatusCaptured
+	return *intent, nil
+}
+
+func (f *Fake) Refund(ctx context.Context, intentID string, amount float64) (Intent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	intent, ok := f.intents[intentID]
+	if !ok {
+		return Intent{}, ErrUnknownIntent
+	}
+	if intent.Status != StatusCaptured && intent.Status != StatusRefunded {
+		return Intent{}, ErrInvalidState
+	}
+	remaining := math.Round((intent.Amount-intent.Refunded)*100) / 100
+	if amount <= 0 || amount > remaining {
+		return Intent{}, ErrRefundTooBig
+	}
+	intent.Refunded = math.Round((intent.Refunded+amount)*100) / 100
+	if intent.Refunded >= intent.Amount {
+		intent.Status = StatusRefunded
+	}
+	return *intent, nil
+}
+
+func (f *Fake) Status(ctx context.Context, intentID string) (Intent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	intent, ok := f.intents[intentID]
+	if !ok {
+		return Intent{}, ErrUnknownIntent
+	}
+	return *intent, nil
+}
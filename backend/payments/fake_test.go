@@ -0,0 +1,64 @@
+package payments
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeSuccessCaptureAndRefund(t *testing.T) {
+	f := NewFake()
+	ctx := context.Background()
+
+	intent, err := f.CreateIntent(ctx, IntentRequest{OrderID: "o1", Amount: 100, Method: "card"})
+	assert.NoError(t, err)
+	assert.Equal(t, StatusAuthorized, intent.Status)
+
+	intent, err = f.Capture(ctx, intent.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusCaptured, intent.Status)
+
+	intent, err = f.Refund(ctx, intent.ID, 40)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusCaptured, intent.Status)
+	assert.Equal(t, 40.0, intent.Refunded)
+
+	_, err = f.Refund(ctx, intent.ID, 60.01)
+	assert.ErrorIs(t, err, ErrRefundTooBig)
+
+	intent, err = f.Refund(ctx, intent.ID, 60)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusRefunded, intent.Status)
+}
+
+func TestFakeFailure(t *testing.T) {
+	f := NewFake()
+	intent, _ := f.CreateIntent(context.Background(), IntentRequest{OrderID: "o1", Amount: 100, Token: TokenFail})
+	assert.Equal(t, StatusFailed, intent.Status)
+
+	_, err := f.Capture(context.Background(), intent.ID)
+	assert.ErrorIs(t, err, ErrInvalidState)
+}
+
+func TestFakeDelayedConfirmation(t *testing.T) {
+	f := NewFake()
+	f.Delay = 0
+	var settled []Intent
+	f.OnSettle = func(i Intent) { settled = append(settled, i) }
+
+	intent, _ := f.CreateIntent(context.Background(), IntentRequest{OrderID: "o1", Amount: 100, Token: TokenDelayed})
+	assert.Equal(t, StatusPending, intent.Status)
+
+	_, err := f.Settle(intent.ID, true)
+	assert.NoError(t, err)
+	if assert.Len(t, settled, 1) {
+		assert.Equal(t, StatusAuthorized, settled[0].Status)
+	}
+
+	_, err = f.Settle(intent.ID, true)
+	assert.ErrorIs(t, err, ErrInvalidState)
+
+	current, _ := f.Status(context.Background(), intent.ID)
+	assert.Equal(t, StatusAuthorized, current.Status)
+}
@@ -0,0 +1,115 @@
+package payments
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+// Method is how a customer pays for (part of) an order.
+type Method string
+
+const (
+	MethodCOD      Method = "cod"
+	MethodCard     Method = "card"
+	MethodUPI      Method = "upi"
+	MethodWallet   Method = "wallet"
+	MethodGiftCard Method = "gift_card"
+)
+
+var (
+	ErrUnknownMethod = errors.New("unknown payment method")
+	ErrInvalidSplit  = errors.New("an order can only be split between the wallet, one gift card and one other method")
+	ErrSplitMismatch = errors.New("payment components do not add up to the order total")
+)
+
+// ParseMethod normalises a method sent by a client. An empty method and the
+// old "cash" spellings mean cash on delivery, since orders without a method
+// predate online payments.
+func ParseMethod(s string) (Method, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "cod", "cash", "cash on delivery":
+		return MethodCOD, nil
+	case "card":
+		return MethodCard, nil
+	case "upi":
+		return MethodUPI, nil
+	case "wallet":
+		return MethodWallet, nil
+	case "gift_card", "gift card", "giftcard":
+		return MethodGiftCard, nil
+	}
+	return "", ErrUnknownMethod
+}
+
+// Online reports whether the method is collected through the payment
+// provider.
+func (m Method) Online() bool {
+	return m == MethodCard || m == MethodUPI
+}
+
+// Prepaid reports whether the method spends value held by the store, which
+// is taken before any other method.
+func (m Method) Prepaid() bool {
+	return m == MethodWallet || m == MethodGiftCard
+}
+
+// Component is the share of an order's total paid with one method.
+type Component struct {
+	Method Method  `json:"method"`
+	Amount float64 `json:"amount"`
+}
+
+func paise(v float64) int64 {
+	return int64(math.Round(v * 100))
+}
+
+// Split divides total between the prepaid components, taken first, and the
+// rest paid with method. Prepaid components of zero are left out. When
+// method is itself prepaid, the prepaid components must cover the total or
+// leave nothing but that method to pay.
+func Split(total float64, method Method, prepaid ...Component) ([]Component, error) {
+	var parts []Component
+	rest := paise(total)
+	for _, p := range prepaid {
+		if p.Amount == 0 {
+			continue
+		}
+		if p.Method == method && rest != paise(p.Amount) {
+			return nil, ErrSplitMismatch
+		}
+		parts = append(parts, p)
+		rest -= paise(p.Amount)
+	}
+	if rest > 0 || len(parts) == 0 {
+		parts = append(parts, Component{Method: method, Amount: float64(rest) / 100})
+	}
+	return parts, Reconcile(total, parts)
+}
+
+// Reconcile checks that parts pay for exactly total, to the paisa, with at
+// most one component for each prepaid method and one other method.
+func Reconcile(total float64, parts []Component) error {
+	var sum int64
+	seen := make(map[Method]bool)
+	other := 0
+	for _, p := range parts {
+		if p.Amount < 0 || (p.Amount == 0 && len(parts) > 1) {
+			return ErrSplitMismatch
+		}
+		if !p.Method.Prepaid() {
+			other++
+		} else if seen[p.Method] {
+			return ErrInvalidSplit
+		}
+		seen[p.Method] = true
+		sum += paise(p.Amount)
+	}
+	if other > 1 || len(parts) == 0 {
+		return ErrInvalidSplit
+	}
+	if sum != paise(total) {
+		return ErrSplitMismatch
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package payments
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMethod(t *testing.T) {
+	for in, want := range map[string]Method{
+		"":                 MethodCOD,
+		"Cash on Delivery": MethodCOD,
+		"COD":              MethodCOD,
+		" card ":           MethodCard,
+		"UPI":              MethodUPI,
+		"wallet":           MethodWallet,
+		"Gift Card":        MethodGiftCard,
+	} {
+		got, err := ParseMethod(in)
+		assert.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+	_, err := ParseMethod("cheque")
+	assert.ErrorIs(t, err, ErrUnknownMethod)
+}
+
+func TestSplit(t *testing.T) {
+	parts, err := Split(30, MethodCard)
+	assert.NoError(t, err)
+	assert.Equal(t, []Component{{MethodCard, 30}}, parts)
+
+	parts, err = Split(30.5, MethodUPI, Component{MethodWallet, 10.2})
+	assert.NoError(t, err)
+	assert.Equal(t, []Component{{MethodWallet, 10.2}, {MethodUPI, 20.3}}, parts)
+
+	parts, err = Split(30, MethodCOD, Component{MethodWallet, 30})
+	assert.NoError(t, err)
+	assert.Equal(t, []Component{{MethodWallet, 30}}, parts)
+
+	parts, err = Split(30, MethodWallet, Component{MethodWallet, 0})
+	assert.NoError(t, err)
+	assert.Equal(t, []Component{{MethodWallet, 30}}, parts)
+
+	_, err = Split(30, MethodCard, Component{MethodWallet, 31})
+	assert.ErrorIs(t, err, ErrSplitMismatch)
+
+	_, err = Split(30, MethodWallet, Component{MethodWallet, 10})
+	assert.ErrorIs(t, err, ErrSplitMismatch)
+
+	parts, err = Split(30, MethodCard, Component{MethodGiftCard, 12.5}, Component{MethodWallet, 7.5})
+	assert.NoError(t, err)
+	assert.Equal(t, []Component{{MethodGiftCard, 12.5}, {MethodWallet, 7.5}, {MethodCard, 10}}, parts)
+
+	parts, err = Split(30, MethodGiftCard, Component{MethodGiftCard, 30})
+	assert.NoError(t, err)
+	assert.Equal(t, []Component{{MethodGiftCard, 30}}, parts)
+}
+
+func TestReconcile(t *testing.T) {
+	assert.NoError(t, Reconcile(0.3, []Component{{MethodWallet, 0.1}, {MethodCard, 0.2}}))
+	assert.ErrorIs(t, Reconcile(30, []Component{{MethodCard, 29.99}}), ErrSplitMismatch)
+	assert.ErrorIs(t, Reconcile(30, []Component{{MethodCard, 10}, {MethodCOD, 20}}), ErrInvalidSplit)
+	assert.ErrorIs(t, Reconcile(30, nil), ErrInvalidSplit)
+	assert.ErrorIs(t, Reconcile(30, []Component{{MethodGiftCard, 10}, {MethodGiftCard, 20}}), ErrInvalidSplit)
+}
+
+func TestMemoryWallet(t *testing.T) {
+	w := NewMemoryWallet()
+	ctx := context.Background()
+
+	assert.NoError(t, w.Credit(ctx, 1, 50, "topup-1"))
+	assert.NoError(t, w.Credit(ctx, 1, 50, "topup-1"))
+	balance, _ := w.Balance(ctx, 1)
+	assert.Equal(t, 50.0, balance)
+
+	assert.ErrorIs(t, w.Debit(ctx, 1, 50.01, "order-1"), ErrInsufficientFunds)
+	assert.NoError(t, w.Debit(ctx, 1, 20, "order-1"))
+	assert.NoError(t, w.Debit(ctx, 1, 20, "order-1"))
+	balance, _ = w.Balance(ctx, 1)
+	assert.Equal(t, 30.0, balance)
+}
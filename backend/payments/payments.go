@@ -0,0 +1,55 @@
+package payments
+
+import (
+	"context"
+	"errors"
+)
+
+type Status string
+
+const (
+	StatusPending    Status = "Pending"
+	StatusAuthorized Status = "Authorized"
+	StatusCaptured   Status = "Captured"
+	StatusFailed     Status = "Failed"
+	StatusRefunded   Status = "Refunded"
+)
+
+// Intent is a provider's record of one attempt to collect an order's amount.
+type Intent struct {
+	ID       string  `json:"id"`
+	OrderID  string  `json:"order_id"`
+	Amount   float64 `json:"amount"`
+	Refunded float64 `json:"refunded"`
+	Method   string  `json:"method"`
+	Status   Status  `json:"status"`
+	Error    string  `json:"error,omitempty"`
+}
+
+type IntentRequest struct {
+	OrderID string
+	Amount  float64
+	Method  string
+	// Token is the payment instrument collected by the client, e.g. a card
+	// token. Its meaning is provider specific.
+	Token string
+}
+
+var (
+	ErrUnknownIntent = errors.New("payment intent not found")
+	ErrInvalidState  = errors.New("payment intent is not in a valid state for this operation")
+	ErrRefundTooBig  = errors.New("refund exceeds the captured amount")
+)
+
+// Provider is a payment gateway. Intents may settle asynchronously, so a
+// freshly created intent can still be Pending.
+type Provider interface {
+	Name() string
+	CreateIntent(ctx context.Context, req IntentRequest) (Intent, error)
+	Capture(ctx context.Context, intentID string) (Intent, error)
+	Refund(ctx context.Context, intentID string, amount float64) (Intent, error)
+	Status(ctx context.Context, intentID string) (Intent, error)
+}
+
+// Default is the provider used for new orders.
+var Default Provider = NewFake()
@@ -0,0 +1,63 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var ErrInsufficientFunds = errors.New("wallet balance is too low")
+
+// Wallet holds store credit that customers can spend on orders. Debit and
+// Credit are idempotent on ref: repeating a call with the same ref has no
+// further effect.
+type Wallet interface {
+	Balance(ctx context.Context, userID uint) (float64, error)
+	Debit(ctx context.Context, userID uint, amount float64, ref string) error
+	Credit(ctx context.Context, userID uint, amount float64, ref string) error
+}
+
+// DefaultWallet is the wallet used for new orders.
+var DefaultWallet Wallet = NewMemoryWallet()
+
+// MemoryWallet keeps balances in memory, for local development and tests.
+type MemoryWallet struct {
+	mu       sync.Mutex
+	balances map[uint]int64
+	applied  map[string]bool
+}
+
+func NewMemoryWallet() *MemoryWallet {
+	return &MemoryWallet{balances: make(map[uint]int64), applied: make(map[string]bool)}
+}
+
+func (w *MemoryWallet) Balance(ctx context.Context, userID uint) (float64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return float64(w.balances[userID]) / 100, nil
+}
+
+func (w *MemoryWallet) Debit(ctx context.Context, userID uint, amount float64, ref string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.applied[ref] {
+		return nil
+	}
+	if w.balances[userID] < paise(amount) {
+		return ErrInsufficientFunds
+	}
+	w.balances[userID] -= paise(amount)
+	w.applied[ref] = true
+	return nil
+}
+
+func (w *MemoryWallet) Credit(ctx context.Context, userID uint, amount float64, ref string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.applied[ref] {
+		return nil
+	}
+	w.balances[userID] += paise(amount)
+	w.applied[ref] = true
+	return nil
+}
@@ -0,0 +1,27 @@
+package payments
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerify(t *testing.T) {
+	secret := []byte("whsec_test")
+	body := []byte(`{"id":"evt_1"}`)
+	now := time.Unix(1_780_000_000, 0)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	sig := Sign(secret, now.Unix(), body)
+
+	assert.NoError(t, Verify(secret, ts, sig, body, now.Add(time.Minute), 5*time.Minute))
+	assert.ErrorIs(t, Verify(secret, ts, sig, body, now.Add(10*time.Minute), 5*time.Minute), ErrStaleTimestamp)
+	assert.ErrorIs(t, Verify(secret, ts, sig, []byte(`{"id":"evt_2"}`), now, 5*time.Minute), ErrBadSignature)
+	assert.ErrorIs(t, Verify([]byte("other"), ts, sig, body, now, 5*time.Minute), ErrBadSignature)
+	assert.ErrorIs(t, Verify(secret, "not-a-time", sig, body, now, 5*time.Minute), ErrStaleTimestamp)
+
+	// Moving the timestamp forward invalidates the signature.
+	fresh := strconv.FormatInt(now.Add(time.Hour).Unix(), 10)
+	assert.ErrorIs(t, Verify(secret, fresh, sig, body, now.Add(time.Hour), 5*time.Minute), ErrBadSignature)
+}
@@ -0,0 +1,83 @@
+package printing
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+type Align int
+
+const (
+	AlignLeft Align = iota
+	AlignCenter
+	AlignRight
+)
+
+// Paper widths in characters of the printer's default font.
+const (
+	Width58mm = 32
+	Width80mm = 48
+)
+
+// Line is one printed row. Rendering decides how alignment and emphasis
+// are expressed: padding for plain text, printer commands for ESC/POS.
+type Line struct {
+	Text   string
+	Align  Align
+	Bold   bool
+	Double bool // double width and height
+	Rule   bool // a full-width separator; Text is ignored
+	Cut    bool // cut the paper after this line
+}
+
+// columns fits left and right onto one row of width, truncating left when
+// they do not both fit.
+func columns(left, right string, width int) string {
+	space := width - runeLen(right) - 1
+	if space < 1 {
+		return truncate(right, width)
+	}
+	left = truncate(left, space)
+	return left + strings.Repeat(" ", width-runeLen(left)-runeLen(right)) + right
+}
+
+// wrap breaks s into rows of at most width characters, preferring spaces.
+func wrap(s string, width int) []string {
+	var rows []string
+	for _, word := range strings.Fields(s) {
+		for runeLen(word) > width {
+			rows = append(rows, truncate(word, width))
+			word = string([]rune(word)[width:])
+		}
+		n := len(rows)
+		if n > 0 && runeLen(rows[n-1])+1+runeLen(word) <= width {
+			rows[n-1] += " " + word
+			continue
+		}
+		rows = append(rows, word)
+	}
+	return rows
+}
+
+func truncate(s string, width int) string {
+	if runeLen(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:width])
+}
+
+func runeLen(s string) int {
+	return utf8.RuneCountInString(s)
+}
+
+// ascii replaces characters thermal printers cannot show in their default
+// code page, so plain text and ESC/POS output stay identical.
+func ascii(s string) string {
+	s = strings.ReplaceAll(s, "₹", "Rs.")
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || (r >= 0x20 && r < 0x7f) {
+			return r
+		}
+		return '?'
+	}, s)
+}
@@ -0,0 +1,76 @@
+package printing
+
+import (
+	"flag"
+	"order-mgmt-backend/models"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files")
+
+func sampleOrder() *models.Order {
+	ist, _ := time.LoadLocation("Asia/Kolkata")
+	return &models.Order{
+		ID:              "3f2a9c1e-5b7d-4e8f-a1b2-c3d4e5f60718",
+		CustomerName:    "Priya Sharma",
+		CustomerAddress: "Flat 4B, Lakeview Apartments, 12th Main Road, Indiranagar, Bengaluru",
+		CustomerPhone:   "9876543210",
+		TotalPrice:      1097,
+		PaymentStatus:   "Paid",
+		CreatedAt:       time.Date(2026, 3, 5, 12, 30, 0, 0, ist),
+		OrderItems: []models.OrderItem{
+			{Quantity: 2, Price: 299, Item: models.Item{Name: "Margherita Pizza"}, Modifiers: []string{"extra cheese", "thin crust"}},
+			{Quantity: 1, Price: 499, Item: models.Item{Name: "Pepperoni Pizza"}, Notes: "cut into 8 slices please"},
+		},
+	}
+}
+
+func sampleHeader() Header {
+	ist, _ := time.LoadLocation("Asia/Kolkata")
+	return Header{StoreName: "Bengaluru Central Kitchen", Address: "100 Feet Road, Indiranagar, Bengaluru", Location: ist}
+}
+
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("missing golden file %s, run go test -update: %v", path, err)
+	}
+	assert.Equal(t, string(want), string(got))
+}
+
+func TestGoldenTickets(t *testing.T) {
+	order, header := sampleOrder(), sampleHeader()
+
+	golden(t, "receipt_58.txt", Text(Receipt(order, header, Width58mm), Width58mm))
+	golden(t, "receipt_80.txt", Text(Receipt(order, header, Width80mm), Width80mm))
+	golden(t, "kitchen_58.txt", Text(KitchenTicket(order, header, Width58mm), Width58mm))
+	golden(t, "kitchen_80.txt", Text(KitchenTicket(order, header, Width80mm), Width80mm))
+	golden(t, "receipt_80.escpos", ESCPOS(Receipt(order, header, Width80mm), Width80mm))
+	golden(t, "kitchen_58.escpos", ESCPOS(KitchenTicket(order, header, Width58mm), Width58mm))
+}
+
+func TestKitchenTicketHasNoPrices(t *testing.T) {
+	out := string(Text(KitchenTicket(sampleOrder(), sampleHeader(), Width80mm), Width80mm))
+	assert.NotContains(t, out, "299")
+	assert.NotContains(t, out, "1097")
+	assert.Contains(t, out, "+ extra cheese")
+}
+
+func TestLayoutHelpers(t *testing.T) {
+	assert.Equal(t, "Total      9.00", columns("Total", "9.00", 15))
+	assert.Equal(t, "A very lo 9.00", columns("A very long name", "9.00", 14))
+	assert.Equal(t, []string{"one two", "three"}, wrap("one two three", 8))
+	assert.Equal(t, "Rs.10 caf?", ascii("₹10 café"))
+}
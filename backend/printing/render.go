@@ -0,0 +1,79 @@
+package printing
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Text renders lines as plain text for a paper width in characters. Double
+// size rows are spelled out in capitals since plain text has no emphasis.
+func Text(lines []Line, width int) []byte {
+	var b bytes.Buffer
+	for _, l := range lines {
+		if l.Rule {
+			b.WriteString(strings.Repeat("-", width))
+			b.WriteByte('\n')
+			continue
+		}
+		text := truncate(l.Text, width)
+		if l.Double {
+			text = strings.ToUpper(text)
+		}
+		pad := width - runeLen(text)
+		switch l.Align {
+		case AlignCenter:
+			text = strings.Repeat(" ", pad/2) + text
+		case AlignRight:
+			text = strings.Repeat(" ", pad) + text
+		}
+		b.WriteString(strings.TrimRight(text, " "))
+		b.WriteByte('\n')
+		if l.Cut {
+			b.WriteByte('\n')
+		}
+	}
+	return b.Bytes()
+}
+
+const (
+	esc = 0x1b
+	gs  = 0x1d
+)
+
+// ESCPOS renders lines as a byte stream for ESC/POS thermal printers. Only
+// alignment, emphasis, double size and cutting are used, which every
+// ESC/POS-compatible printer supports.
+func ESCPOS(lines []Line, width int) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{esc, '@'})
+	for _, l := range lines {
+		if l.Rule {
+			b.Write([]byte{esc, 'a', byte(AlignLeft)})
+			b.WriteString(strings.Repeat("-", width))
+			b.WriteByte('\n')
+			continue
+		}
+		b.Write([]byte{esc, 'a', byte(l.Align)})
+		if l.Bold {
+			b.Write([]byte{esc, 'E', 1})
+		}
+		text := truncate(l.Text, width)
+		if l.Double {
+			b.Write([]byte{gs, '!', 0x11})
+			text = truncate(text, width/2)
+		}
+		b.WriteString(text)
+		b.WriteByte('\n')
+		if l.Double {
+			b.Write([]byte{gs, '!', 0x00})
+		}
+		if l.Bold {
+			b.Write([]byte{esc, 'E', 0})
+		}
+		if l.Cut {
+			// Feed three lines so the last row clears the cutter, then cut.
+			b.Write([]byte{gs, 'V', 66, 3})
+		}
+	}
+	return b.Bytes()
+}
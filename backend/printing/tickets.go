@@ -0,0 +1,101 @@
+package printing
+
+import (
+	"fmt"
+	"order-mgmt-backend/models"
+	"strings"
+	"time"
+)
+
+// Header identifies where a ticket was printed.
+type Header struct {
+	StoreName string
+	Address   string
+	Location  *time.Location
+}
+
+func shortID(order *models.Order) string {
+	return strings.ToUpper(truncate(order.ID, 8))
+}
+
+func (h Header) lines(width int) []Line {
+	lines := []Line{{Text: ascii(h.StoreName), Align: AlignCenter, Bold: true}}
+	for _, row := range wrap(ascii(h.Address), width) {
+		lines = append(lines, Line{Text: row, Align: AlignCenter})
+	}
+	return lines
+}
+
+func itemDetails(item models.OrderItem, width int) []Line {
+	var lines []Line
+	for _, m := range item.Modifiers {
+		for _, row := range wrap("+ "+ascii(m), width-3) {
+			lines = append(lines, Line{Text: "   " + row})
+		}
+	}
+	if item.Notes != "" {
+		for _, row := range wrap("Note: "+ascii(item.Notes), width-3) {
+			lines = append(lines, Line{Text: "   " + row})
+		}
+	}
+	return lines
+}
+
+// KitchenTicket lays out what the kitchen needs to cook an order: big order
+// number, items, modifiers and notes, and no prices.
+func KitchenTicket(order *models.Order, h Header, width int) []Line {
+	lines := []Line{
+		{Text: "KITCHEN", Align: AlignCenter, Bold: true},
+		{Text: "#" + shortID(order), Align: AlignCenter, Double: true},
+		{Text: order.CreatedAt.In(h.Location).Format("02 Jan 2006 15:04"), Align: AlignCenter},
+		{Rule: true},
+	}
+	for _, item := range order.OrderItems {
+		name := fmt.Sprintf("%d x %s", item.Quantity, ascii(item.Item.Name))
+		for _, row := range wrap(name, width) {
+			lines = append(lines, Line{Text: row, Bold: true})
+		}
+		lines = append(lines, itemDetails(item, width)...)
+	}
+	lines = append(lines, Line{Rule: true})
+	lines = append(lines, Line{Text: ascii(order.CustomerName), Cut: true})
+	return lines
+}
+
+// Receipt lays out the customer's copy of an order with prices and totals.
+func Receipt(order *models.Order, h Header, width int) []Line {
+	lines := h.lines(width)
+	lines = append(lines,
+		Line{Rule: true},
+		Line{Text: columns("Order", "#"+shortID(order), width)},
+		Line{Text: columns("Date", order.CreatedAt.In(h.Location).Format("02 Jan 2006 15:04"), width)},
+		Line{Text: "Customer: " + ascii(order.CustomerName)},
+		Line{Text: "Phone: " + ascii(order.CustomerPhone)},
+	)
+	for _, row := range wrap("Address: "+ascii(order.CustomerAddress), width) {
+		lines = append(lines, Line{Text: row})
+	}
+	lines = append(lines, Line{Rule: true})
+
+	for _, item := range order.OrderItems {
+		name := fmt.Sprintf("%d x %s", item.Quantity, ascii(item.Item.Name))
+		amount := fmt.Sprintf("%.2f", item.Price*float64(item.Quantity))
+		lines = append(lines, Line{Text: columns(name, amount, width)})
+		if item.Quantity > 1 {
+			lines = append(lines, Line{Text: fmt.Sprintf("   @ %.2f", item.Price)})
+		}
+		lines = append(lines, itemDetails(item, width)...)
+	}
+
+	lines = append(lines, Line{Rule: true})
+	if order.Discount > 0 {
+		lines = append(lines, Line{Text: columns("Loyalty discount", fmt.Sprintf("-%.2f", order.Discount), width)})
+	}
+	lines = append(lines,
+		Line{Text: columns("TOTAL", fmt.Sprintf("Rs.%.2f", order.TotalPrice), width), Bold: true},
+		Line{Text: columns("Payment", ascii(order.PaymentStatus), width)},
+		Line{Rule: true},
+		Line{Text: "Thank you!", Align: AlignCenter, Cut: true},
+	)
+	return lines
+}
@@ -0,0 +1,175 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"gorm.io/gorm"
+)
+
+// DefaultChannel is the NOTIFY channel the API's hub messages travel on.
+const DefaultChannel = "order_events"
+
+// maxNotifyPayload is Postgres' limit on a NOTIFY payload, less a little
+// for the topic wrapper.
+const maxNotifyPayload = 7900
+
+// spillTTL is how long a message too large for NOTIFY is kept for the
+// other instances to read.
+const spillTTL = time.Minute
+
+// spilledMessage holds the payload of a message too large for NOTIFY; the
+// notification then carries only its ID.
+type spilledMessage struct {
+	ID        int64 `gorm:"primaryKey"`
+	Payload   []byte
+	CreatedAt time.Time `gorm:"index"`
+}
+
+func (spilledMessage) TableName() string { return "pubsub_spilled_messages" }
+
+// notification is what travels on the channel: the message itself, or the
+// ID of its spilled payload.
+type notification struct {
+	Topic   string          `json:"topic"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Spilled int64           `json:"spilled,omitempty"`
+}
+
+// Postgres is a broker built on LISTEN/NOTIFY. Messages are published with
+// pg_notify on the shared pool and received on a dedicated connection, which
+// is re-established if it drops. Messages published while an instance is
+// reconnecting do not reach it. Payloads too large for NOTIFY are written
+// to a table and read back by each listener.
+type Postgres struct {
+	DB      *gorm.DB
+	DSN     string
+	Channel string
+
+	// RetryDelay is how long to wait before reconnecting the listener.
+	RetryDelay time.Duration
+
+	subs   handlers
+	cancel context.CancelFunc
+}
+
+// NewPostgres starts listening on channel and returns once the first LISTEN
+// has succeeded.
+func NewPostgres(ctx context.Context, db *gorm.DB, dsn, channel string) (*Postgres, error) {
+	if err := db.WithContext(ctx).AutoMigrate(&spilledMessage{}); err != nil {
+		return nil, err
+	}
+	p := &Postgres{DB: db, DSN: dsn, Channel: channel, RetryDelay: 2 * time.Second}
+	conn, err := p.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	listenCtx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	go p.listen(listenCtx, conn)
+	return p, nil
+}
+
+func (p *Postgres) Publish(ctx context.Context, topic string, payload []byte) error {
+	msg, err := json.Marshal(notification{Topic: topic, Payload: payload})
+	if err != nil {
+		return err
+	}
+	if len(msg) > maxNotifyPayload {
+		if msg, err = p.spill(ctx, topic, payload); err != nil {
+			return err
+		}
+	}
+	return p.DB.WithContext(ctx).Exec("SELECT pg_notify(?, ?)", p.Channel, string(msg)).Error
+}
+
+// spill stores payload for the listeners to read and returns the
+// notification pointing at it. Spilled payloads older than spillTTL are
+// cleared out on the way.
+func (p *Postgres) spill(ctx context.Context, topic string, payload []byte) ([]byte, error) {
+	db := p.DB.WithContext(ctx)
+	now := time.Now()
+	if err := db.Where("created_at < ?", now.Add(-spillTTL)).Delete(&spilledMessage{}).Error; err != nil {
+		log.Printf("PUBSUB ERROR: clearing spilled messages: %v", err)
+	}
+	row := spilledMessage{Payload: payload, CreatedAt: now}
+	if err := db.Create(&row).Error; err != nil {
+		return nil, err
+	}
+	return json.Marshal(notification{Topic: topic, Spilled: row.ID})
+}
+
+// message turns a notification back into the message published.
+func (p *Postgres) message(n notification) (Message, error) {
+	if n.Spilled == 0 {
+		return Message{Topic: n.Topic, Payload: n.Payload}, nil
+	}
+	var row spilledMessage
+	if err := p.DB.First(&row, n.Spilled).Error; err != nil {
+		return Message{}, err
+	}
+	return Message{Topic: n.Topic, Payload: row.Payload}, nil
+}
+
+func (p *Postgres) Subscribe(h Handler) func() {
+	return p.subs.add(h)
+}
+
+// Close stops listening.
+func (p *Postgres) Close() {
+	p.cancel()
+}
+
+func (p *Postgres) connect(ctx context.Context) (*pgx.Conn, error) {
+	conn, err := pgx.Connect(ctx, p.DSN)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{p.Channel}.Sanitize()); err != nil {
+		conn.Close(context.Background())
+		return nil, err
+	}
+	return conn, nil
+}
+
+// listen delivers notifications until ctx is cancelled, reconnecting
+// whenever the connection fails.
+func (p *Postgres) listen(ctx context.Context, conn *pgx.Conn) {
+	for {
+		for conn != nil {
+			n, err := conn.WaitForNotification(ctx)
+			if err != nil {
+				conn.Close(context.Background())
+				conn = nil
+				break
+			}
+			var note notification
+			if err := json.Unmarshal([]byte(n.Payload), &note); err != nil {
+				log.Printf("PUBSUB ERROR: bad message on %s: %v", p.Channel, err)
+				continue
+			}
+			m, err := p.message(note)
+			if err != nil {
+				log.Printf("PUBSUB ERROR: spilled message %d on %s: %v", note.Spilled, p.Channel, err)
+				continue
+			}
+			p.subs.dispatch(m)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("PUBSUB: listener on %s lost, reconnecting", p.Channel)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.RetryDelay):
+		}
+		var err error
+		if conn, err = p.connect(ctx); err != nil {
+			log.Printf("PUBSUB ERROR: reconnect: %v", err)
+		}
+	}
+}
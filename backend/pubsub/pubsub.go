@@ -0,0 +1,76 @@
+// Package pubsub carries hub messages between API instances, so that a
+// change made on one instance reaches clients connected to any of them.
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// Message is a payload published on a hub topic.
+type Message struct {
+	Topic   string          `json:"topic"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Handler receives every message published through a broker, including
+// those published by the same instance.
+type Handler func(Message)
+
+// Broker publishes messages to every subscriber on every instance.
+type Broker interface {
+	Publish(ctx context.Context, topic string, payload []byte) error
+	// Subscribe registers h and returns a function that removes it.
+	Subscribe(h Handler) (unsubscribe func())
+}
+
+// handlers is the subscriber list shared by the brokers.
+type handlers struct {
+	mu   sync.RWMutex
+	next int
+	byID map[int]Handler
+}
+
+func (hs *handlers) add(h Handler) func() {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	if hs.byID == nil {
+		hs.byID = make(map[int]Handler)
+	}
+	id := hs.next
+	hs.next++
+	hs.byID[id] = h
+	return func() {
+		hs.mu.Lock()
+		defer hs.mu.Unlock()
+		delete(hs.byID, id)
+	}
+}
+
+func (hs *handlers) dispatch(m Message) {
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+	for _, h := range hs.byID {
+		h(m)
+	}
+}
+
+// Memory is a broker within one process. It delivers synchronously, which
+// also makes it the broker for tests.
+type Memory struct {
+	subs handlers
+}
+
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) Publish(ctx context.Context, topic string, payload []byte) error {
+	m.subs.dispatch(Message{Topic: topic, Payload: payload})
+	return nil
+}
+
+func (m *Memory) Subscribe(h Handler) func() {
+	return m.subs.add(h)
+}
@@ -0,0 +1,96 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestMemory(t *testing.T) {
+	b := NewMemory()
+	var got []Message
+	stop := b.Subscribe(func(m Message) { got = append(got, m) })
+
+	assert.NoError(t, b.Publish(context.Background(), "o1", []byte(`{"status":"Ready"}`)))
+	stop()
+	assert.NoError(t, b.Publish(context.Background(), "o1", []byte(`{}`)))
+
+	assert.Len(t, got, 1)
+	assert.Equal(t, "o1", got[0].Topic)
+	assert.JSONEq(t, `{"status":"Ready"}`, string(got[0].Payload))
+}
+
+func TestSpill(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&spilledMessage{}))
+	p := &Postgres{DB: db}
+	ctx := context.Background()
+
+	big := []byte(`"` + strings.Repeat("x", 8000) + `"`)
+	raw, err := p.spill(ctx, "kitchen:1", big)
+	assert.NoError(t, err)
+	assert.Less(t, len(raw), maxNotifyPayload)
+	var n notification
+	assert.NoError(t, json.Unmarshal(raw, &n))
+	m, err := p.message(n)
+	assert.NoError(t, err)
+	assert.Equal(t, "kitchen:1", m.Topic)
+	assert.Equal(t, string(big), string(m.Payload))
+
+	// Old spills are cleared by the next one.
+	db.Model(&spilledMessage{}).Where("id = ?", n.Spilled).Update("created_at", time.Now().Add(-2*spillTTL))
+	_, err = p.spill(ctx, "kitchen:1", big)
+	assert.NoError(t, err)
+	_, err = p.message(n)
+	assert.Error(t, err)
+}
+
+// TestPostgres needs a database, for example
+// PUBSUB_TEST_DSN="host=localhost user=postgres dbname=postgres sslmode=disable".
+func TestPostgres(t *testing.T) {
+	dsn := os.Getenv("PUBSUB_TEST_DSN")
+	if dsn == "" {
+		t.Skip("PUBSUB_TEST_DSN is not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	// Two brokers stand in for two instances.
+	a, err := NewPostgres(ctx, db, dsn, "pubsub_test")
+	assert.NoError(t, err)
+	defer a.Close()
+	b, err := NewPostgres(ctx, db, dsn, "pubsub_test")
+	assert.NoError(t, err)
+	defer b.Close()
+
+	got := make(chan Message, 1)
+	b.Subscribe(func(m Message) { got <- m })
+	assert.NoError(t, a.Publish(ctx, "o1", []byte(`{"status":"Ready"}`)))
+	select {
+	case m := <-got:
+		assert.Equal(t, "o1", m.Topic)
+	case <-time.After(5 * time.Second):
+		t.Fatal("notification not received")
+	}
+
+	// Payloads too large for NOTIFY still reach the other instance.
+	big := []byte(`"` + strings.Repeat("x", 8000) + `"`)
+	assert.NoError(t, a.Publish(ctx, "o1", big))
+	select {
+	case m := <-got:
+		assert.Equal(t, "o1", m.Topic)
+		assert.Equal(t, string(big), string(m.Payload))
+	case <-time.After(5 * time.Second):
+		t.Fatal("large notification not received")
+	}
+}
@@ -0,0 +1,188 @@
+package schedule
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+	_ "time/tzdata"
+)
+
+const defaultTimeZone = "Asia/Kolkata"
+
+// Window is a recurring daily time range. Days is a bitmask of
+// 1<<time.Weekday values; zero means every day. Start and End are "HH:MM"
+// in the evaluating location. An End at or before Start wraps past midnight.
+type Window struct {
+	Days  int
+	Start string
+	End   string
+}
+
+// DayMask builds a Days bitmask from the given weekdays.
+func DayMask(days ...time.Weekday) int {
+	mask := 0
+	for _, d := range days {
+		mask |= 1 << d
+	}
+	return mask
+}
+
+// StoreLocation returns the time zone used when an outlet does not set its
+// own, taken from STORE_TIMEZONE and defaulting to India Standard Time.
+func StoreLocation() *time.Location {
+	return LoadLocation(os.Getenv("STORE_TIMEZONE"))
+}
+
+// LoadLocation resolves name, falling back to the default store time zone
+// when it is empty or unknown.
+func LoadLocation(name string) *time.Location {
+	if name == "" {
+		name = defaultTimeZone
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Printf("Unknown time zone %q, using %s", name, defaultTimeZone)
+		loc, _ = time.LoadLocation(defaultTimeZone)
+	}
+	return loc
+}
+
+// ParseClock converts "HH:MM" into minutes after midnight.
+func ParseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (w Window) onDay(d time.Weekday) bool {
+	return w.Days == 0 || w.Days&(1<<d) != 0
+}
+
+func (w Window) bounds() (int, int, bool) {
+	start, err := ParseClock(w.Start)
+	if err != nil {
+		return 0, 0, false
+	}
+	end, err := ParseClock(w.End)
+	if err != nil {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+// Contains reports whether t, viewed in loc, falls inside the window.
+func (w Window) Contains(t time.Time, loc *time.Location) bool {
+	start, end, ok := w.bounds()
+	if !ok {
+		return false
+	}
+	local := t.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	today := local.Weekday()
+	if start < end {
+		return w.onDay(today) && minute >= start && minute < end
+	}
+	// Overnight (or all-day) window: the evening part belongs to today,
+	// the early-morning part to the day the window started on.
+	yesterday := (today + 6) % 7
+	return (w.onDay(today) && minute >= start) || (w.onDay(yesterday) && minute < end)
+}
+
+// Open reports whether any of the windows contains t.
+func Open(windows []Window, t time.Time, loc *time.Location) bool {
+	for _, w := range windows {
+		if w.Contains(t, loc) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextOpen returns the earliest time at or after t when one of the windows
+// is open. It returns false when no window opens within the next week.
+func NextOpen(windows []Window, t time.Time, loc *time.Location) (time.Time, bool) {
+	if Open(windows, t, loc) {
+		return t, true
+	}
+	local := t.In(loc)
+	var next time.Time
+	found := false
+	for _, w := range windows {
+		start, _, ok := w.bounds()
+		if !ok {
+			continue
+		}
+		for offset := 0; offset <= 7; offset++ {
+			candidate := time.Date(local.Year(), local.Month(), local.Day()+offset, start/60, start%60, 0, 0, loc)
+			if !w.onDay(candidate.Weekday()) || candidate.Before(t) {
+				continue
+			}
+			if !found || candidate.Before(next) {
+				next = candidate
+				found = true
+			}
+			break
+		}
+	}
+	return next, found
+}
+
+// Label formats an opening time for display, e.g. "7:00" for later today or
+// "Mon 7:00" for another day.
+func Label(at, now time.Time, loc *time.Location) string {
+	at, now = at.In(loc), now.In(loc)
+	clock := fmt.Sprintf("%d:%02d", at.Hour(), at.Minute())
+	if at.YearDay() == now.YearDay() && at.Year() == now.Year() {
+		return clock
+	}
+	return at.Format("Mon") + " " + clock
+}
+
+// Closure is a period during which windows are overridden and nothing is
+// open, such as a holiday or a temporary pause.
+type Closure struct {
+	From time.Time
+	To   time.Time
+}
+
+func (c Closure) covers(t time.Time) bool {
+	return !t.Before(c.From) && t.Before(c.To)
+}
+
+// DayClosure returns a closure spanning the whole calendar date ("2006-01-02")
+// in loc.
+func DayClosure(date string, loc *time.Location) (Closure, error) {
+	day, err := time.ParseInLocation("2006-01-02", date, loc)
+	if err != nil {
+		return Closure{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", date)
+	}
+	return Closure{From: day, To: day.AddDate(0, 0, 1)}, nil
+}
+
+// OpenWithClosures reports whether t is inside a window and outside every
+// closure. When closed, it also returns the next opening time, if any.
+func OpenWithClosures(windows []Window, closures []Closure, t time.Time, loc *time.Location) (bool, time.Time, bool) {
+	at := t
+	// Each pass either lands on an open instant or skips past a closure, so
+	// the loop is bounded by the number of closures.
+	for i := 0; i <= len(closures); i++ {
+		next, ok := NextOpen(windows, at, loc)
+		if !ok {
+			return false, time.Time{}, false
+		}
+		blocked := false
+		for _, c := range closures {
+			if c.covers(next) {
+				at, blocked = c.To, true
+				break
+			}
+		}
+		if !blocked {
+			return next.Equal(t), next, true
+		}
+	}
+	return false, time.Time{}, false
+}
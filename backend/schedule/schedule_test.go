@@ -0,0 +1,77 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func at(t *testing.T, loc *time.Location, s string) time.Time {
+	v, err := time.ParseInLocation("2006-01-02 15:04", s, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestWindowContains(t *testing.T) {
+	loc := LoadLocation("Asia/Kolkata")
+	breakfast := Window{Start: "07:00", End: "11:00"}
+	late := Window{Days: DayMask(time.Friday), Start: "22:00", End: "02:00"}
+
+	// 2026-03-06 is a Friday.
+	assert.True(t, breakfast.Contains(at(t, loc, "2026-03-06 07:00"), loc))
+	assert.False(t, breakfast.Contains(at(t, loc, "2026-03-06 11:00"), loc))
+	assert.True(t, late.Contains(at(t, loc, "2026-03-06 23:30"), loc))
+	assert.True(t, late.Contains(at(t, loc, "2026-03-07 01:30"), loc))
+	assert.False(t, late.Contains(at(t, loc, "2026-03-07 23:30"), loc))
+	assert.False(t, Window{Start: "bad", End: "11:00"}.Contains(at(t, loc, "2026-03-06 08:00"), loc))
+
+	// The same instant seen from UTC is still evaluated in loc.
+	assert.True(t, breakfast.Contains(at(t, loc, "2026-03-06 08:00").UTC(), loc))
+}
+
+func TestNextOpen(t *testing.T) {
+	loc := LoadLocation("Asia/Kolkata")
+	weekdays := Window{Days: DayMask(time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday), Start: "07:00", End: "11:00"}
+
+	now := at(t, loc, "2026-03-06 06:00")
+	next, ok := NextOpen([]Window{weekdays}, now, loc)
+	assert.True(t, ok)
+	assert.Equal(t, at(t, loc, "2026-03-06 07:00"), next)
+	assert.Equal(t, "7:00", Label(next, now, loc))
+
+	now = at(t, loc, "2026-03-06 12:00")
+	next, ok = NextOpen([]Window{weekdays}, now, loc)
+	assert.True(t, ok)
+	assert.Equal(t, at(t, loc, "2026-03-09 07:00"), next)
+	assert.Equal(t, "Mon 7:00", Label(next, now, loc))
+
+	_, ok = NextOpen(nil, now, loc)
+	assert.False(t, ok)
+}
+
+func TestOpenWithClosures(t *testing.T) {
+	loc := LoadLocation("Asia/Kolkata")
+	hours := []Window{{Start: "09:00", End: "22:00"}}
+	holiday, err := DayClosure("2026-03-06", loc)
+	assert.NoError(t, err)
+	pause := Closure{From: at(t, loc, "2026-03-05 12:00"), To: at(t, loc, "2026-03-05 12:30")}
+
+	open, _, _ := OpenWithClosures(hours, nil, at(t, loc, "2026-03-05 12:10"), loc)
+	assert.True(t, open)
+
+	open, next, ok := OpenWithClosures(hours, []Closure{pause}, at(t, loc, "2026-03-05 12:10"), loc)
+	assert.False(t, open)
+	assert.True(t, ok)
+	assert.Equal(t, at(t, loc, "2026-03-05 12:30"), next)
+
+	open, next, ok = OpenWithClosures(hours, []Closure{holiday, pause}, at(t, loc, "2026-03-05 23:00"), loc)
+	assert.False(t, open)
+	assert.True(t, ok)
+	assert.Equal(t, at(t, loc, "2026-03-07 09:00"), next)
+
+	_, err = DayClosure("06/03/2026", loc)
+	assert.Error(t, err)
+}
@@ -0,0 +1,150 @@
+// Package storage keeps the files the app is sent, such as proof of
+// delivery photos, behind an interface so that they can live on local disk
+// or, later, in a bucket.
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrNotFound   = errors.New("object not found")
+	ErrInvalidKey = errors.New("invalid object key")
+)
+
+// Object is a stored file and its content type.
+type Object struct {
+	ContentType string
+	Data        []byte
+}
+
+// Store keeps objects under keys such as "proofs/<order id>/photo-1.jpg":
+// slash-separated names of letters, digits, '.', '-' and '_'. Putting a key
+// again replaces the object.
+type Store interface {
+	Put(ctx context.Context, key string, obj Object) error
+	Get(ctx context.Context, key string) (Object, error)
+}
+
+// Default is where uploads are kept. It holds them in memory, which suits
+// tests; servers set a Disk store.
+var Default Store = NewMemory()
+
+// ValidKey reports whether key may name an object.
+func ValidKey(key string) bool {
+	if key == "" || strings.HasSuffix(key, typeSuffix) {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+		for _, r := range part {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Memory keeps objects in memory.
+type Memory struct {
+	mu      sync.RWMutex
+	objects map[string]Object
+}
+
+func NewMemory() *Memory {
+	return &Memory{objects: make(map[string]Object)}
+}
+
+func (m *Memory) Put(ctx context.Context, key string, obj Object) error {
+	if !ValidKey(key) {
+		return ErrInvalidKey
+	}
+	obj.Data = append([]byte(nil), obj.Data...)
+	m.mu.Lock()
+	m.objects[key] = obj
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *Memory) Get(ctx context.Context, key string) (Object, error) {
+	m.mu.RLock()
+	obj, ok := m.objects[key]
+	m.mu.RUnlock()
+	if !ok {
+		return Object{}, ErrNotFound
+	}
+	obj.Data = append([]byte(nil), obj.Data...)
+	return obj, nil
+}
+
+// typeSuffix names the file beside each object that holds its content type.
+const typeSuffix = ".content-type"
+
+// Disk keeps objects as files under Dir, which is created as needed.
+type Disk struct {
+	Dir string
+}
+
+func (d Disk) path(key string) string {
+	return filepath.Join(d.Dir, filepath.FromSlash(key))
+}
+
+// Put writes the object to a temporary file and renames it into place, so
+// that a reader never sees half of it.
+func (d Disk) Put(ctx context.Context, key string, obj Object) error {
+	if !ValidKey(key) {
+		return ErrInvalidKey
+	}
+	path := d.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := writeFile(path+typeSuffix, []byte(obj.ContentType)); err != nil {
+		return err
+	}
+	return writeFile(path, obj.Data)
+}
+
+func (d Disk) Get(ctx context.Context, key string) (Object, error) {
+	if !ValidKey(key) {
+		return Object{}, ErrNotFound
+	}
+	path := d.path(key)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Object{}, ErrNotFound
+	}
+	if err != nil {
+		return Object{}, err
+	}
+	contentType, err := os.ReadFile(path + typeSuffix)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Object{}, err
+	}
+	return Object{ContentType: string(contentType), Data: data}, nil
+}
+
+func writeFile(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
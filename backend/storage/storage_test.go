@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidKey(t *testing.T) {
+	assert.True(t, ValidKey("proofs/ORD-1/photo-1.jpg"))
+	for _, key := range []string{"", "/etc/passwd", "proofs/../secret", "proofs//a", "a b", "photo.jpg" + typeSuffix} {
+		assert.False(t, ValidKey(key), key)
+	}
+}
+
+func TestStores(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range map[string]Store{"memory": NewMemory(), "disk": Disk{Dir: t.TempDir()}} {
+		t.Run(name, func(t *testing.T) {
+			_, err := s.Get(ctx, "proofs/o1/photo.jpg")
+			assert.ErrorIs(t, err, ErrNotFound)
+			assert.ErrorIs(t, s.Put(ctx, "../escape", Object{Data: []byte("x")}), ErrInvalidKey)
+
+			assert.NoError(t, s.Put(ctx, "proofs/o1/photo.jpg", Object{ContentType: "image/jpeg", Data: []byte("first")}))
+			assert.NoError(t, s.Put(ctx, "proofs/o1/photo.jpg", Object{ContentType: "image/jpeg", Data: []byte("second")}))
+			obj, err := s.Get(ctx, "proofs/o1/photo.jpg")
+			assert.NoError(t, err)
+			assert.Equal(t, Object{ContentType: "image/jpeg", Data: []byte("second")}, obj)
+		})
+	}
+}
@@ -18,13 +18,14 @@ import (
 
 func setupTestDB() {
 	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-	db.AutoMigrate(&models.Item{}, &models.Order{}, &models.OrderItem{})
+	database.Migrate(db)
 	database.DB = db
 
 	items := []models.Item{
 		{ID: 1, Name: "Test Item", Price: 10.0},
 	}
 	db.Create(&items)
+	db.Create(&models.Outlet{ID: 1, Name: "Test Kitchen", Latitude: 12.9716, Longitude: 77.5946, DeliveryRadiusKm: 10})
 }
 
 func TestGetMenu(t *testing.T) {
@@ -38,10 +39,11 @@ func TestGetMenu(t *testing.T) {
 	r.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
-	var items []models.Item
-	json.Unmarshal(w.Body.Bytes(), &items)
-	assert.Len(t, items, 1)
-	assert.Equal(t, "Test Item", items[0].Name)
+	var menu models.Menu
+	json.Unmarshal(w.Body.Bytes(), &menu)
+	assert.True(t, menu.IsOpen)
+	assert.Len(t, menu.Items, 1)
+	assert.Equal(t, "Test Item", menu.Items[0].Name)
 }
 
 func TestCreateOrder(t *testing.T) {
@@ -50,7 +52,7 @@ func TestCreateOrder(t *testing.T) {
 	r := gin.Default()
 	r.POST("/orders", handlers.CreateOrder)
 
-	payload := `{"customer_name":"John Doe","customer_address":"123 St","customer_phone":"1234567890","items":[{"item_id":1,"quantity":2}]}`
+	payload := `{"customer_name":"John Doe","customer_address":"123 St","customer_phone":"1234567890","latitude":12.97,"longitude":77.59,"items":[{"item_id":1,"quantity":2}]}`
 	req, _ := http.NewRequest("POST", "/orders", strings.NewReader(payload))
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
@@ -82,12 +84,20 @@ func TestCancelOrder(t *testing.T) {
 	r := gin.Default()
 	r.POST("/orders/:id/cancel", handlers.CancelOrder)
 
+	t.Setenv("ADMIN_API_KEY", "secret")
+
 	order := models.NewOrder()
 	database.DB.Create(&order)
 
 	req, _ := http.NewRequest("POST", "/orders/"+order.ID+"/cancel", nil)
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req, _ = http.NewRequest("POST", "/orders/"+order.ID+"/cancel", nil)
+	req.Header.Set("X-Admin-Key", "secret")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
 
@@ -100,19 +110,58 @@ func TestUpdateOrderStatus(t *testing.T) {
 	setupTestDB()
 	gin.SetMode(gin.TestMode)
 	r := gin.Default()
-	r.PATCH("/orders/:id/status", handlers.UpdateOrderStatus)
+	r.PATCH("/orders/:id/status", handlers.RequireAdmin, handlers.UpdateOrderStatus)
+	t.Setenv("ADMIN_API_KEY", "secret")
 
 	order := models.NewOrder()
 	database.DB.Create(&order)
 
-	payload := `{"status":"Delivered"}`
+	payload := `{"status":"Preparing"}`
 	req, _ := http.NewRequest("PATCH", "/orders/"+order.ID+"/status", strings.NewReader(payload))
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req, _ = http.NewRequest("PATCH", "/orders/"+order.ID+"/status", strings.NewReader(payload))
+	req.Header.Set("X-Admin-Key", "secret")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
 
 	var updatedOrder models.Order
 	database.DB.First(&updatedOrder, "id = ?", order.ID)
-	assert.Equal(t, "Delivered", updatedOrder.Status)
+	assert.Equal(t, "Preparing", updatedOrder.Status)
+
+	// Only the rider can mark an order delivered.
+	req, _ = http.NewRequest("PATCH", "/orders/"+order.ID+"/status", strings.NewReader(`{"status":"Delivered"}`))
+	req.Header.Set("X-Admin-Key", "secret")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	database.DB.First(&updatedOrder, "id = ?", order.ID)
+	assert.Equal(t, "Preparing", updatedOrder.Status)
+
+	// Orders only move along the usual transitions.
+	req, _ = http.NewRequest("PATCH", "/orders/"+order.ID+"/status", strings.NewReader(`{"status":"Order Received"}`))
+	req.Header.Set("X-Admin-Key", "secret")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	database.DB.First(&updatedOrder, "id = ?", order.ID)
+	assert.Equal(t, "Preparing", updatedOrder.Status)
+
+	// Nor can an unpaid order be sent to the kitchen.
+	unpaid := models.NewOrder()
+	unpaid.Status = models.StatusAwaitingPayment
+	database.DB.Create(&unpaid)
+	req, _ = http.NewRequest("PATCH", "/orders/"+unpaid.ID+"/status", strings.NewReader(`{"status":"Order Received"}`))
+	req.Header.Set("X-Admin-Key", "secret")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "AWAITING_PAYMENT")
+	var stillUnpaid models.Order
+	database.DB.First(&stillUnpaid, "id = ?", unpaid.ID)
+	assert.Equal(t, models.StatusAwaitingPayment, stillUnpaid.Status)
 }
@@ -0,0 +1,186 @@
+// Package tracking turns the GPS pings riders send into a short track, a
+// speed and an arrival estimate. It also decides which pings are worth
+// keeping and how often updates go on to customers.
+package tracking
+
+import (
+	"fmt"
+	"order-mgmt-backend/geo"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Ping is one position reported by a rider's phone.
+type Ping struct {
+	Point    geo.Point
+	SpeedKmh float64 // as reported by the phone, 0 if unknown
+	At       time.Time
+}
+
+// Config sets how pings are sampled and how often updates are sent.
+type Config struct {
+	// A ping sooner than MinInterval after the last one kept is dropped,
+	// unless the rider moved at least MinDistanceM metres.
+	MinInterval  time.Duration
+	MinDistanceM float64
+	// TrackLength is how many pings are kept for each delivery.
+	TrackLength int
+	// PublishEvery is the least time between location events for an order.
+	PublishEvery time.Duration
+	// ETAStep is how far an estimate must move before it is sent again.
+	ETAStep time.Duration
+	// Speeds are clamped to MinSpeedKmh..MaxSpeedKmh, so that a rider at
+	// a traffic light is not shown as never arriving. DefaultSpeedKmh is
+	// used until the track gives a speed.
+	DefaultSpeedKmh float64
+	MinSpeedKmh     float64
+	MaxSpeedKmh     float64
+}
+
+// DefaultConfig suits a rider on a scooter in city traffic.
+func DefaultConfig() Config {
+	return Config{
+		MinInterval:     5 * time.Second,
+		MinDistanceM:    25,
+		TrackLength:     50,
+		PublishEvery:    10 * time.Second,
+		ETAStep:         time.Minute,
+		DefaultSpeedKmh: 20,
+		MinSpeedKmh:     5,
+		MaxSpeedKmh:     60,
+	}
+}
+
+// FromEnv is DefaultConfig with any of TRACKING_MIN_INTERVAL,
+// TRACKING_MIN_DISTANCE_M, TRACKING_TRACK_LENGTH and
+// TRACKING_PUBLISH_INTERVAL applied. Intervals are durations such as "5s".
+func FromEnv() (Config, error) {
+	c := DefaultConfig()
+	for name, set := range map[string]func(string) error{
+		"TRACKING_MIN_INTERVAL": func(v string) (err error) {
+			c.MinInterval, err = time.ParseDuration(v)
+			return err
+		},
+		"TRACKING_MIN_DISTANCE_M": func(v string) (err error) {
+			c.MinDistanceM, err = strconv.ParseFloat(v, 64)
+			return err
+		},
+		"TRACKING_TRACK_LENGTH": func(v string) (err error) {
+			c.TrackLength, err = strconv.Atoi(v)
+			if err == nil && c.TrackLength < 2 {
+				err = fmt.Errorf("must be at least 2")
+			}
+			return err
+		},
+		"TRACKING_PUBLISH_INTERVAL": func(v string) (err error) {
+			c.PublishEvery, err = time.ParseDuration(v)
+			return err
+		},
+	} {
+		if v := os.Getenv(name); v != "" {
+			if err := set(v); err != nil {
+				return DefaultConfig(), fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+	return c, nil
+}
+
+// Keep reports whether p is worth recording after last, the latest ping
+// kept, which is nil for a rider's first ping. Pings older than last are
+// dropped, since phones resend them when they reconnect.
+func (c Config) Keep(last *Ping, p Ping) bool {
+	if last == nil {
+		return true
+	}
+	if !p.At.After(last.At) {
+		return false
+	}
+	if p.At.Sub(last.At) >= c.MinInterval {
+		return true
+	}
+	return geo.DistanceKm(last.Point, p.Point)*1000 >= c.MinDistanceM
+}
+
+// Speed estimates how fast the rider is going from their track, oldest
+// first: the distance covered over the time it took. With a single ping
+// the phone's own reading is used.
+func (c Config) Speed(track []Ping) float64 {
+	speed := c.DefaultSpeedKmh
+	if n := len(track); n >= 2 {
+		var km float64
+		for i := 1; i < n; i++ {
+			km += geo.DistanceKm(track[i-1].Point, track[i].Point)
+		}
+		if hours := track[n-1].At.Sub(track[0].At).Hours(); hours > 0 {
+			speed = km / hours
+		}
+	} else if n == 1 && track[0].SpeedKmh > 0 {
+		speed = track[0].SpeedKmh
+	}
+	if speed < c.MinSpeedKmh {
+		speed = c.MinSpeedKmh
+	}
+	if c.MaxSpeedKmh > 0 && speed > c.MaxSpeedKmh {
+		speed = c.MaxSpeedKmh
+	}
+	return speed
+}
+
+// ETA is when a rider at from, going at speedKmh, reaches to.
+func ETA(from, to geo.Point, speedKmh float64, now time.Time) time.Time {
+	return now.Add(geo.TravelTime(geo.DistanceKm(from, to), speedKmh))
+}
+
+// Moved reports whether an estimate changed from before to after by at
+// least the configured step.
+func (c Config) Moved(before *time.Time, after time.Time) bool {
+	if before == nil {
+		return true
+	}
+	d := after.Sub(*before)
+	return d >= c.ETAStep || d <= -c.ETAStep
+}
+
+// Throttle lets through at most one event per key in every interval. Keys
+// whose interval has run out are dropped as it goes, so orders that stop
+// sending events without being forgotten do not pile up.
+type Throttle struct {
+	every time.Duration
+	mu    sync.Mutex
+	last  map[string]time.Time
+	swept time.Time
+}
+
+func NewThrottle(every time.Duration) *Throttle {
+	return &Throttle{every: every, last: make(map[string]time.Time)}
+}
+
+// Allow reports whether an event for key may go out at now, and if so
+// starts a new interval.
+func (t *Throttle) Allow(key string, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if last, ok := t.last[key]; ok && now.Sub(last) < t.every {
+		return false
+	}
+	if now.Sub(t.swept) >= t.every {
+		for k, last := range t.last {
+			if now.Sub(last) >= t.every {
+				delete(t.last, k)
+			}
+		}
+		t.swept = now
+	}
+	t.last[key] = now
+	return true
+}
+
+// Forget drops key, once no more events will come for it.
+func (t *Throttle) Forget(key string) {
+	t.mu.Lock()
+	delete(t.last, key)
+	t.mu.Unlock()
+}
@@ -0,0 +1,82 @@
+package tracking
+
+import (
+	"order-mgmt-backend/geo"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var start = time.Date(2026, 3, 5, 12, 0, 0, 0, time.UTC)
+
+func TestKeep(t *testing.T) {
+	c := DefaultConfig()
+	last := Ping{Point: geo.Point{Lat: 12.9716, Lng: 77.5946}, At: start}
+	still := geo.Point{Lat: 12.97161, Lng: 77.5946}
+	moved := geo.Point{Lat: 12.9726, Lng: 77.5946} // about 110 m north
+
+	assert.True(t, c.Keep(nil, last))
+	assert.False(t, c.Keep(&last, Ping{Point: still, At: start.Add(2 * time.Second)}))
+	assert.True(t, c.Keep(&last, Ping{Point: moved, At: start.Add(2 * time.Second)}))
+	assert.True(t, c.Keep(&last, Ping{Point: still, At: start.Add(5 * time.Second)}))
+	assert.False(t, c.Keep(&last, Ping{Point: moved, At: start}), "a resent ping is dropped")
+}
+
+func TestSpeed(t *testing.T) {
+	c := DefaultConfig()
+	assert.Equal(t, 20.0, c.Speed(nil))
+	assert.Equal(t, 32.0, c.Speed([]Ping{{SpeedKmh: 32, At: start}}))
+
+	// About 1.11 km in three minutes is 22 km/h.
+	track := []Ping{
+		{Point: geo.Point{Lat: 12.97, Lng: 77.59}, At: start},
+		{Point: geo.Point{Lat: 12.975, Lng: 77.59}, At: start.Add(90 * time.Second)},
+		{Point: geo.Point{Lat: 12.98, Lng: 77.59}, At: start.Add(3 * time.Minute)},
+	}
+	assert.InDelta(t, 22.2, c.Speed(track), 0.1)
+
+	parked := []Ping{track[0], {Point: track[0].Point, At: start.Add(time.Minute)}}
+	assert.Equal(t, c.MinSpeedKmh, c.Speed(parked))
+}
+
+func TestETA(t *testing.T) {
+	from := geo.Point{Lat: 12.97, Lng: 77.59}
+	to := geo.Point{Lat: 12.98, Lng: 77.59}
+	eta := ETA(from, to, 20, start)
+	assert.InDelta(t, (200 * time.Second).Seconds(), eta.Sub(start).Seconds(), 1)
+
+	c := DefaultConfig()
+	assert.True(t, c.Moved(nil, eta))
+	assert.False(t, c.Moved(&eta, eta.Add(30*time.Second)))
+	assert.True(t, c.Moved(&eta, eta.Add(-time.Minute)))
+}
+
+func TestThrottle(t *testing.T) {
+	th := NewThrottle(10 * time.Second)
+	assert.True(t, th.Allow("o1", start))
+	assert.False(t, th.Allow("o1", start.Add(5*time.Second)))
+	assert.True(t, th.Allow("o2", start.Add(5*time.Second)))
+	assert.True(t, th.Allow("o1", start.Add(10*time.Second)))
+	th.Forget("o1")
+	assert.True(t, th.Allow("o1", start.Add(11*time.Second)))
+
+	// Keys whose interval ran out go even when nobody forgets them.
+	assert.True(t, th.Allow("o3", start.Add(30*time.Second)))
+	assert.Len(t, th.last, 1)
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("TRACKING_MIN_INTERVAL", "2s")
+	t.Setenv("TRACKING_TRACK_LENGTH", "20")
+	c, err := FromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Second, c.MinInterval)
+	assert.Equal(t, 20, c.TrackLength)
+	assert.Equal(t, DefaultConfig().PublishEvery, c.PublishEvery)
+
+	t.Setenv("TRACKING_PUBLISH_INTERVAL", "often")
+	c, err = FromEnv()
+	assert.Error(t, err)
+	assert.Equal(t, DefaultConfig(), c)
+}
@@ -0,0 +1,316 @@
+// Package wallet keeps customers' store credit in a double-entry ledger.
+// Balances are never stored; they are the sum of a customer's ledger
+// entries.
+package wallet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"order-mgmt-backend/clock"
+	"order-mgmt-backend/models"
+	"order-mgmt-backend/payments"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	KindCredit = "credit"
+	KindDebit  = "debit"
+	KindExpiry = "expiry"
+)
+
+// Store accounts on the other side of customer movements.
+const (
+	AccountStoreCredit  = "store:credit"
+	AccountStoreSales   = "store:sales"
+	AccountStoreExpired = "store:expired"
+)
+
+// ActorSystem marks movements made by the API itself rather than a person.
+const ActorSystem = "system"
+
+var (
+	ErrInvalidAmount  = errors.New("amount must be positive")
+	ErrReferenceReuse = errors.New("reference was already used for a different movement")
+)
+
+// UserAccount is the ledger account of a customer.
+func UserAccount(userID uint) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+func paise(v float64) int64 {
+	return int64(math.Round(v * 100))
+}
+
+// Grant describes a credit to a customer's wallet.
+type Grant struct {
+	UserID    uint
+	Amount    float64
+	Reference string
+	Reason    string
+	Actor     string
+	ExpiresAt *time.Time
+}
+
+// Ledger is a payments.Wallet backed by the database.
+type Ledger struct {
+	DB *gorm.DB
+}
+
+var _ payments.Wallet = Ledger{}
+
+func (l Ledger) Balance(ctx context.Context, userID uint) (float64, error) {
+	var balance float64
+	err := l.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockAccount(tx, userID); err != nil {
+			return err
+		}
+		if err := expireDue(tx, userID, clock.Now()); err != nil {
+			return err
+		}
+		var err error
+		balance, err = accountBalance(tx, userID)
+		return err
+	})
+	return balance, err
+}
+
+// Credit gives store credit that does not expire.
+func (l Ledger) Credit(ctx context.Context, userID uint, amount float64, ref string) error {
+	_, _, err := l.Grant(ctx, Grant{UserID: userID, Amount: amount, Reference: ref, Reason: "Store credit", Actor: ActorSystem})
+	return err
+}
+
+// Debit spends store credit on an order.
+func (l Ledger) Debit(ctx context.Context, userID uint, amount float64, ref string) error {
+	_, _, err := l.post(ctx, models.WalletTransaction{
+		UserID:    userID,
+		Kind:      KindDebit,
+		Amount:    amount,
+		Reference: ref,
+		Reason:    "Order payment",
+		Actor:     ActorSystem,
+	})
+	return err
+}
+
+// Grant credits a wallet and returns the movement, with created false when
+// the reference had already been applied.
+func (l Ledger) Grant(ctx context.Context, g Grant) (models.WalletTransaction, bool, error) {
+	return l.post(ctx, models.WalletTransaction{
+		UserID:    g.UserID,
+		Kind:      KindCredit,
+		Amount:    g.Amount,
+		Reference: g.Reference,
+		Reason:    g.Reason,
+		Actor:     g.Actor,
+		ExpiresAt: g.ExpiresAt,
+	})
+}
+
+// Statement returns every movement on a customer's wallet, oldest first,
+// after applying any expiries that are due.
+func (l Ledger) Statement(ctx context.Context, userID uint) ([]models.WalletTransaction, error) {
+	var txns []models.WalletTransaction
+	err := l.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockAccount(tx, userID); err != nil {
+			return err
+		}
+		if err := expireDue(tx, userID, clock.Now()); err != nil {
+			return err
+		}
+		return tx.Preload("Entries").Where("user_id = ?", userID).Order("id").Find(&txns).Error
+	})
+	return txns, err
+}
+
+// ExpireAll expires due credits on every wallet and returns how many
+// wallets it checked.
+func (l Ledger) ExpireAll(ctx context.Context) (int, error) {
+	now := clock.Now()
+	var userIDs []uint
+	if err := l.DB.WithContext(ctx).Model(&models.WalletTransaction{}).
+		Where("kind = ? AND expires_at <= ?", KindCredit, now.UTC()).
+		Distinct().Pluck("user_id", &userIDs).Error; err != nil {
+		return 0, err
+	}
+	for _, id := range userIDs {
+		err := l.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := lockAccount(tx, id); err != nil {
+				return err
+			}
+			return expireDue(tx, id, now)
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(userIDs), nil
+}
+
+// post applies one movement. Replaying a reference returns the original
+// movement without applying it again.
+func (l Ledger) post(ctx context.Context, txn models.WalletTransaction) (models.WalletTransaction, bool, error) {
+	if paise(txn.Amount) <= 0 {
+		return txn, false, ErrInvalidAmount
+	}
+	txn.Amount = float64(paise(txn.Amount)) / 100
+	if txn.ExpiresAt != nil {
+		at := txn.ExpiresAt.UTC()
+		txn.ExpiresAt = &at
+	}
+	created := false
+	err := l.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockAccount(tx, txn.UserID); err != nil {
+			return err
+		}
+		var existing models.WalletTransaction
+		err := tx.Preload("Entries").Where("reference = ?", txn.Reference).First(&existing).Error
+		if err == nil {
+			if existing.UserID != txn.UserID || existing.Kind != txn.Kind || paise(existing.Amount) != paise(txn.Amount) {
+				return ErrReferenceReuse
+			}
+			txn = existing
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		now := clock.Now()
+		if err := expireDue(tx, txn.UserID, now); err != nil {
+			return err
+		}
+		if txn.Kind == KindDebit {
+			balance, err := accountBalance(tx, txn.UserID)
+			if err != nil {
+				return err
+			}
+			if paise(balance) < paise(txn.Amount) {
+				return payments.ErrInsufficientFunds
+			}
+		}
+		created = true
+		return record(tx, &txn, now)
+	})
+	return txn, created, err
+}
+
+// record writes txn and its two ledger legs.
+func record(tx *gorm.DB, txn *models.WalletTransaction, now time.Time) error {
+	counter := map[string]string{
+		KindCredit: AccountStoreCredit,
+		KindDebit:  AccountStoreSales,
+		KindExpiry: AccountStoreExpired,
+	}[txn.Kind]
+	sign := 1.0
+	if txn.Kind != KindCredit {
+		sign = -1
+	}
+	txn.CreatedAt = now.UTC()
+	txn.Entries = []models.LedgerEntry{
+		{Account: UserAccount(txn.UserID), Amount: sign * txn.Amount, CreatedAt: txn.CreatedAt},
+		{Account: counter, Amount: -sign * txn.Amount, CreatedAt: txn.CreatedAt},
+	}
+	return tx.Create(txn).Error
+}
+
+func lockAccount(tx *gorm.DB, userID uint) error {
+	account := models.WalletAccount{UserID: userID}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&account).Error; err != nil {
+		return err
+	}
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ?", userID).First(&account).Error
+}
+
+func accountBalance(tx *gorm.DB, userID uint) (float64, error) {
+	var sum float64
+	err := tx.Model(&models.LedgerEntry{}).Where("account = ?", UserAccount(userID)).
+		Select("COALESCE(SUM(amount), 0)").Scan(&sum).Error
+	return float64(paise(sum)) / 100, err
+}
+
+// lot is what is left of one credit after the debits and expiries that
+// drew on it.
+type lot struct {
+	txn  models.WalletTransaction
+	left int64
+}
+
+// lots replays a customer's movements. Debits spend the credit that expires
+// soonest first, so that customers lose as little as possible to expiry.
+func lots(txns []models.WalletTransaction) []*lot {
+	var open []*lot
+	byID := make(map[uint]*lot)
+	for _, t := range txns {
+		switch t.Kind {
+		case KindCredit:
+			l := &lot{txn: t, left: paise(t.Amount)}
+			open = append(open, l)
+			byID[t.ID] = l
+		case KindExpiry:
+			if t.SourceID != nil && byID[*t.SourceID] != nil {
+				byID[*t.SourceID].left -= paise(t.Amount)
+			}
+		case KindDebit:
+			spendable := make([]*lot, 0, len(open))
+			for _, l := range open {
+				if l.left > 0 && (l.txn.ExpiresAt == nil || l.txn.ExpiresAt.After(t.CreatedAt)) {
+					spendable = append(spendable, l)
+				}
+			}
+			sort.SliceStable(spendable, func(i, j int) bool {
+				a, b := spendable[i].txn.ExpiresAt, spendable[j].txn.ExpiresAt
+				return a != nil && (b == nil || a.Before(*b))
+			})
+			need := paise(t.Amount)
+			for _, l := range spendable {
+				take := l.left
+				if take > need {
+					take = need
+				}
+				l.left -= take
+				need -= take
+				if need == 0 {
+					break
+				}
+			}
+		}
+	}
+	return open
+}
+
+// expireDue writes an expiry for the unspent part of every credit on the
+// customer's wallet that has expired by now.
+func expireDue(tx *gorm.DB, userID uint, now time.Time) error {
+	var txns []models.WalletTransaction
+	if err := tx.Where("user_id = ?", userID).Order("id").Find(&txns).Error; err != nil {
+		return err
+	}
+	for _, l := range lots(txns) {
+		if l.left <= 0 || l.txn.ExpiresAt == nil || l.txn.ExpiresAt.After(now) {
+			continue
+		}
+		source := l.txn.ID
+		expiry := models.WalletTransaction{
+			UserID:    userID,
+			Kind:      KindExpiry,
+			Amount:    float64(l.left) / 100,
+			Reference: fmt.Sprintf("expire:%d", source),
+			Reason:    "Credit expired",
+			Actor:     ActorSystem,
+			SourceID:  &source,
+		}
+		if err := record(tx, &expiry, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package wallet
+
+import (
+	"context"
+	"order-mgmt-backend/clock"
+	"order-mgmt-backend/database"
+	"order-mgmt-backend/models"
+	"order-mgmt-backend/payments"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newLedger(t *testing.T) Ledger {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, database.Migrate(db))
+	return Ledger{DB: db}
+}
+
+func pin(t *testing.T, at time.Time) {
+	clock.Now = func() time.Time { return at }
+	t.Cleanup(func() { clock.Now = time.Now })
+}
+
+func TestCreditDebitAndIdempotency(t *testing.T) {
+	l := newLedger(t)
+	ctx := context.Background()
+
+	assert.NoError(t, l.Credit(ctx, 1, 100, "refund:1"))
+	assert.NoError(t, l.Credit(ctx, 1, 100, "refund:1"))
+	assert.NoError(t, l.Debit(ctx, 1, 30.5, "order:a"))
+	assert.NoError(t, l.Debit(ctx, 1, 30.5, "order:a"))
+
+	balance, err := l.Balance(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 69.5, balance)
+
+	assert.ErrorIs(t, l.Debit(ctx, 1, 69.51, "order:b"), payments.ErrInsufficientFunds)
+	assert.ErrorIs(t, l.Debit(ctx, 1, 10, "refund:1"), ErrReferenceReuse)
+	assert.ErrorIs(t, l.Credit(ctx, 1, 0, "zero"), ErrInvalidAmount)
+
+	// Every movement is balanced by a store account.
+	var sum float64
+	l.DB.Model(&models.LedgerEntry{}).Select("SUM(amount)").Scan(&sum)
+	assert.Equal(t, int64(0), paise(sum))
+
+	statement, err := l.Statement(ctx, 1)
+	assert.NoError(t, err)
+	assert.Len(t, statement, 2)
+	assert.Len(t, statement[0].Entries, 2)
+}
+
+func TestExpirySpendsSoonestExpiringFirst(t *testing.T) {
+	l := newLedger(t)
+	ctx := context.Background()
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	pin(t, start)
+
+	soon, later := start.Add(24*time.Hour), start.Add(72*time.Hour)
+	l.Grant(ctx, Grant{UserID: 2, Amount: 50, Reference: "goodwill:1", Reason: "Late order", Actor: "ops", ExpiresAt: &later})
+	l.Grant(ctx, Grant{UserID: 2, Amount: 40, Reference: "goodwill:2", Reason: "Cold food", Actor: "ops", ExpiresAt: &soon})
+	l.Credit(ctx, 2, 10, "refund:9")
+
+	// The debit draws on the credit expiring tomorrow first.
+	assert.NoError(t, l.Debit(ctx, 2, 30, "order:c"))
+
+	pin(t, start.Add(48*time.Hour))
+	balance, _ := l.Balance(ctx, 2)
+	assert.Equal(t, 60.0, balance)
+
+	pin(t, start.Add(96*time.Hour))
+	checked, err := l.ExpireAll(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, checked)
+	balance, _ = l.Balance(ctx, 2)
+	assert.Equal(t, 10.0, balance)
+
+	statement, _ := l.Statement(ctx, 2)
+	var expired []float64
+	for _, txn := range statement {
+		if txn.Kind == KindExpiry {
+			expired = append(expired, txn.Amount)
+		}
+	}
+	assert.Equal(t, []float64{10, 50}, expired)
+}
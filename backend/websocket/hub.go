@@ -1,10 +1,16 @@
 package websocket
 
 import (
-	"github.com/gorilla/websocket"
+	"context"
+	"encoding/json"
 	"log"
 	"net/http"
+	"order-mgmt-backend/pubsub"
+	"strconv"
 	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 var upgrader = websocket.Upgrader{
@@ -13,71 +19,328 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+// Connection timings. Pings go out more often than the pong deadline so that
+// a live client always answers in time.
+const (
+	defaultWriteWait  = 10 * time.Second
+	defaultPongWait   = 60 * time.Second
+	defaultPingPeriod = defaultPongWait * 9 / 10
+	defaultSendBuffer = 32
+
+	// Clients send pongs, close frames and small JSON messages such as
+	// location pings.
+	maxMessageSize = 1024
+)
+
+// Hub fans messages out to the subscriptions on each topic: WebSocket
+// connections and anything else that follows a topic, such as SSE streams.
+// Every subscription has a buffered channel so that publishing never waits
+// on a reader. A subscription whose buffer is full is too slow to keep up
+// and is dropped rather than allowed to hold up everyone else.
+//
+// Broadcasts go through a broker and are delivered when the broker hands
+// them back, so every instance sharing the broker reaches its own clients.
 type Hub struct {
-	clients map[string][]*websocket.Conn
+	clients map[string]map[*Subscription]struct{}
 	mu      sync.RWMutex
+
+	broker      pubsub.Broker
+	unsubscribe func()
+
+	WriteWait  time.Duration
+	PongWait   time.Duration
+	PingPeriod time.Duration
+	SendBuffer int
+
+	// Replay, when set, returns the messages on topic numbered after since,
+	// oldest first, for order clients that resume with ?since=.
+	Replay func(topic string, since int64) ([][]byte, error)
+}
+
+// NewHub returns a hub on an in-memory broker, which only reaches clients
+// of this instance.
+func NewHub() *Hub {
+	h := &Hub{
+		clients:    make(map[string]map[*Subscription]struct{}),
+		WriteWait:  defaultWriteWait,
+		PongWait:   defaultPongWait,
+		PingPeriod: defaultPingPeriod,
+		SendBuffer: defaultSendBuffer,
+	}
+	h.UseBroker(pubsub.NewMemory())
+	return h
+}
+
+// UseBroker switches the hub to b. It should be called before the hub
+// starts serving.
+func (h *Hub) UseBroker(b pubsub.Broker) {
+	unsubscribe := b.Subscribe(func(m pubsub.Message) { h.deliver(m.Topic, m.Payload) })
+	h.mu.Lock()
+	previous := h.unsubscribe
+	h.broker, h.unsubscribe = b, unsubscribe
+	h.mu.Unlock()
+	if previous != nil {
+		previous()
+	}
+}
+
+var GlobalHub = NewHub()
+
+// Subscription receives the messages published on one topic. Its message
+// channel is never closed; Done is closed once the subscription ends,
+// whether through Close or because it fell behind.
+type Subscription struct {
+	hub   *Hub
+	topic string
+	send  chan []byte
+	done  chan struct{}
+	once  sync.Once
+}
+
+// Subscribe starts following topic. The caller must Close the subscription.
+func (h *Hub) Subscribe(topic string) *Subscription {
+	s := &Subscription{
+		hub:   h,
+		topic: topic,
+		send:  make(chan []byte, h.SendBuffer),
+		done:  make(chan struct{}),
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.clients[topic] == nil {
+		h.clients[topic] = make(map[*Subscription]struct{})
+	}
+	h.clients[topic][s] = struct{}{}
+	return s
 }
 
-var GlobalHub = &Hub{
-	clients: make(map[string][]*websocket.Conn),
+// Messages delivers each message as the JSON that was broadcast.
+func (s *Subscription) Messages() <-chan []byte {
+	return s.send
+}
+
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close ends the subscription. It is safe to call more than once.
+func (s *Subscription) Close() {
+	h := s.hub
+	h.mu.Lock()
+	if subs, ok := h.clients[s.topic]; ok {
+		delete(subs, s)
+		if len(subs) == 0 {
+			delete(h.clients, s.topic)
+		}
+	}
+	h.mu.Unlock()
+	s.once.Do(func() { close(s.done) })
 }
 
+// HandleWS streams an order's events. With ?since=<seq> the events after
+// seq are sent first, then live ones.
 func (h *Hub) HandleWS(w http.ResponseWriter, r *http.Request) {
 	orderID := r.URL.Query().Get("orderId")
 	if orderID == "" {
 		http.Error(w, "Order ID required", http.StatusBadRequest)
 		return
 	}
+	var backlog func() ([][]byte, error)
+	if raw := r.URL.Query().Get("since"); raw != "" {
+		since, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || since < 0 {
+			http.Error(w, "Invalid since", http.StatusBadRequest)
+			return
+		}
+		if h.Replay != nil {
+			backlog = func() ([][]byte, error) { return h.Replay(orderID, since) }
+		}
+	}
+	h.serve(orderID, backlog, nil, w, r)
+}
 
+// HandleKitchenWS streams new and updated orders for one outlet to kitchen
+// display screens.
+func (h *Hub) HandleKitchenWS(w http.ResponseWriter, r *http.Request) {
+	outletID := r.URL.Query().Get("outletId")
+	if outletID == "" {
+		http.Error(w, "Outlet ID required", http.StatusBadRequest)
+		return
+	}
+	h.serve(KitchenTopic(outletID), nil, nil, w, r)
+}
+
+// UserTopic is the hub key for every order of one customer.
+func UserTopic(userID string) string {
+	return "user:" + userID
+}
+
+// RiderTopic is the hub key for the orders offered to one rider.
+func RiderTopic(riderID string) string {
+	return "rider:" + riderID
+}
+
+// KitchenTopic is the hub key for an outlet's kitchen feed. Order keys are
+// UUIDs, so the prefix keeps the two apart.
+func KitchenTopic(outletID string) string {
+	return "kitchen:" + outletID
+}
+
+// ServeInbound streams topic to a connection whose client also sends
+// messages. Each one is passed to receive, and a non-nil reply is sent back
+// on the connection. The caller authenticates the request.
+func (h *Hub) ServeInbound(topic string, w http.ResponseWriter, r *http.Request, receive func(msg []byte) []byte) {
+	h.serve(topic, nil, receive, w, r)
+}
+
+// serve subscribes a connection to topic. backlog, if set, is fetched once
+// the subscription is in place, so that nothing falls between the two.
+// receive, if set, handles what the client sends.
+func (h *Hub) serve(topic string, backlog func() ([][]byte, error), receive func([]byte) []byte, w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println(err)
 		return
 	}
 
-	h.mu.Lock()
-	h.clients[orderID] = append(h.clients[orderID], conn)
-	h.mu.Unlock()
+	sub := h.Subscribe(topic)
+	var missed [][]byte
+	if backlog != nil {
+		if missed, err = backlog(); err != nil {
+			log.Println("WS Replay Error:", err)
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "replay failed"), time.Now().Add(h.WriteWait))
+			sub.Close()
+			conn.Close()
+			return
+		}
+	}
+	go h.writePump(sub, conn, missed)
+	h.readPump(sub, conn, receive)
+}
 
-	defer func() {
-		h.mu.Lock()
-		conns := h.clients[orderID]
-		for i, c := range conns {
-			if c == conn {
-				h.clients[orderID] = append(conns[:i], conns[i+1:]...)
-				break
-			}
+// messageSeq returns the sequence number of a numbered message, or 0.
+func messageSeq(msg []byte) int64 {
+	var numbered struct {
+		Seq int64 `json:"seq"`
+	}
+	json.Unmarshal(msg, &numbered)
+	return numbered.Seq
+}
+
+// readPump hands what the client sends to receive, or discards it, and keeps
+// the read deadline moving while pongs arrive. A client that stops
+// answering pings times out here and is removed. Replies share the
+// subscription's buffer and are dropped if it is full.
+func (h *Hub) readPump(sub *Subscription, conn *websocket.Conn, receive func([]byte) []byte) {
+	defer sub.Close()
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(h.PongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(h.PongWait))
+	})
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
 		}
-		if len(h.clients[orderID]) == 0 {
-			delete(h.clients, orderID)
+		if receive == nil {
+			continue
 		}
-		h.mu.Unlock()
+		if reply := receive(msg); reply != nil {
+			select {
+			case sub.send <- reply:
+			default:
+			}
+		}
+	}
+}
+
+// writePump is the only goroutine that writes to conn. It sends the missed
+// messages first and then live ones, skipping live messages the backlog
+// already covered. It closes the connection when the subscription ends.
+func (h *Hub) writePump(sub *Subscription, conn *websocket.Conn, missed [][]byte) {
+	ticker := time.NewTicker(h.PingPeriod)
+	defer func() {
+		ticker.Stop()
+		sub.Close()
 		conn.Close()
 	}()
-
+	var sent int64
+	for _, msg := range missed {
+		conn.SetWriteDeadline(time.Now().Add(h.WriteWait))
+		if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+			return
+		}
+		sent = messageSeq(msg)
+	}
 	for {
-		if _, _, err := conn.ReadMessage(); err != nil {
-			break
+		select {
+		case msg := <-sub.send:
+			if sent > 0 {
+				if seq := messageSeq(msg); seq != 0 && seq <= sent {
+					continue
+				}
+			}
+			conn.SetWriteDeadline(time.Now().Add(h.WriteWait))
+			if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				log.Println("WS Write Error:", err)
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(h.WriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-sub.done:
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(h.WriteWait))
+			return
 		}
 	}
 }
 
-func (h *Hub) BroadcastStatus(orderID string, status string) {
+// Broadcast publishes v as JSON to every connection subscribed to topic, on
+// every instance. If the broker cannot take the message it is still
+// delivered to this instance's clients.
+func (h *Hub) Broadcast(topic string, v interface{}) {
+	msg, err := json.Marshal(v)
+	if err != nil {
+		log.Println("WS Encode Error:", err)
+		return
+	}
 	h.mu.RLock()
-	conns, ok := h.clients[orderID]
+	broker := h.broker
 	h.mu.RUnlock()
-
-	if !ok {
-		return
+	if err := broker.Publish(context.Background(), topic, msg); err != nil {
+		log.Println("WS Publish Error:", err)
+		h.deliver(topic, msg)
 	}
+}
 
-	for _, conn := range conns {
-		err := conn.WriteJSON(map[string]string{
-			"orderId": orderID,
-			"status":  status,
-		})
-		if err != nil {
-			log.Println("WS Write Error:", err)
+// deliver sends msg to this instance's subscriptions on topic. It never
+// blocks on a subscriber: one that cannot take the message is evicted.
+func (h *Hub) deliver(topic string, msg []byte) {
+	var slow []*Subscription
+	h.mu.RLock()
+	for s := range h.clients[topic] {
+		select {
+		case s.send <- msg:
+		default:
+			slow = append(slow, s)
 		}
 	}
+	h.mu.RUnlock()
+
+	for _, s := range slow {
+		log.Println("WS: dropping slow subscriber on", topic)
+		s.Close()
+	}
+}
+
+// subscribers returns how many subscriptions follow topic.
+func (h *Hub) subscribers(topic string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients[topic])
 }
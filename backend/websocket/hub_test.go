@@ -0,0 +1,178 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"order-mgmt-backend/pubsub"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func newServer(t *testing.T, h *Hub) string {
+	srv := httptest.NewServer(http.HandlerFunc(h.HandleWS))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func dial(t *testing.T, url, orderID string) *websocket.Conn {
+	conn, _, err := websocket.DefaultDialer.Dial(url+"?orderId="+orderID, nil)
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestConcurrentBroadcastsReachEveryClient(t *testing.T) {
+	h := NewHub()
+	h.SendBuffer = 256
+	url := newServer(t, h)
+	a, b := dial(t, url, "o1"), dial(t, url, "o1")
+	waitFor(t, func() bool { return h.subscribers("o1") == 2 })
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				h.Broadcast("o1", map[string]string{"orderId": "o1", "status": "Preparing"})
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, conn := range []*websocket.Conn{a, b} {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for i := 0; i < 200; i++ {
+			var msg map[string]string
+			assert.NoError(t, conn.ReadJSON(&msg))
+			assert.Equal(t, "Preparing", msg["status"])
+		}
+	}
+}
+
+func TestSlowConsumerIsEvicted(t *testing.T) {
+	h := NewHub()
+	h.SendBuffer = 1
+	url := newServer(t, h)
+	dial(t, url, "o1") // never reads
+	waitFor(t, func() bool { return h.subscribers("o1") == 1 })
+
+	// Large messages fill the socket buffers, so the writer stalls and the
+	// send buffer overflows.
+	big := strings.Repeat("x", 256<<10)
+	for i := 0; i < 64 && h.subscribers("o1") > 0; i++ {
+		h.Broadcast("o1", big)
+	}
+	waitFor(t, func() bool { return h.subscribers("o1") == 0 })
+}
+
+func TestHeartbeats(t *testing.T) {
+	h := NewHub()
+	h.PingPeriod = 20 * time.Millisecond
+	h.PongWait = 60 * time.Millisecond
+	url := newServer(t, h)
+
+	// Reading lets the client answer pings; the idle one never does.
+	live := dial(t, url, "live")
+	go func() {
+		for {
+			if _, _, err := live.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	dial(t, url, "idle")
+	waitFor(t, func() bool { return h.subscribers("live") == 1 && h.subscribers("idle") == 1 })
+
+	waitFor(t, func() bool { return h.subscribers("idle") == 0 })
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, 1, h.subscribers("live"))
+}
+
+func TestClosedClientIsRemoved(t *testing.T) {
+	h := NewHub()
+	url := newServer(t, h)
+	conn := dial(t, url, "o1")
+	waitFor(t, func() bool { return h.subscribers("o1") == 1 })
+
+	conn.Close()
+	waitFor(t, func() bool { return h.subscribers("o1") == 0 })
+	h.Broadcast("o1", map[string]string{"orderId": "o1", "status": "Delivered"})
+}
+
+func TestBrokerReachesOtherInstances(t *testing.T) {
+	broker := pubsub.NewMemory()
+	a, b := NewHub(), NewHub()
+	a.UseBroker(broker)
+	b.UseBroker(broker)
+	conn := dial(t, newServer(t, b), "o1")
+	waitFor(t, func() bool { return b.subscribers("o1") == 1 })
+
+	a.Broadcast("o1", map[string]string{"orderId": "o1", "status": "Out for Delivery"})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg map[string]string
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, "Out for Delivery", msg["status"])
+}
+
+type failingBroker struct{ *pubsub.Memory }
+
+func (failingBroker) Publish(context.Context, string, []byte) error {
+	return errors.New("broker down")
+}
+
+func TestBroadcastFallsBackToLocalClients(t *testing.T) {
+	h := NewHub()
+	h.UseBroker(failingBroker{pubsub.NewMemory()})
+	conn := dial(t, newServer(t, h), "o1")
+	waitFor(t, func() bool { return h.subscribers("o1") == 1 })
+
+	h.Broadcast("o1", map[string]string{"orderId": "o1", "status": "Ready"})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg map[string]string
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, "Ready", msg["status"])
+}
+
+func TestResumeReplaysMissedMessages(t *testing.T) {
+	h := NewHub()
+	h.Replay = func(topic string, since int64) ([][]byte, error) {
+		assert.Equal(t, "o1", topic)
+		assert.Equal(t, int64(1), since)
+		return [][]byte{[]byte(`{"seq":2}`), []byte(`{"seq":3}`)}, nil
+	}
+	url := newServer(t, h)
+	conn := dial(t, url, "o1&since=1")
+	waitFor(t, func() bool { return h.subscribers("o1") == 1 })
+
+	// The live copy of a replayed message is not sent twice.
+	h.Broadcast("o1", map[string]int{"seq": 3})
+	h.Broadcast("o1", map[string]int{"seq": 4})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for _, want := range []int64{2, 3, 4} {
+		_, msg, err := conn.ReadMessage()
+		assert.NoError(t, err)
+		assert.Equal(t, want, messageSeq(msg))
+	}
+
+	_, resp, err := websocket.DefaultDialer.Dial(url+"?orderId=o1&since=-1", nil)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -0,0 +1,245 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// maxTopics caps the subscriptions one multiplexed connection may hold.
+const maxTopics = 50
+
+var ErrForbidden = errors.New("not allowed to follow this topic")
+
+// Authorizer decides whether a connection may follow a client topic, such
+// as "order:<id>", and returns the hub topic it maps to.
+type Authorizer func(topic string) (string, error)
+
+// Control is a message from a client on a multiplexed connection. Op is
+// "subscribe", "unsubscribe" or "ping". Since resumes an order topic after
+// that sequence number; other topics keep no history, and are refused a
+// Since. ID is echoed back on the reply.
+type Control struct {
+	Op    string `json:"op"`
+	Topic string `json:"topic"`
+	Since *int64 `json:"since,omitempty"`
+	ID    string `json:"id,omitempty"`
+}
+
+// Reply is sent in answer to a control message, and Type "message" carries
+// a published message on one of the connection's topics.
+type Reply struct {
+	Type  string          `json:"type"`
+	Topic string          `json:"topic,omitempty"`
+	ID    string          `json:"id,omitempty"`
+	Error string          `json:"error,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+}
+
+// mux is one multiplexed connection. Its writer is the only goroutine that
+// writes to the socket; subscriptions forward into out without blocking, and
+// a connection that falls behind is closed.
+type mux struct {
+	hub       *Hub
+	conn      *websocket.Conn
+	authorize Authorizer
+	out       chan []byte
+	done      chan struct{}
+	once      sync.Once
+
+	mu   sync.Mutex
+	subs map[string]*Subscription
+}
+
+// ServeMux upgrades a connection that follows any number of topics, added
+// and removed with Control messages. The caller authenticates the request;
+// authorize is asked about every topic.
+func (h *Hub) ServeMux(w http.ResponseWriter, r *http.Request, authorize Authorizer) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	m := &mux{
+		hub:       h,
+		conn:      conn,
+		authorize: authorize,
+		out:       make(chan []byte, h.SendBuffer),
+		done:      make(chan struct{}),
+		subs:      make(map[string]*Subscription),
+	}
+	go m.writePump()
+	m.readPump()
+}
+
+func (m *mux) close() {
+	m.once.Do(func() { close(m.done) })
+}
+
+// push queues msg for the writer, closing the connection if it is too slow
+// to take it.
+func (m *mux) push(msg []byte) {
+	select {
+	case m.out <- msg:
+	case <-m.done:
+	default:
+		log.Println("WS: dropping slow multiplexed connection")
+		m.close()
+	}
+}
+
+func (m *mux) reply(r Reply) {
+	msg, _ := json.Marshal(r)
+	m.push(msg)
+}
+
+func (m *mux) readPump() {
+	defer func() {
+		m.close()
+		m.mu.Lock()
+		for _, sub := range m.subs {
+			sub.Close()
+		}
+		m.mu.Unlock()
+	}()
+	h := m.hub
+	m.conn.SetReadLimit(maxMessageSize)
+	m.conn.SetReadDeadline(time.Now().Add(h.PongWait))
+	m.conn.SetPongHandler(func(string) error {
+		return m.conn.SetReadDeadline(time.Now().Add(h.PongWait))
+	})
+	for {
+		var ctl Control
+		if err := m.conn.ReadJSON(&ctl); err != nil {
+			var syntax *json.SyntaxError
+			if errors.As(err, &syntax) {
+				m.reply(Reply{Type: "error", Error: "invalid message"})
+				continue
+			}
+			return
+		}
+		switch ctl.Op {
+		case "subscribe":
+			m.subscribe(ctl)
+		case "unsubscribe":
+			m.unsubscribe(ctl)
+		case "ping":
+			m.reply(Reply{Type: "pong", ID: ctl.ID})
+		default:
+			m.reply(Reply{Type: "error", ID: ctl.ID, Error: "unknown op"})
+		}
+	}
+}
+
+func (m *mux) subscribe(ctl Control) {
+	hubTopic, err := m.authorize(ctl.Topic)
+	if err != nil {
+		m.reply(Reply{Type: "error", Topic: ctl.Topic, ID: ctl.ID, Error: err.Error()})
+		return
+	}
+	if ctl.Since != nil && !strings.HasPrefix(ctl.Topic, "order:") {
+		m.reply(Reply{Type: "error", Topic: ctl.Topic, ID: ctl.ID, Error: "only order topics can resume with since"})
+		return
+	}
+	m.mu.Lock()
+	if _, ok := m.subs[ctl.Topic]; ok {
+		m.mu.Unlock()
+		m.reply(Reply{Type: "subscribed", Topic: ctl.Topic, ID: ctl.ID})
+		return
+	}
+	if len(m.subs) >= maxTopics {
+		m.mu.Unlock()
+		m.reply(Reply{Type: "error", Topic: ctl.Topic, ID: ctl.ID, Error: "too many topics"})
+		return
+	}
+	sub := m.hub.Subscribe(hubTopic)
+	m.subs[ctl.Topic] = sub
+	m.mu.Unlock()
+
+	var missed [][]byte
+	if ctl.Since != nil && m.hub.Replay != nil {
+		if missed, err = m.hub.Replay(hubTopic, *ctl.Since); err != nil {
+			log.Println("WS Replay Error:", err)
+			m.unsubscribe(Control{Topic: ctl.Topic})
+			m.reply(Reply{Type: "error", Topic: ctl.Topic, ID: ctl.ID, Error: "replay failed"})
+			return
+		}
+	}
+	m.reply(Reply{Type: "subscribed", Topic: ctl.Topic, ID: ctl.ID})
+	go m.forward(ctl.Topic, sub, missed)
+}
+
+func (m *mux) unsubscribe(ctl Control) {
+	m.mu.Lock()
+	sub, ok := m.subs[ctl.Topic]
+	delete(m.subs, ctl.Topic)
+	m.mu.Unlock()
+	if ok {
+		sub.Close()
+	}
+	m.reply(Reply{Type: "unsubscribed", Topic: ctl.Topic, ID: ctl.ID})
+}
+
+// forward wraps a subscription's messages with their topic, after any
+// missed ones, until the subscription or the connection ends.
+func (m *mux) forward(topic string, sub *Subscription, missed [][]byte) {
+	wrap := func(msg []byte) []byte {
+		out, _ := json.Marshal(Reply{Type: "message", Topic: topic, Data: msg})
+		return out
+	}
+	var sent int64
+	for _, msg := range missed {
+		m.push(wrap(msg))
+		sent = messageSeq(msg)
+	}
+	for {
+		select {
+		case msg := <-sub.Messages():
+			if sent > 0 {
+				if seq := messageSeq(msg); seq != 0 && seq <= sent {
+					continue
+				}
+			}
+			m.push(wrap(msg))
+		case <-sub.Done():
+			return
+		case <-m.done:
+			return
+		}
+	}
+}
+
+func (m *mux) writePump() {
+	h := m.hub
+	ticker := time.NewTicker(h.PingPeriod)
+	defer func() {
+		ticker.Stop()
+		m.close()
+		m.conn.Close()
+	}()
+	for {
+		select {
+		case msg := <-m.out:
+			m.conn.SetWriteDeadline(time.Now().Add(h.WriteWait))
+			if err := m.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				log.Println("WS Write Error:", err)
+				return
+			}
+		case <-ticker.C:
+			m.conn.SetWriteDeadline(time.Now().Add(h.WriteWait))
+			if err := m.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-m.done:
+			m.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(h.WriteWait))
+			return
+		}
+	}
+}
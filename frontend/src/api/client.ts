@@ -5,27 +5,39 @@ const API_BASE_URL = import.meta.env.VITE_API_URL || (import.meta.env.PROD ? '/a
 
 export const getMenu = async (): Promise<Item[]> => {
     const response = await axios.get(`${API_BASE_URL}/menu`);
-    return response.data;
+    return response.data.items;
 };
 
 export const createOrder = async (orderData: {
     customer_name: string;
     customer_address: string;
     customer_phone: string;
+    latitude: number;
+    longitude: number;
     payment_method?: string;
     items: { item_id: number; quantity: number }[];
-}): Promise<Order> => {
-    const response = await axios.post(`${API_BASE_URL}/orders`, orderData);
+}, token?: string): Promise<Order> => {
+    const headers = token ? { Authorization: `Bearer ${token}` } : undefined;
+    const response = await axios.post(`${API_BASE_URL}/orders`, orderData, { headers });
+    if (response.data.tracking_token) {
+        localStorage.setItem(`swiggy_tracking_${response.data.id}`, response.data.tracking_token);
+    }
     return response.data;
 };
 
-export const getOrder = async (id: string): Promise<Order> => {
-    const response = await axios.get(`${API_BASE_URL}/orders/${id}`);
+// getOrder reads the order with the tracking token it was placed with, or
+// else the customer's login token.
+export const getOrder = async (id: string, token?: string): Promise<Order> => {
+    const auth = localStorage.getItem(`swiggy_tracking_${id}`) ?? token;
+    const headers = auth ? { Authorization: `Bearer ${auth}` } : undefined;
+    const response = await axios.get(`${API_BASE_URL}/orders/${id}`, { headers });
     return response.data;
 };
 
-export const getUserOrders = async (name: string): Promise<Order[]> => {
-    const response = await axios.get(`${API_BASE_URL}/orders/user/${name}`);
+export const getUserOrders = async (userId: number, token: string): Promise<Order[]> => {
+    const response = await axios.get(`${API_BASE_URL}/users/${userId}/orders`, {
+        headers: { Authorization: `Bearer ${token}` },
+    });
     return response.data;
 };
 
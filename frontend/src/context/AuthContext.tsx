@@ -4,11 +4,12 @@ interface User {
     id: number;
     email: string;
     name: string;
+    token?: string;
 }
 
 interface AuthContextType {
     user: User | null;
-    login: (email: string, name: string) => void;
+    login: (email: string, name: string, token?: string, id?: number) => void;
     logout: () => void;
     isAuthenticated: boolean;
 }
@@ -21,8 +22,8 @@ export function AuthProvider({ children }: { children: ReactNode }) {
         return savedUser ? JSON.parse(savedUser) : null;
     });
 
-    const login = (email: string, name: string) => {
-        const newUser = { id: 1, email, name };
+    const login = (email: string, name: string, token?: string, id?: number) => {
+        const newUser = { id: id ?? 1, email, name, token };
         setUser(newUser);
         localStorage.setItem('swiggy_user', JSON.stringify(newUser));
     };
@@ -10,6 +10,8 @@ export default function Cart({ onBack, onOrderPlaced }: { onBack: () => void; on
     const [formData] = useState({
         name: user?.name || '',
         address: 'Indiranagar, Bengaluru, 560038',
+        latitude: 12.9719,
+        longitude: 77.6412,
         phone: '9876543210'
     });
 
@@ -26,9 +28,11 @@ export default function Cart({ onBack, onOrderPlaced }: { onBack: () => void; on
                 customer_name: formData.name,
                 customer_address: formData.address,
                 customer_phone: formData.phone,
+                latitude: formData.latitude,
+                longitude: formData.longitude,
                 payment_method: paymentMethod,
                 items: cart.map(i => ({ item_id: i.id, quantity: i.quantity })),
-            });
+            }, user?.token);
 
 
             await new Promise(resolve => setTimeout(resolve, 2000));
@@ -134,14 +138,14 @@ export default function Cart({ onBack, onOrderPlaced }: { onBack: () => void; on
                                 <h2 className="text-xl font-bold mb-8">Choose Payment Method</h2>
                                 <div className="grid grid-cols-1 md:grid-cols-2 gap-4">
                                     {[
-                                        { name: 'Swiggy Money', subtitle: 'Balance: ₹0.00', icon: Wallet },
-                                        { name: 'Amazon Pay', subtitle: 'Link your wallet', icon: Percent },
-                                        { name: 'Credit/Debit Card', subtitle: 'Visa, Mastercard...', icon: Receipt },
-                                        { name: 'Cash on Delivery', subtitle: 'Pay after delivery', icon: Phone }
-                                    ].map(method => (
+                                        { name: 'Swiggy Money', method: 'wallet', subtitle: 'Balance: ₹0.00', icon: Wallet },
+                                        { name: 'Amazon Pay', method: 'upi', subtitle: 'Link your wallet', icon: Percent },
+                                        { name: 'Credit/Debit Card', method: 'card', subtitle: 'Visa, Mastercard...', icon: Receipt },
+                                        { name: 'Cash on Delivery', method: 'cod', subtitle: 'Pay after delivery', icon: Phone }
+                                    ].filter(method => method.method !== 'wallet' || user?.token).map(method => (
                                         <div
                                             key={method.name}
-                                            onClick={() => !isLoading && handlePlaceOrder(method.name)}
+                                            onClick={() => !isLoading && handlePlaceOrder(method.method)}
                                             className="border border-gray-200 p-6 flex items-center justify-between group cursor-pointer hover:border-primary-500 transition-all"
                                         >
                                             <div className="flex items-center gap-4">
@@ -188,7 +188,7 @@ export default function Menu({ onGoToCart }: { onGoToCart: () => void }) {
 
             {}
             <Modal isOpen={showAuthModal} onClose={() => setShowAuthModal(false)} title="Login">
-                <AuthForm onSuccess={(email, name) => { login(email, name); setShowAuthModal(false); }} />
+                <AuthForm onSuccess={(email, name, token, id) => { login(email, name, token, id); setShowAuthModal(false); }} />
             </Modal>
 
             <Modal isOpen={showLocationModal} onClose={() => setShowLocationModal(false)} title="Search Location">
@@ -246,7 +246,7 @@ function Modal({ isOpen, onClose, title, children }: any) {
     );
 }
 
-function AuthForm({ onSuccess }: { onSuccess: (email: string, name: string) => void }) {
+function AuthForm({ onSuccess }: { onSuccess: (email: string, name: string, token?: string, id?: number) => void }) {
     const [email, setEmail] = useState('demo@example.com');
     const [password, setPassword] = useState('password123');
     const [loading, setLoading] = useState(false);
@@ -258,7 +258,7 @@ function AuthForm({ onSuccess }: { onSuccess: (email: string, name: string) => v
         setError('');
         try {
             const user = await loginUser(email, password);
-            onSuccess(user.email, user.name);
+            onSuccess(user.email, user.name, user.token, user.id);
         } catch (err) {
             setError('Invalid credentials. Use demo@example.com / password123');
         } finally {
@@ -12,7 +12,7 @@ export default function Tracking({ orderId, onBack }: { orderId: string; onBack:
 
     useEffect(() => {
         const fetchOrder = () => {
-            getOrder(orderId).then((o) => {
+            getOrder(orderId, user?.token).then((o) => {
                 setOrder(o);
                 setStatus(o.status);
             });
@@ -22,16 +22,16 @@ export default function Tracking({ orderId, onBack }: { orderId: string; onBack:
         const interval = setInterval(fetchOrder, 2000);
 
         return () => clearInterval(interval);
-    }, [orderId]);
+    }, [orderId, user?.token]);
 
     useEffect(() => {
-        if (isAuthenticated && user?.name) {
-            getUserOrders(user.name).then((orders) => {
+        if (isAuthenticated && user?.token) {
+            getUserOrders(user.id, user.token).then((orders) => {
 
                 setPastOrders(orders.filter(o => o.id !== orderId));
             });
         }
-    }, [isAuthenticated, user?.name, orderId]);
+    }, [isAuthenticated, user?.id, user?.token, orderId]);
 
     const steps = [
         { label: 'Order Received', key: 'Order Received', time: 'Received' },
@@ -15,6 +15,7 @@ export interface Order {
     status: string;
     created_at: string;
     order_items: OrderItem[];
+    tracking_token?: string;
 }
 
 export interface OrderItem {